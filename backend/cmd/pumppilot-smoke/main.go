@@ -14,10 +14,13 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 
+	"pumppilot/internal/checkpoint"
 	"pumppilot/internal/config"
 	"pumppilot/internal/decoder"
 )
 
+const smokeStream = "smoke"
+
 type rpcBlock struct {
 	Number       string  `json:"number"`
 	Timestamp    string  `json:"timestamp"`
@@ -40,6 +43,7 @@ func main() {
 	pollInterval := flag.Duration("poll", 5*time.Second, "poll interval when ws is unavailable")
 	debug := flag.Bool("debug", false, "enable debug logs")
 	decodeInput := flag.Bool("decode-input", true, "decode input data using ABI")
+	resume := flag.Bool("resume", false, "resume from the smoke stream in the checkpoint file instead of -backfill")
 	flag.Parse()
 
 	cfg, err := config.Load(*configPath)
@@ -93,6 +97,23 @@ func main() {
 		start = head - *backfill + 1
 	}
 
+	var stream *checkpoint.Stream
+	if *resume {
+		cp := checkpoint.NewWithOptions(cfg.Checkpoint.Path, checkpoint.Options{
+			Fingerprint:            cfg.Fingerprint(),
+			HashDepth:              cfg.Checkpoint.HashDepth,
+			AllowFingerprintChange: cfg.Checkpoint.AllowConfigChange,
+		})
+		if _, err := cp.Load(); err != nil {
+			logger.Error("checkpoint load failed", "error", err)
+			os.Exit(1)
+		}
+		stream = cp.Stream(smokeStream)
+		if last := stream.Last(); last > 0 && last < head {
+			start = last + 1
+		}
+	}
+
 	logger.Info("smoke test", "head", head, "start_block", start, "factory", cfg.FactoryAddress)
 
 	last := uint64(0)
@@ -102,13 +123,14 @@ func main() {
 			continue
 		}
 		last = b
+		saveProgress(logger, stream, b)
 	}
 
 	if !*follow {
 		return
 	}
 
-	if err := tailBlocks(ctx, logger, cfg, rpcClient, httpClient, last, *fullInput, *pollInterval, dec); err != nil {
+	if err := tailBlocks(ctx, logger, cfg, rpcClient, httpClient, stream, last, *fullInput, *pollInterval, dec); err != nil {
 		logger.Error("tail failed", "error", err)
 		os.Exit(1)
 	}
@@ -186,11 +208,20 @@ func fetchBlockRaw(ctx context.Context, rpcClient *rpc.Client, blockNum uint64)
 	return &block, nil
 }
 
-func tailBlocks(ctx context.Context, logger *slog.Logger, cfg *config.Config, rpcClient *rpc.Client, httpClient *ethclient.Client, last uint64, fullInput bool, pollInterval time.Duration, dec *decoder.Decoder) error {
+func saveProgress(logger *slog.Logger, stream *checkpoint.Stream, block uint64) {
+	if stream == nil {
+		return
+	}
+	if err := stream.Save(checkpoint.BlockRef{Number: block}); err != nil {
+		logger.Warn("smoke checkpoint save failed", "block", block, "error", err)
+	}
+}
+
+func tailBlocks(ctx context.Context, logger *slog.Logger, cfg *config.Config, rpcClient *rpc.Client, httpClient *ethclient.Client, stream *checkpoint.Stream, last uint64, fullInput bool, pollInterval time.Duration, dec *decoder.Decoder) error {
 	wsClient, err := dialWS(ctx, cfg.RPC.WS)
 	if err != nil {
 		logger.Warn("ws dial failed, falling back to polling", "error", err)
-		return pollLoop(ctx, logger, cfg, rpcClient, httpClient, last, fullInput, pollInterval, dec)
+		return pollLoop(ctx, logger, cfg, rpcClient, httpClient, stream, last, fullInput, pollInterval, dec)
 	}
 	defer wsClient.Close()
 
@@ -198,7 +229,7 @@ func tailBlocks(ctx context.Context, logger *slog.Logger, cfg *config.Config, rp
 	sub, err := wsClient.SubscribeNewHead(ctx, headers)
 	if err != nil {
 		logger.Warn("ws subscribe failed, falling back to polling", "error", err)
-		return pollLoop(ctx, logger, cfg, rpcClient, httpClient, last, fullInput, pollInterval, dec)
+		return pollLoop(ctx, logger, cfg, rpcClient, httpClient, stream, last, fullInput, pollInterval, dec)
 	}
 	logger.Info("tailing via ws newHeads")
 
@@ -220,11 +251,12 @@ func tailBlocks(ctx context.Context, logger *slog.Logger, cfg *config.Config, rp
 				continue
 			}
 			last = h.Number.Uint64()
+			saveProgress(logger, stream, last)
 		}
 	}
 }
 
-func pollLoop(ctx context.Context, logger *slog.Logger, cfg *config.Config, rpcClient *rpc.Client, httpClient *ethclient.Client, last uint64, fullInput bool, pollInterval time.Duration, dec *decoder.Decoder) error {
+func pollLoop(ctx context.Context, logger *slog.Logger, cfg *config.Config, rpcClient *rpc.Client, httpClient *ethclient.Client, stream *checkpoint.Stream, last uint64, fullInput bool, pollInterval time.Duration, dec *decoder.Decoder) error {
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 	logger.Info("tailing via polling", "interval", pollInterval.String())
@@ -244,6 +276,7 @@ func pollLoop(ctx context.Context, logger *slog.Logger, cfg *config.Config, rpcC
 					continue
 				}
 				last = b
+				saveProgress(logger, stream, b)
 			}
 		}
 	}
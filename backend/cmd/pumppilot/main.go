@@ -10,11 +10,23 @@ import (
 	"syscall"
 
 	"pumppilot/internal/app"
+	"pumppilot/internal/checkpoint"
 	"pumppilot/internal/config"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		runBackfill(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+
 	configPath := flag.String("config", "config.yaml", "path to config file")
+	allowConfigChange := flag.Bool("allow-config-change", false, "resume even if the checkpoint was written under a different config fingerprint")
+	migrateCheckpoint := flag.Bool("migrate-checkpoint", false, "rewrite the checkpoint file in the current schema and exit")
 	flag.Parse()
 
 	cfg, err := config.Load(*configPath)
@@ -22,9 +34,22 @@ func main() {
 		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
 		os.Exit(1)
 	}
+	if *allowConfigChange {
+		cfg.Checkpoint.AllowConfigChange = true
+	}
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
 
+	if *migrateCheckpoint {
+		migrated, err := checkpoint.Migrate(cfg.Checkpoint.Path, cfg.Fingerprint())
+		if err != nil {
+			logger.Error("checkpoint migration failed", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("checkpoint migrated", "path", cfg.Checkpoint.Path, "legacy", migrated, "fingerprint", cfg.Fingerprint())
+		return
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sync/errgroup"
+
+	"pumppilot/internal/api"
+	"pumppilot/internal/app"
+	"pumppilot/internal/config"
+	"pumppilot/internal/feed"
+	"pumppilot/internal/index"
+	"pumppilot/internal/keys"
+	"pumppilot/internal/pools"
+	"pumppilot/internal/rpcpool"
+	"pumppilot/internal/trade"
+	"pumppilot/internal/txbuilder"
+	"pumppilot/internal/txtrack"
+)
+
+// runServe runs the pipeline and the API server in one process. They share
+// the RPC pool, and the trade service's fee oracle and nonce manager are the
+// only ones in the process. The API reads pipeline status and takes output
+// records straight from the pipeline instead of following the output file.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to config file")
+	allowConfigChange := fs.Bool("allow-config-change", false, "resume even if the checkpoint was written under a different config fingerprint")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		os.Exit(1)
+	}
+	if *allowConfigChange {
+		cfg.Checkpoint.AllowConfigChange = true
+	}
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	passphrase := os.Getenv(cfg.KeyStore.PassphraseEnv)
+	if passphrase == "" {
+		passphrase = "pumppilot-default"
+		logger.Warn("keystore passphrase env is empty, using default", "env", cfg.KeyStore.PassphraseEnv)
+	}
+	keysManager, err := keys.NewManager(cfg.KeyStore.Dir, passphrase)
+	if err != nil {
+		logger.Error("keystore init failed", "error", err)
+		os.Exit(1)
+	}
+
+	pool, err := rpcpool.New(cfg, logger)
+	if err != nil {
+		logger.Error("rpc pool init failed", "error", err)
+		os.Exit(1)
+	}
+	defer pool.Close()
+	rpcClient, ethClient, err := pool.Dial()
+	if err != nil {
+		logger.Error("rpc dial failed", "error", err)
+		os.Exit(1)
+	}
+	defer ethClient.Close()
+
+	auto, err := txbuilder.NewAutoBuilderFromConfig(ethClient, cfg)
+	if err != nil {
+		logger.Error("auto builder init failed", "error", err)
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	tradeSvc := trade.NewService(auto, ethClient, rpcClient, keysManager)
+	tradeSvc.SetBroadcaster(pool)
+	quoteCfg, err := trade.NewQuoteConfig(cfg)
+	if err != nil {
+		logger.Error("quote config invalid", "error", err)
+		os.Exit(1)
+	}
+	tradeSvc.SetQuoteConfig(quoteCfg)
+	server := api.NewServer(cfg, logger, keysManager, tradeSvc, rpcClient, ethClient)
+	server.SetFeed(feed.NewHub(cfg.API.Feed.Buffer, cfg.API.Feed.ClientBuffer))
+	var idx *index.Index
+	if !cfg.Index.Disabled {
+		if idx, err = index.Open(logger, cfg.Index.Path, cfg.Ingestion.ReorgWindow); err != nil {
+			logger.Error("index open failed", "error", err)
+			os.Exit(1)
+		}
+		defer idx.Close()
+		server.SetIndex(idx)
+	}
+
+	var tracker *pools.Tracker
+	if cfg.Pools.Enabled {
+		if tracker, err = pools.NewTracker(logger, cfg, rpcClient, ethClient); err != nil {
+			logger.Error("pool tracker init failed", "error", err)
+			os.Exit(1)
+		}
+		server.SetPools(tracker)
+	}
+
+	var txs *txtrack.Tracker
+	if !cfg.TxTrack.Disabled {
+		txs = txtrack.New(logger, cfg, ethClient)
+		if err := txs.Load(); err != nil {
+			logger.Error("tx state load failed", "path", cfg.TxTrack.Path, "error", err)
+			os.Exit(1)
+		}
+		tradeSvc.SetRecorder(txs)
+		txs.SetSender(tradeSvc)
+		server.SetTxTracker(txs)
+	}
+
+	application := app.New(cfg, logger)
+	application.SetPool(pool)
+	if idx != nil {
+		application.SetIndex(idx)
+	}
+	application.Observe("api", server.Publish)
+	server.SetPipeline(application)
+
+	g, gctx := errgroup.WithContext(ctx)
+	auto.Start(gctx)
+	g.Go(func() error {
+		return application.Run(gctx)
+	})
+	if tracker != nil {
+		g.Go(func() error {
+			if err := tracker.Run(gctx); !errors.Is(err, context.Canceled) {
+				return err
+			}
+			return nil
+		})
+	}
+	if txs != nil {
+		g.Go(func() error {
+			if err := txs.Run(gctx); !errors.Is(err, context.Canceled) {
+				return err
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		logger.Info("api starting", "listen", cfg.API.Listen)
+		if err := server.Start(gctx); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		logger.Error("serve stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -9,14 +9,17 @@ import (
 	"os/signal"
 	"syscall"
 
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/rpc"
-
 	"pumppilot/internal/api"
 	"pumppilot/internal/config"
+	"pumppilot/internal/feed"
+	"pumppilot/internal/index"
 	"pumppilot/internal/keys"
+	"pumppilot/internal/pools"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/rpcpool"
 	"pumppilot/internal/trade"
 	"pumppilot/internal/txbuilder"
+	"pumppilot/internal/txtrack"
 )
 
 func main() {
@@ -42,14 +45,18 @@ func main() {
 		os.Exit(1)
 	}
 
-	rpcClient, err := rpc.DialHTTP(cfg.RPC.HTTP)
+	pool, err := rpcpool.New(cfg, logger)
+	if err != nil {
+		logger.Error("rpc pool init failed", "error", err)
+		os.Exit(1)
+	}
+	defer pool.Close()
+	pool.SetUserAgent("pumppilot-api")
+	rpcClient, ethClient, err := pool.Dial()
 	if err != nil {
 		logger.Error("rpc dial failed", "error", err)
 		os.Exit(1)
 	}
-	defer rpcClient.Close()
-	rpcClient.SetHeader("User-Agent", "pumppilot-api")
-	ethClient := ethclient.NewClient(rpcClient)
 	defer ethClient.Close()
 
 	auto, err := txbuilder.NewAutoBuilderFromConfig(ethClient, cfg)
@@ -62,7 +69,71 @@ func main() {
 	auto.Start(ctx)
 
 	tradeSvc := trade.NewService(auto, ethClient, rpcClient, keysManager)
+	tradeSvc.SetBroadcaster(pool)
+	quoteCfg, err := trade.NewQuoteConfig(cfg)
+	if err != nil {
+		logger.Error("quote config invalid", "error", err)
+		os.Exit(1)
+	}
+	tradeSvc.SetQuoteConfig(quoteCfg)
 	server := api.NewServer(cfg, logger, keysManager, tradeSvc, rpcClient, ethClient)
+	publish := server.Publish
+	if !cfg.Index.Disabled {
+		idx, err := index.Open(logger, cfg.Index.Path, cfg.Ingestion.ReorgWindow)
+		if err != nil {
+			logger.Error("index open failed", "error", err)
+			os.Exit(1)
+		}
+		defer idx.Close()
+		server.SetIndex(idx)
+		publish = func(rec queue.EnrichedTx) {
+			server.Publish(rec)
+			if err := idx.Add(ctx, rec); err != nil {
+				logger.Warn("index add failed", "tx", rec.TxHash, "block", rec.BlockNumber, "error", err)
+			}
+		}
+		go func() {
+			if err := idx.CatchUp(ctx, cfg.API.Feed.Path); err != nil && ctx.Err() == nil {
+				logger.Error("index catch-up failed", "error", err)
+			}
+		}()
+	}
+	if cfg.Pools.Enabled {
+		tracker, err := pools.NewTracker(logger, cfg, rpcClient, ethClient)
+		if err != nil {
+			logger.Error("pool tracker init failed", "error", err)
+			os.Exit(1)
+		}
+		server.SetPools(tracker)
+		go func() {
+			if err := tracker.Run(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("pool tracker stopped", "error", err)
+			}
+		}()
+	}
+	if !cfg.TxTrack.Disabled {
+		txs := txtrack.New(logger, cfg, ethClient)
+		if err := txs.Load(); err != nil {
+			logger.Error("tx state load failed", "path", cfg.TxTrack.Path, "error", err)
+			os.Exit(1)
+		}
+		tradeSvc.SetRecorder(txs)
+		txs.SetSender(tradeSvc)
+		server.SetTxTracker(txs)
+		go func() {
+			if err := txs.Run(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("tx tracker stopped", "error", err)
+			}
+		}()
+	}
+	if cfg.API.Feed.Path != "-" {
+		server.SetFeed(feed.NewHub(cfg.API.Feed.Buffer, cfg.API.Feed.ClientBuffer))
+		go func() {
+			if err := feed.Tail(ctx, logger, cfg.API.Feed.Path, publish); err != nil && ctx.Err() == nil {
+				logger.Error("feed stopped", "error", err)
+			}
+		}()
+	}
 
 	logger.Info("api starting", "listen", cfg.API.Listen)
 	if err := server.Start(ctx); err != nil && err.Error() != "http: Server closed" {
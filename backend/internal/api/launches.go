@@ -0,0 +1,180 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"pumppilot/internal/index"
+)
+
+// SetIndex serves the launches and deployer profiles of idx. Whoever feeds
+// the server records keeps idx up to date.
+func (s *Server) SetIndex(idx *index.Index) {
+	s.index = idx
+}
+
+func (s *Server) handleLaunches(w http.ResponseWriter, r *http.Request) {
+	s.serveLaunches(w, r, "")
+}
+
+func (s *Server) handleDeployerLaunches(w http.ResponseWriter, r *http.Request) {
+	addr, err := parseAddress(r.PathValue("address"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.serveLaunches(w, r, addr.Hex())
+}
+
+func (s *Server) handleDeployer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.index == nil {
+		writeError(w, http.StatusServiceUnavailable, "index disabled")
+		return
+	}
+	addr, err := parseAddress(r.PathValue("address"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	profile, err := s.index.Profile(r.Context(), addr.Hex(), 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+func (s *Server) handleLaunch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.index == nil {
+		writeError(w, http.StatusServiceUnavailable, "index disabled")
+		return
+	}
+	token, err := parseAddress(r.PathValue("token"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	l, err := s.index.Launch(r.Context(), token.Hex())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if l == nil {
+		writeError(w, http.StatusNotFound, "launch not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// serveLaunches answers a launch query. Parameters:
+//
+//	token, pool, deployer     addresses
+//	name, symbol              substring of the createToken args
+//	uri, alpha                exact createToken args
+//	from_block, to_block      block range
+//	since, until              unix seconds, RFC 3339, or a duration back from now
+//	limit, cursor             page size (default 50, at most 500) and next_cursor
+func (s *Server) serveLaunches(w http.ResponseWriter, r *http.Request, deployer string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.index == nil {
+		writeError(w, http.StatusServiceUnavailable, "index disabled")
+		return
+	}
+	q, err := launchQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if deployer != "" {
+		q.Deployer = deployer
+	}
+	page, err := s.index.Launches(r.Context(), q)
+	if errors.Is(err, index.ErrBadCursor) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func launchQuery(v url.Values, now time.Time) (index.Query, error) {
+	q := index.Query{
+		Name:   v.Get("name"),
+		Symbol: v.Get("symbol"),
+		URI:    v.Get("uri"),
+		Alpha:  v.Get("alpha"),
+		Cursor: v.Get("cursor"),
+		Limit:  50,
+	}
+	for name, dst := range map[string]*string{"token": &q.Token, "pool": &q.Pool, "deployer": &q.Deployer} {
+		if v.Get(name) == "" {
+			continue
+		}
+		addr, err := parseAddress(v.Get(name))
+		if err != nil {
+			return q, errors.New(name + ": " + err.Error())
+		}
+		*dst = addr.Hex()
+	}
+	for name, dst := range map[string]*uint64{"from_block": &q.FromBlock, "to_block": &q.ToBlock} {
+		if v.Get(name) == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(v.Get(name), 10, 64)
+		if err != nil {
+			return q, errors.New("invalid " + name)
+		}
+		*dst = n
+	}
+	for name, dst := range map[string]*uint64{"since": &q.Since, "until": &q.Until} {
+		if v.Get(name) == "" {
+			continue
+		}
+		t, err := parseTime(v.Get(name), now)
+		if err != nil {
+			return q, errors.New("invalid " + name)
+		}
+		*dst = t
+	}
+	if l := v.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 500 {
+			return q, errors.New("limit must be between 1 and 500")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// parseTime reads unix seconds, an RFC 3339 time, or a duration such as
+// "1h" meaning that long before now.
+func parseTime(v string, now time.Time) (uint64, error) {
+	if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+		return n, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return uint64(t.Unix()), nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, errors.New("invalid time")
+	}
+	return uint64(now.Add(-d).Unix()), nil
+}
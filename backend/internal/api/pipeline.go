@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"pumppilot/internal/app"
+	"pumppilot/internal/queue"
+)
+
+// Pipeline is the ingestion pipeline when it runs in the same process as the
+// server.
+type Pipeline interface {
+	Status() app.Status
+}
+
+// SetPipeline serves the status of p on /pipeline/status.
+func (s *Server) SetPipeline(p Pipeline) {
+	s.pipeline = p
+}
+
+// Publish takes an output record for the live feed, the recent launches and
+// the pool tracker.
+func (s *Server) Publish(rec queue.EnrichedTx) {
+	if s.feed != nil {
+		s.feed.Publish(rec)
+	}
+	s.launches.add(rec)
+	if s.pools != nil {
+		s.pools.Add(rec)
+	}
+}
+
+func (s *Server) handlePipelineStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.pipeline == nil {
+		writeError(w, http.StatusServiceUnavailable, "pipeline is not running in this process")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.pipeline.Status())
+}
+
+func (s *Server) handlePipelineLaunches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"launches": s.launches.recent(limit)})
+}
+
+// launchLog keeps the most recent records that launched a token. A record
+// seen again, as on a replay, replaces the earlier copy, and its reverted
+// copy takes it out.
+type launchLog struct {
+	mu   sync.Mutex
+	size int
+	recs []queue.EnrichedTx
+}
+
+func newLaunchLog(size int) *launchLog {
+	return &launchLog{size: size}
+}
+
+func (l *launchLog) add(rec queue.EnrichedTx) {
+	if !rec.IsLaunch() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kept := l.recs[:0]
+	for _, r := range l.recs {
+		if r.TxHash != rec.TxHash || r.BlockHash != rec.BlockHash {
+			kept = append(kept, r)
+		}
+	}
+	l.recs = kept
+	if rec.Reverted {
+		return
+	}
+	if len(l.recs) == l.size {
+		copy(l.recs, l.recs[1:])
+		l.recs = l.recs[:len(l.recs)-1]
+	}
+	l.recs = append(l.recs, rec)
+}
+
+// recent returns up to limit launches, newest first.
+func (l *launchLog) recent(limit int) []queue.EnrichedTx {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]queue.EnrichedTx, 0, min(limit, len(l.recs)))
+	for i := len(l.recs) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, l.recs[i])
+	}
+	return out
+}
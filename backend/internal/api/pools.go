@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pumppilot/internal/pools"
+)
+
+// SetPools serves the pools of t on /pools and has Publish hand it new
+// launches. The caller runs t.
+func (s *Server) SetPools(t *pools.Tracker) {
+	s.pools = t
+}
+
+func (s *Server) handlePools(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.pools == nil {
+		writeError(w, http.StatusServiceUnavailable, "pool tracker disabled")
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	list := s.pools.Pools()
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pools": list})
+}
+
+func (s *Server) handlePool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.pools == nil {
+		writeError(w, http.StatusServiceUnavailable, "pool tracker disabled")
+		return
+	}
+	addr, err := parseAddress(r.PathValue("address"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, ok := s.pools.Pool(addr)
+	if !ok {
+		writeError(w, http.StatusNotFound, "pool not tracked")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -15,9 +16,14 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 
 	"pumppilot/internal/config"
+	"pumppilot/internal/feed"
+	"pumppilot/internal/index"
 	"pumppilot/internal/keys"
+	"pumppilot/internal/metrics"
+	"pumppilot/internal/pools"
 	"pumppilot/internal/trade"
 	"pumppilot/internal/txbuilder"
+	"pumppilot/internal/txtrack"
 )
 
 type Server struct {
@@ -27,10 +33,21 @@ type Server struct {
 	trade     *trade.Service
 	rpcClient *rpc.Client
 	ethClient *ethclient.Client
+	feed      *feed.Hub
+	pipeline  Pipeline
+	launches  *launchLog
+	index     *index.Index
+	pools     *pools.Tracker
+	txs       *txtrack.Tracker
 }
 
 func NewServer(cfg *config.Config, logger *slog.Logger, keys *keys.Manager, tradeSvc *trade.Service, rpcClient *rpc.Client, ethClient *ethclient.Client) *Server {
-	return &Server{cfg: cfg, logger: logger, keys: keys, trade: tradeSvc, rpcClient: rpcClient, ethClient: ethClient}
+	return &Server{cfg: cfg, logger: logger, keys: keys, trade: tradeSvc, rpcClient: rpcClient, ethClient: ethClient, launches: newLaunchLog(cfg.API.RecentLaunches)}
+}
+
+// SetFeed serves the records of hub on /stream/events and /stream/ws.
+func (s *Server) SetFeed(hub *feed.Hub) {
+	s.feed = hub
 }
 
 func (s *Server) Handler() http.Handler {
@@ -41,8 +58,25 @@ func (s *Server) Handler() http.Handler {
 	mux.HandleFunc("/balances", s.withAuth(s.handleBalances))
 	mux.HandleFunc("/trade/buy", s.withAuth(s.handleBuy))
 	mux.HandleFunc("/trade/sell", s.withAuth(s.handleSell))
+	mux.HandleFunc("/trade/quote", s.withAuth(s.handleQuote))
 	mux.HandleFunc("/trade/approve", s.withAuth(s.handleApprove))
 	mux.HandleFunc("/trade/transfer", s.withAuth(s.handleTransfer))
+	mux.HandleFunc("/pipeline/status", s.withAuth(s.handlePipelineStatus))
+	mux.HandleFunc("/pipeline/launches", s.withAuth(s.handlePipelineLaunches))
+	mux.HandleFunc("/launches", s.withAuth(s.handleLaunches))
+	mux.HandleFunc("/launches/{token}", s.withAuth(s.handleLaunch))
+	mux.HandleFunc("/deployers/{address}", s.withAuth(s.handleDeployer))
+	mux.HandleFunc("/deployers/{address}/launches", s.withAuth(s.handleDeployerLaunches))
+	mux.HandleFunc("/pools", s.withAuth(s.handlePools))
+	mux.HandleFunc("/pools/{address}", s.withAuth(s.handlePool))
+	mux.HandleFunc("/txs", s.withAuth(s.handleTxs))
+	mux.HandleFunc("/tx/stream", s.withAuth(s.handleTxStream))
+	mux.HandleFunc("/tx/{hash}", s.withAuth(s.handleTx))
+	mux.HandleFunc("/tx/{hash}/speedup", s.withAuth(s.handleTxSpeedUp))
+	mux.HandleFunc("/tx/{hash}/cancel", s.withAuth(s.handleTxCancel))
+	mux.HandleFunc("/stream/events", s.withAuth(s.handleStreamEvents))
+	mux.HandleFunc("/stream/ws", s.withAuth(s.handleStreamWS))
+	mux.HandleFunc("/metrics", s.withAuth(metrics.Handler().ServeHTTP))
 	return mux
 }
 
@@ -51,6 +85,8 @@ func (s *Server) Start(ctx context.Context) error {
 		Addr:              s.cfg.API.Listen,
 		Handler:           s.Handler(),
 		ReadHeaderTimeout: 5 * time.Second,
+		// Streams end with ctx rather than hold up Shutdown.
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 	go func() {
 		<-ctx.Done()
@@ -216,6 +252,41 @@ func (s *Server) handleBuy(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, res)
 }
 
+// handleQuote fills in the pair and alpha of a token's launch from the
+// index when the request leaves them out.
+func (s *Server) handleQuote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req trade.QuoteRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if s.index != nil && req.Token != "" && (req.Pair == "" || req.Alpha == "") {
+		l, err := s.index.Launch(r.Context(), req.Token)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if l != nil && (req.Pair == "" || strings.EqualFold(req.Pair, l.PoolAddress)) {
+			if req.Pair == "" {
+				req.Pair = l.PoolAddress
+			}
+			if req.Alpha == "" {
+				req.Alpha = l.Alpha
+			}
+		}
+	}
+	res, err := s.trade.Quote(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
 func (s *Server) handleSell(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"pumppilot/internal/feed"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 16 << 10,
+	// Clients are checked by the API token, not by origin.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// wsMessage carries one feed event over the WebSocket.
+type wsMessage struct {
+	ID     string      `json:"id"`
+	Event  string      `json:"event"`
+	Record interface{} `json:"record"`
+}
+
+// handleStreamEvents serves the feed as Server-Sent Events. The event name is
+// the record kind and the data the record as written to the output file.
+func (s *Server) handleStreamEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	sub, ok := s.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	write := func(ev feed.Event) error {
+		data, err := json.Marshal(ev.Record)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", s.feed.ID(ev), ev.Name(), data)
+		return err
+	}
+	for _, ev := range sub.Backlog {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(s.cfg.API.Feed.Heartbeat.Duration)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := write(ev); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// handleStreamWS serves the feed over a WebSocket, one JSON text message per
+// event, with pings as heartbeats. Messages from the client are ignored.
+func (s *Server) handleStreamWS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	sub, ok := s.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	heartbeat := s.cfg.API.Feed.Heartbeat.Duration
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	write := func(ev feed.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(wsMessage{ID: s.feed.ID(ev), Event: ev.Name(), Record: ev.Record})
+	}
+	for _, ev := range sub.Backlog {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+			return
+		case <-gone:
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow"), time.Now().Add(time.Second))
+				return
+			}
+			if err := write(ev); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// subscribe reads the filters and the resume point of a stream request:
+//
+//	creator, event, token   comma separated or repeated
+//	last_event_id           or the Last-Event-ID header
+//	from_block              used without an event id
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) (*feed.Subscription, bool) {
+	if s.feed == nil {
+		writeError(w, http.StatusServiceUnavailable, "feed disabled")
+		return nil, false
+	}
+	q := r.URL.Query()
+	filter := feed.Filter{Events: queryList(q["event"])}
+	for _, v := range queryList(q["creator"]) {
+		addr, err := parseAddress(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "creator: "+err.Error())
+			return nil, false
+		}
+		filter.Creators = append(filter.Creators, addr.Hex())
+	}
+	for _, v := range queryList(q["token"]) {
+		addr, err := parseAddress(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "token: "+err.Error())
+			return nil, false
+		}
+		filter.Tokens = append(filter.Tokens, addr.Hex())
+	}
+
+	var resume *feed.Resume
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = q.Get("last_event_id")
+	}
+	switch {
+	case id != "":
+		from, err := s.feed.ResumeAfter(id)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+		resume = &from
+	case q.Get("from_block") != "":
+		block, err := strconv.ParseUint(q.Get("from_block"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from_block")
+			return nil, false
+		}
+		resume = &feed.Resume{FromBlock: block}
+	}
+	return s.feed.Subscribe(filter, resume), true
+}
+
+func queryList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
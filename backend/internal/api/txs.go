@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"pumppilot/internal/txtrack"
+)
+
+// SetTxTracker serves the txs of t on /txs and /tx. The caller runs t, and
+// sets its sender for /tx/{hash}/speedup and /cancel.
+func (s *Server) SetTxTracker(t *txtrack.Tracker) {
+	s.txs = t
+}
+
+func (s *Server) handleTxs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.txs == nil {
+		writeError(w, http.StatusServiceUnavailable, "tx tracker disabled")
+		return
+	}
+	from := r.URL.Query().Get("from")
+	if from != "" {
+		addr, err := parseAddress(from)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "from: "+err.Error())
+			return
+		}
+		from = addr.Hex()
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"txs": s.txs.List(from)})
+}
+
+func (s *Server) handleTx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.txs == nil {
+		writeError(w, http.StatusServiceUnavailable, "tx tracker disabled")
+		return
+	}
+	hash, err := parseHash(r.PathValue("hash"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tx, ok := s.txs.Get(hash)
+	if !ok {
+		writeError(w, http.StatusNotFound, "tx not tracked")
+		return
+	}
+	writeJSON(w, http.StatusOK, tx)
+}
+
+func (s *Server) handleTxSpeedUp(w http.ResponseWriter, r *http.Request) {
+	s.handleTxReplace(w, r, s.txs.SpeedUp)
+}
+
+func (s *Server) handleTxCancel(w http.ResponseWriter, r *http.Request) {
+	s.handleTxReplace(w, r, s.txs.Cancel)
+}
+
+// handleTxReplace answers with the replacement tx.
+func (s *Server) handleTxReplace(w http.ResponseWriter, r *http.Request, replace func(context.Context, common.Hash) (txtrack.Tx, error)) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.txs == nil {
+		writeError(w, http.StatusServiceUnavailable, "tx tracker disabled")
+		return
+	}
+	hash, err := parseHash(r.PathValue("hash"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tx, err := replace(r.Context(), hash)
+	switch {
+	case errors.Is(err, txtrack.ErrNotTracked):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, txtrack.ErrNotPending), errors.Is(err, txtrack.ErrFeeCeiling):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, tx)
+	}
+}
+
+// handleTxStream serves changes to tracked txs as Server-Sent Events named
+// after the tx status. from limits them to one sender and final=true to
+// final outcomes.
+func (s *Server) handleTxStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.txs == nil {
+		writeError(w, http.StatusServiceUnavailable, "tx tracker disabled")
+		return
+	}
+	q := r.URL.Query()
+	var from string
+	if v := q.Get("from"); v != "" {
+		addr, err := parseAddress(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "from: "+err.Error())
+			return
+		}
+		from = addr.Hex()
+	}
+	finalOnly := q.Get("final") == "true"
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	ch, cancel := s.txs.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(s.cfg.API.Feed.Heartbeat.Duration)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case tx, ok := <-ch:
+			if !ok {
+				return
+			}
+			if (from != "" && !strings.EqualFold(tx.From, from)) || (finalOnly && !tx.Final) {
+				continue
+			}
+			data, err := json.Marshal(tx)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", tx.Status, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func parseHash(value string) (common.Hash, error) {
+	b := common.FromHex(strings.TrimSpace(value))
+	if len(b) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("invalid tx hash %q", value)
+	}
+	return common.BytesToHash(b), nil
+}
@@ -3,7 +3,7 @@ package app
 import (
 	"context"
 	"errors"
-	"net/http"
+	"fmt"
 	"time"
 
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -14,20 +14,69 @@ import (
 	"pumppilot/internal/checkpoint"
 	"pumppilot/internal/config"
 	"pumppilot/internal/decoder"
+	"pumppilot/internal/filter"
+	"pumppilot/internal/index"
+	"pumppilot/internal/metrics"
+	"pumppilot/internal/output"
 	"pumppilot/internal/queue"
+	"pumppilot/internal/rpcpool"
 )
 
 type App struct {
-	cfg    *config.Config
-	logger *slog.Logger
+	cfg       *config.Config
+	logger    *slog.Logger
+	status    *pipelineStatus
+	pool      *rpcpool.Pool
+	index     *index.Index
+	observers []*sinkQueue
 }
 
 func New(cfg *config.Config, logger *slog.Logger) *App {
-	return &App{cfg: cfg, logger: logger}
+	status := newPipelineStatus(cfg)
+	metrics.OnScrape(collectStatus(status))
+	return &App{cfg: cfg, logger: logger, status: status}
+}
+
+// Status reports head, processing lag, queue depths and active watchdog
+// alerts of the running pipeline.
+func (a *App) Status() Status {
+	return a.status.snapshot()
+}
+
+// SetPool makes Run use pool instead of opening its own, so that the
+// pipeline shares endpoint health with the rest of the process. The caller
+// closes it.
+func (a *App) SetPool(pool *rpcpool.Pool) {
+	a.pool = pool
+}
+
+// SetIndex makes Run use idx instead of opening the configured index. The
+// caller closes it.
+func (a *App) SetIndex(idx *index.Index) {
+	a.index = idx
+}
+
+// Observe hands every output record to fn, like a sink, and is called
+// before Run. fn runs on its own goroutine; records it cannot keep up with
+// are dropped rather than holding up the pipeline.
+func (a *App) Observe(name string, fn func(queue.EnrichedTx)) {
+	a.observers = append(a.observers, &sinkQueue{
+		cfg:  config.Sink{Name: name, OnFull: config.OnFullDrop},
+		sink: funcSink(fn),
+		ch:   make(chan queue.EnrichedTx, a.cfg.Performance.QueueSize),
+	})
 }
 
 func (a *App) Run(ctx context.Context) error {
-	rpcClient, httpClient, err := dialHTTP(a.cfg, a.logger)
+	pool := a.pool
+	if pool == nil {
+		var err error
+		if pool, err = rpcpool.New(a.cfg, a.logger); err != nil {
+			return err
+		}
+		defer pool.Close()
+	}
+	rpcClient, httpClient, err := dialHTTP(pool, a.logger)
 	if err != nil {
 		return err
 	}
@@ -38,41 +87,248 @@ func (a *App) Run(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	engine, err := filter.New(*a.cfg)
+	if err != nil {
+		return err
+	}
 
-	cp := checkpoint.New(a.cfg.Checkpoint.Path)
-	_, _ = cp.Load()
+	cp := checkpoint.NewWithOptions(a.cfg.Checkpoint.Path, checkpoint.Options{
+		Fingerprint:            a.cfg.Fingerprint(),
+		HashDepth:              a.cfg.Checkpoint.HashDepth,
+		AllowFingerprintChange: a.cfg.Checkpoint.AllowConfigChange,
+	})
+	last, err := cp.Load()
+	if err != nil {
+		return err
+	}
+	if cp.Migrated() {
+		a.logger.Info("checkpoint migrated from legacy format", "block", last)
+	}
+	mainStream := cp.Stream(checkpoint.MainStream)
+	if a.cfg.Output.ExactlyOnce {
+		// The output file is only known to be complete up to its own cursor,
+		// so everything after it is processed again.
+		if c := cp.Stream(OutputStream).Last(); c > 0 && c < last {
+			a.logger.Info("rewinding to output checkpoint", "from", last, "to", c)
+			if err := mainStream.Rewind(c); err != nil {
+				return err
+			}
+			if a.cfg.Tiers.Head {
+				if err := cp.Stream(ConfirmedStream).Rewind(c); err != nil {
+					return err
+				}
+			}
+			last = c
+		}
+	}
+	resume := last
+	var confirmedStream *checkpoint.Stream
+	if a.cfg.Tiers.Head {
+		confirmedStream = cp.Stream(ConfirmedStream)
+		// Records waiting for confirmations are only held in memory, so the
+		// head tier resumes after the last confirmed block.
+		if c := confirmedStream.Last(); c > 0 && c < resume {
+			a.logger.Info("replaying unconfirmed blocks", "from", c+1, "to", last)
+			resume = c
+		}
+	}
 
 	blockNumCh := make(chan uint64, a.cfg.Performance.QueueSize)
 	queue1 := make(chan queue.TxItem, a.cfg.Performance.QueueSize)
 	queue2 := make(chan queue.FilteredTx, a.cfg.Performance.QueueSize)
 	queue3 := make(chan queue.EnrichedTx, a.cfg.Performance.QueueSize)
 	blockFilteredCh := make(chan queue.BlockFiltered, a.cfg.Performance.QueueSize)
-	blockAckCh := make(chan uint64, a.cfg.Performance.QueueSize)
+	blockAckCh := make(chan queue.BlockRef, a.cfg.Performance.QueueSize)
+	readerRewindCh := make(chan queue.Rewind, 16)
+	trackerRewindCh := make(chan queue.Rewind, 16)
+	reconnectCh := make(chan struct{}, 1)
+
+	dlq := newDeadLetterQueue(a.logger, a.cfg)
+	if err := dlq.load(last); err != nil {
+		return fmt.Errorf("dead-letter load: %w", err)
+	}
+	a.status.setDeadLetters(dlq)
+	a.status.setProcessed(last, 0)
+	idx := a.index
+	if idx == nil && !a.cfg.Index.Disabled {
+		if idx, err = index.Open(a.logger, a.cfg.Index.Path, a.cfg.Ingestion.ReorgWindow); err != nil {
+			return fmt.Errorf("index open: %w", err)
+		}
+		defer idx.Close()
+	}
+	var profiler deployerProfiler
+	var catchUp *catchUpProfiler
+	if idx != nil {
+		// Profiles of new launches count everything written before them, so
+		// they wait for the catch-up; ingestion does not.
+		catchUp = newCatchUpProfiler(idx)
+		profiler = catchUp
+	}
+	sinks, err := openSinks(a.logger, a.cfg)
+	if err != nil {
+		return err
+	}
+	sinks = append(sinks, a.observers...)
+	if idx != nil {
+		sinks = append(sinks, indexSink(a.logger, a.cfg, idx))
+	}
+	queues := []queueGauge{
+		gauge("blocks", blockNumCh),
+		gauge("txs", queue1),
+		gauge("filtered", queue2),
+		gauge("enriched", queue3),
+	}
+	for _, s := range sinks {
+		queues = append(queues, gauge("sink:"+s.cfg.Name, s.ch))
+	}
+	a.status.setQueues(queues...)
+
+	window := newChainWindow(a.cfg.Ingestion.ReorgWindow)
+	window.seed(mainStream.Recent())
+	detector := newReorgDetector(a.logger, rpcClient, a.cfg, window, queue3, readerRewindCh, trackerRewindCh)
+	batcher := newBatchCaller(a.logger, rpcClient, a.cfg)
+	receipts := newReceiptFetcher(a.logger, batcher, a.cfg)
+
+	var mempool *mempoolWatcher
+	if a.cfg.Mempool.Enabled {
+		mempool = newMempoolWatcher(a.logger, a.cfg, pool, batcher, engine, dec)
+	}
 
 	g, gctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
-		return runReader(gctx, a.logger, httpClient, a.cfg, cp, blockNumCh)
+		return batcher.run(gctx)
 	})
 
+	if catchUp != nil {
+		g.Go(func() error {
+			err := idx.CatchUp(gctx, a.cfg.Output.JSONLPath)
+			if err != nil && gctx.Err() == nil {
+				a.logger.Error("index catch-up failed, deployer profiles are off", "error", err)
+			}
+			catchUp.finish(err)
+			return nil
+		})
+	}
+
+	if !a.cfg.Metrics.Disabled {
+		g.Go(func() error {
+			// Metrics are not worth stopping ingestion for, as when the port
+			// is taken.
+			if err := metrics.Serve(gctx, a.logger, a.cfg.Metrics.Listen); err != nil && gctx.Err() == nil {
+				a.logger.Error("metrics server failed", "listen", a.cfg.Metrics.Listen, "error", err)
+			}
+			return nil
+		})
+	}
+
 	g.Go(func() error {
-		return runBlockFetchers(gctx, a.logger, rpcClient, a.cfg, blockNumCh, queue1)
+		return runReader(gctx, a.logger, httpClient, pool, a.cfg, resume, a.status, blockNumCh, readerRewindCh, reconnectCh)
 	})
 
+	switch a.cfg.Ingestion.Mode {
+	case config.IngestionModeLogs:
+		g.Go(func() error {
+			return runLogFetcher(gctx, a.logger, rpcClient, batcher, a.cfg, engine, detector, window, dlq, blockNumCh, queue2, blockFilteredCh)
+		})
+	default:
+		g.Go(func() error {
+			return runBlockFetchers(gctx, a.logger, batcher, a.cfg, engine, detector, dlq, blockNumCh, queue1)
+		})
+
+		g.Go(func() error {
+			return runFilter(gctx, a.logger, engine, window, queue1, queue2, blockFilteredCh)
+		})
+	}
+
 	g.Go(func() error {
-		return runFilter(gctx, a.logger, a.cfg, queue1, queue2, blockFilteredCh)
+		return runEnrichers(gctx, a.logger, receipts, a.cfg, dec, profiler, detector, queue2, queue3, blockAckCh)
 	})
 
+	// With ordered output the sequencer takes the place of the enricher
+	// queue and of the main checkpoint for everything downstream.
+	enriched := queue3
+	var processed progress = mainStream
+	var blockDoneCh chan queue.BlockDone
+	if a.cfg.Output.Ordered {
+		blockDoneCh = make(chan queue.BlockDone, a.cfg.Performance.QueueSize)
+		orderedCh := make(chan queue.EnrichedTx, a.cfg.Performance.QueueSize)
+		seq := newSequencer(a.logger, a.cfg, mainStream.Last())
+		g.Go(func() error {
+			return seq.run(gctx, queue3, blockDoneCh, orderedCh)
+		})
+		enriched = orderedCh
+		processed = seq
+	}
+
+	// Sinks get the records of the main output, or of the head tier when
+	// tiers are on.
+	if len(sinks) > 0 {
+		g.Go(func() error {
+			return serveSinks(gctx, a.logger, sinks)
+		})
+	}
+	tee := func(in chan queue.EnrichedTx) chan queue.EnrichedTx {
+		if len(sinks) == 0 {
+			return in
+		}
+		out := make(chan queue.EnrichedTx, a.cfg.Performance.QueueSize)
+		g.Go(func() error {
+			return teeSinks(gctx, sinks, in, out)
+		})
+		return out
+	}
+
+	if confirmedStream != nil {
+		headCh := make(chan queue.EnrichedTx, a.cfg.Performance.QueueSize)
+		confirmedCh := make(chan any, a.cfg.Performance.QueueSize)
+		g.Go(func() error {
+			return runConfirmer(gctx, a.logger, a.cfg, processed, confirmedStream, a.status, enriched, headCh, confirmedCh)
+		})
+		headOut := tee(headCh)
+		g.Go(func() error {
+			return runEvaluator(gctx, a.logger, a.cfg.Tiers.HeadOutputPath, mempool, headOut)
+		})
+		g.Go(func() error {
+			if a.cfg.Output.ExactlyOnce {
+				w := output.NewWriter[any](a.logger, a.cfg, cp.Stream(OutputStream), confirmedStream, nil)
+				return w.Run(gctx, confirmedCh)
+			}
+			return writeJSONL(gctx, a.logger, a.cfg.Output.JSONLPath, confirmedCh)
+		})
+	} else if a.cfg.Output.ExactlyOnce {
+		// Sinks follow the file here, so a restart does not send them
+		// records twice either.
+		g.Go(func() error {
+			w := output.NewWriter(a.logger, a.cfg, cp.Stream(OutputStream), processed, func(rec queue.EnrichedTx) {
+				mempool.confirm(gctx, rec)
+				_ = offerSinks(gctx, sinks, rec)
+			})
+			return w.Run(gctx, enriched)
+		})
+	} else {
+		out := tee(enriched)
+		g.Go(func() error {
+			return runEvaluator(gctx, a.logger, a.cfg.Output.JSONLPath, mempool, out)
+		})
+	}
+
+	if mempool != nil {
+		g.Go(func() error {
+			return mempool.run(gctx)
+		})
+	}
+
 	g.Go(func() error {
-		return runEnrichers(gctx, a.logger, httpClient, a.cfg, dec, queue2, queue3, blockAckCh)
+		return runTracker(gctx, a.logger, a.cfg, mainStream, a.status, dlq, blockFilteredCh, blockAckCh, trackerRewindCh, blockDoneCh)
 	})
 
 	g.Go(func() error {
-		return runEvaluator(gctx, a.logger, a.cfg, queue3)
+		return runDeadLetterRetrier(gctx, dlq, blockNumCh)
 	})
 
 	g.Go(func() error {
-		return runTracker(gctx, a.logger, a.cfg, cp, blockFilteredCh, blockAckCh)
+		return runWatchdog(gctx, a.logger, a.cfg, a.status, pool, reconnectCh)
 	})
 
 	if err := g.Wait(); err != nil {
@@ -84,17 +340,13 @@ func (a *App) Run(ctx context.Context) error {
 	return nil
 }
 
-func dialHTTP(cfg *config.Config, logger *slog.Logger) (*rpc.Client, *ethclient.Client, error) {
-	httpClient := &http.Client{
-		Timeout: cfg.Performance.RequestTimeout.Duration,
-	}
-	rpcClient, err := rpc.DialHTTPWithClient(cfg.RPC.HTTP, httpClient)
+func dialHTTP(pool *rpcpool.Pool, logger *slog.Logger) (*rpc.Client, *ethclient.Client, error) {
+	rpcClient, client, err := pool.Dial()
 	if err != nil {
 		return nil, nil, err
 	}
-	rpcClient.SetHeader("User-Agent", "pumppilot")
 	logger.Info("rpc http connected")
-	return rpcClient, ethclient.NewClient(rpcClient), nil
+	return rpcClient, client, nil
 }
 
 func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
@@ -0,0 +1,374 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/sync/errgroup"
+
+	"pumppilot/internal/checkpoint"
+	"pumppilot/internal/config"
+	"pumppilot/internal/decoder"
+	"pumppilot/internal/filter"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/rpcpool"
+)
+
+// BackfillStream prefixes the checkpoint streams of backfills, one per
+// requested range.
+const BackfillStream = "backfill"
+
+// backfillStreamName keys the cursor by the requested range, so that a
+// different range does not resume from it. A range up to the head keeps its
+// cursor as the head moves.
+func backfillStreamName(from, to uint64) string {
+	if to == 0 {
+		return fmt.Sprintf("%s:%d-head", BackfillStream, from)
+	}
+	return fmt.Sprintf("%s:%d-%d", BackfillStream, from, to)
+}
+
+type BackfillOptions struct {
+	From       uint64
+	To         uint64
+	ChunkSize  uint64
+	Workers    int
+	OutputPath string
+}
+
+type backfillChunk struct {
+	index   int
+	from    uint64
+	to      uint64
+	records []queue.EnrichedTx
+	err     error
+}
+
+// Backfill indexes [From, To] in chunks processed by Workers goroutines and
+// writes the records in block order. Progress is kept in the checkpoint
+// stream of the requested range, and the range is cut short where the live
+// tail began so that both never write the same blocks.
+func (a *App) Backfill(ctx context.Context, opts BackfillOptions) error {
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = 100
+	}
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.OutputPath == "" {
+		opts.OutputPath = "data/backfill.jsonl"
+	}
+
+	pool, err := rpcpool.New(a.cfg, a.logger)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	rpcClient, httpClient, err := dialHTTP(pool, a.logger)
+	if err != nil {
+		return err
+	}
+	defer rpcClient.Close()
+	defer httpClient.Close()
+
+	dec, err := decoder.New(*a.cfg)
+	if err != nil {
+		return err
+	}
+	engine, err := filter.New(*a.cfg)
+	if err != nil {
+		return err
+	}
+	batcher := newBatchCaller(a.logger, rpcClient, a.cfg)
+	receipts := newReceiptFetcher(a.logger, batcher, a.cfg)
+
+	cp := checkpoint.NewWithOptions(a.cfg.Checkpoint.Path, checkpoint.Options{
+		Fingerprint:            a.cfg.Fingerprint(),
+		HashDepth:              a.cfg.Checkpoint.HashDepth,
+		AllowFingerprintChange: a.cfg.Checkpoint.AllowConfigChange,
+	})
+	if _, err := cp.Load(); err != nil {
+		return err
+	}
+	stream := cp.Stream(backfillStreamName(opts.From, opts.To))
+
+	if opts.To == 0 {
+		head, err := fetchHead(ctx, httpClient, a.cfg)
+		if err != nil {
+			return err
+		}
+		if head > a.cfg.Ingestion.Confirmations {
+			opts.To = head - a.cfg.Ingestion.Confirmations
+		}
+	}
+	to, err := liveLimit(cp, opts.To)
+	if err != nil {
+		return err
+	}
+	if to < opts.To {
+		a.logger.Info("backfill range clipped at live tail", "to", to, "requested_to", opts.To)
+	}
+	start := opts.From
+	if last := stream.Last(); last > 0 && last >= opts.From {
+		start = last + 1
+		a.logger.Info("backfill resuming", "from", start, "last_written", last)
+	}
+	if start > to || to < opts.From {
+		a.logger.Info("backfill nothing to do", "from", start, "to", to)
+		return nil
+	}
+
+	chunks := make([]backfillChunk, 0)
+	for from := start; from <= to; from += opts.ChunkSize {
+		end := from + opts.ChunkSize - 1
+		if end > to || end < from {
+			end = to
+		}
+		chunks = append(chunks, backfillChunk{index: len(chunks), from: from, to: end})
+	}
+	a.logger.Info("backfill start", "from", start, "to", to, "chunks", len(chunks), "workers", opts.Workers)
+
+	if err := os.MkdirAll(filepath.Dir(opts.OutputPath), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(opts.OutputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	jobs := make(chan backfillChunk)
+	results := make(chan backfillChunk, opts.Workers)
+	// Bound how far workers may run ahead of the writer.
+	tokens := make(chan struct{}, opts.Workers*2)
+
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	g, gctx := errgroup.WithContext(runCtx)
+	g.Go(func() error {
+		return batcher.run(gctx)
+	})
+	g.Go(func() error {
+		defer close(jobs)
+		for _, c := range chunks {
+			select {
+			case <-gctx.Done():
+				return gctx.Err()
+			case tokens <- struct{}{}:
+			}
+			select {
+			case <-gctx.Done():
+				return gctx.Err()
+			case jobs <- c:
+			}
+		}
+		return nil
+	})
+	for i := 0; i < opts.Workers; i++ {
+		g.Go(func() error {
+			for c := range jobs {
+				c.records, c.err = a.backfillRange(gctx, rpcClient, batcher, engine, receipts, dec, c.from, c.to)
+				select {
+				case <-gctx.Done():
+					return gctx.Err()
+				case results <- c:
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		enc := json.NewEncoder(file)
+		enc.SetEscapeHTML(false)
+		pending := map[int]backfillChunk{}
+		next := 0
+		for next < len(chunks) {
+			select {
+			case <-gctx.Done():
+				return gctx.Err()
+			case c := <-results:
+				pending[c.index] = c
+			}
+			for {
+				c, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				if c.err != nil {
+					return fmt.Errorf("backfill blocks %d-%d: %w", c.from, c.to, c.err)
+				}
+				if _, err := cp.Load(); err != nil {
+					return err
+				}
+				limit, err := liveLimit(cp, c.to)
+				if err != nil {
+					return err
+				}
+				if limit < c.to {
+					a.logger.Info("backfill reached live tail", "block", limit)
+					c.records = recordsUpTo(c.records, limit)
+					c.to = limit
+					next = len(chunks)
+				}
+				for _, rec := range c.records {
+					if err := enc.Encode(rec); err != nil {
+						return err
+					}
+				}
+				if err := file.Sync(); err != nil {
+					return err
+				}
+				if c.to >= c.from {
+					if err := stream.Save(checkpoint.BlockRef{Number: c.to}); err != nil {
+						return err
+					}
+				}
+				a.logger.Info("backfill chunk written", "from", c.from, "to", c.to, "records", len(c.records))
+				<-tokens
+				if next < len(chunks) {
+					next++
+				}
+			}
+		}
+		// Stop the producer and workers, which may still hold chunks past
+		// the live tail.
+		stop()
+		return nil
+	})
+
+	if err := g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	if ctx.Err() != nil {
+		a.logger.Info("backfill stopped", "last_written", stream.Last())
+		return nil
+	}
+	a.logger.Info("backfill complete", "to", stream.Last())
+	return nil
+}
+
+func (a *App) backfillRange(ctx context.Context, rpcClient *rpc.Client, batcher *batchCaller, engine *filter.Engine, receipts *receiptFetcher, dec *decoder.Decoder, from, to uint64) ([]queue.EnrichedTx, error) {
+	filteredCh := make(chan queue.FilteredTx, 64)
+	blockCh := make(chan queue.BlockFiltered, 64)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(filteredCh)
+		errCh <- a.collectRange(ctx, rpcClient, batcher, engine, from, to, filteredCh, blockCh)
+	}()
+
+	items := make([]queue.FilteredTx, 0)
+	for item := range filteredCh {
+		items = append(items, item)
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+
+	// Enrich concurrently so receipt lookups share batches, keeping order.
+	records := make([]queue.EnrichedTx, len(items))
+	var eg errgroup.Group
+	eg.SetLimit(a.cfg.Performance.ReceiptFetchConcurrency)
+	for i, item := range items {
+		i, item := i, item
+		eg.Go(func() error {
+			records[i] = enrichTx(ctx, a.logger, receipts, a.cfg, dec, item, 0)
+			return nil
+		})
+	}
+	_ = eg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return records, nil
+}
+
+// collectRange produces the matching txs of [from, to] in block order using
+// the configured ingestion mode. Historical ranges skip reorg tracking.
+func (a *App) collectRange(ctx context.Context, rpcClient *rpc.Client, batcher *batchCaller, engine *filter.Engine, from, to uint64, out chan<- queue.FilteredTx, blockFiltered chan queue.BlockFiltered) error {
+	go func() {
+		for range blockFiltered {
+		}
+	}()
+	defer close(blockFiltered)
+
+	if a.cfg.Ingestion.Mode == config.IngestionModeLogs {
+		f := newLogFetcher(a.logger, rpcClient, batcher, a.cfg, engine, nil, nil)
+		return f.processRange(ctx, from, to, out, blockFiltered)
+	}
+
+	for start := from; start <= to; start += uint64(batcher.maxSize) {
+		nums := make([]uint64, 0, batcher.maxSize)
+		for n := start; n <= to && len(nums) < batcher.maxSize; n++ {
+			nums = append(nums, n)
+		}
+		blocks, errs := fetchBlocks(ctx, batcher, nums)
+		logs := fetchBlockLogs(ctx, batcher, engine, blocks, errs)
+		for i, n := range nums {
+			if errs[i] != nil {
+				return fmt.Errorf("block %d: %w", n, errs[i])
+			}
+			meta := decodeBlockMeta(a.logger, blocks[i], n)
+			byTx := logsByTx(logs[i])
+			for _, tx := range blocks[i].Transactions {
+				raw, ok := parseRawTx(tx, a.logger, meta.number)
+				if !ok {
+					continue
+				}
+				rules := engine.Match(raw, byTx[common.HexToHash(raw.Hash)])
+				if len(rules) == 0 {
+					continue
+				}
+				item := queue.FilteredTx{
+					BlockNumber:  meta.number,
+					BlockHash:    meta.hash,
+					Timestamp:    meta.timestamp,
+					Tx:           raw,
+					MatchedRules: rules,
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- item:
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// liveLimit returns the highest block the backfill may write without
+// overlapping the blocks already covered by the live pipeline. A main stream
+// with progress but no first block, as one migrated from the legacy format,
+// could overlap anywhere, so the backfill refuses to run.
+func liveLimit(cp *checkpoint.Store, to uint64) (uint64, error) {
+	main := cp.Stream(checkpoint.MainStream)
+	first := main.First()
+	if first == 0 {
+		if main.Last() > 0 {
+			return 0, fmt.Errorf("checkpoint stream %q has no first_block, so where the live tail began is unknown; set it to the first block the pipeline wrote", checkpoint.MainStream)
+		}
+		return to, nil
+	}
+	if first > to {
+		return to, nil
+	}
+	return first - 1, nil
+}
+
+func recordsUpTo(records []queue.EnrichedTx, block uint64) []queue.EnrichedTx {
+	out := records[:0]
+	for _, r := range records {
+		if r.BlockNumber <= block {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pumppilot/internal/checkpoint"
+)
+
+func TestLiveLimit(t *testing.T) {
+	cp := checkpoint.New(filepath.Join(t.TempDir(), "checkpoint.json"))
+	if to, err := liveLimit(cp, 500); err != nil || to != 500 {
+		t.Fatalf("empty checkpoint: got %d, %v", to, err)
+	}
+	main := cp.Stream(checkpoint.MainStream)
+	if err := main.Save(checkpoint.BlockRef{Number: 300}); err != nil {
+		t.Fatal(err)
+	}
+	if to, err := liveLimit(cp, 500); err != nil || to != 299 {
+		t.Fatalf("live from 300: got %d, %v", to, err)
+	}
+	if to, err := liveLimit(cp, 200); err != nil || to != 200 {
+		t.Fatalf("range below live: got %d, %v", to, err)
+	}
+}
+
+func TestLiveLimitNeedsFirstBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	// A legacy checkpoint only knows the last block.
+	if err := os.WriteFile(path, []byte(`{"last_processed_block": 300}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cp := checkpoint.New(path)
+	if _, err := cp.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := liveLimit(cp, 500); err == nil {
+		t.Fatal("expected an error without first_block")
+	}
+}
@@ -0,0 +1,209 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+	"log/slog"
+
+	"pumppilot/internal/config"
+)
+
+type batchRequest struct {
+	method string
+	args   []interface{}
+	result interface{}
+}
+
+type batchCall struct {
+	req  batchRequest
+	done chan error
+}
+
+// batchCaller coalesces single calls made within batch_linger of each other
+// into JSON-RPC batch requests of at most batch_size elements.
+type batchCaller struct {
+	logger  *slog.Logger
+	rpc     *rpc.Client
+	cfg     *config.Config
+	maxSize int
+	linger  time.Duration
+	calls   chan *batchCall
+}
+
+func newBatchCaller(logger *slog.Logger, rpcClient *rpc.Client, cfg *config.Config) *batchCaller {
+	size := cfg.Performance.BatchSize
+	if size < 1 {
+		size = 1
+	}
+	return &batchCaller{
+		logger:  logger,
+		rpc:     rpcClient,
+		cfg:     cfg,
+		maxSize: size,
+		linger:  cfg.Performance.BatchLinger.Duration,
+		calls:   make(chan *batchCall, size*4),
+	}
+}
+
+func (b *batchCaller) run(ctx context.Context) error {
+	if b.maxSize <= 1 {
+		<-ctx.Done()
+		return context.Canceled
+	}
+	for {
+		var first *batchCall
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case first = <-b.calls:
+		}
+		pending := []*batchCall{first}
+		timer := time.NewTimer(b.linger)
+	collect:
+		for len(pending) < b.maxSize {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				for _, c := range pending {
+					c.done <- ctx.Err()
+				}
+				return context.Canceled
+			case c := <-b.calls:
+				pending = append(pending, c)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		go b.dispatch(ctx, pending)
+	}
+}
+
+func (b *batchCaller) dispatch(ctx context.Context, calls []*batchCall) {
+	reqs := make([]batchRequest, len(calls))
+	for i, c := range calls {
+		reqs[i] = c.req
+	}
+	errs := b.callBatch(ctx, reqs)
+	for i, c := range calls {
+		c.done <- errs[i]
+	}
+}
+
+// Call performs a single call, sharing a batch with concurrent callers when
+// batching is enabled. A null result is reported as ethereum.NotFound.
+func (b *batchCaller) Call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	req := batchRequest{method: method, args: args, result: result}
+	if b.maxSize <= 1 {
+		return b.callBatch(ctx, []batchRequest{req})[0]
+	}
+	c := &batchCall{req: req, done: make(chan error, 1)}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case b.calls <- c:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-c.done:
+		return err
+	}
+}
+
+// callBatch sends reqs in batches of at most batch_size elements and retries
+// only the elements that failed or came back null.
+func (b *batchCaller) callBatch(ctx context.Context, reqs []batchRequest) []error {
+	errs := make([]error, len(reqs))
+	pending := make([]int, len(reqs))
+	for i := range reqs {
+		pending[i] = i
+	}
+	for attempt := 0; ; attempt++ {
+		failed := make([]int, 0)
+		for start := 0; start < len(pending); start += b.maxSize {
+			end := start + b.maxSize
+			if end > len(pending) {
+				end = len(pending)
+			}
+			chunk := pending[start:end]
+			b.send(ctx, reqs, chunk, errs)
+			for _, i := range chunk {
+				if errs[i] != nil && !isMethodUnsupported(errs[i]) {
+					failed = append(failed, i)
+				}
+			}
+		}
+		if len(failed) == 0 || attempt == b.cfg.Performance.RetryMax || ctx.Err() != nil {
+			return errs
+		}
+		b.logger.Debug("retrying failed batch elements", "failed", len(failed), "total", len(reqs), "attempt", attempt+1)
+		wait := b.cfg.Performance.RetryBackoff.Duration * time.Duration(1<<attempt)
+		select {
+		case <-ctx.Done():
+			for _, i := range failed {
+				errs[i] = ctx.Err()
+			}
+			return errs
+		case <-time.After(wait):
+		}
+		pending = failed
+	}
+}
+
+func (b *batchCaller) send(ctx context.Context, reqs []batchRequest, chunk []int, errs []error) {
+	ctxTimeout, cancel := withTimeout(ctx, b.cfg.Performance.RequestTimeout.Duration)
+	defer cancel()
+
+	raws := make([]json.RawMessage, len(chunk))
+	if len(chunk) == 1 {
+		req := reqs[chunk[0]]
+		err := b.rpc.CallContext(ctxTimeout, &raws[0], req.method, req.args...)
+		if err == nil {
+			err = decodeResult(raws[0], req.result)
+		}
+		errs[chunk[0]] = err
+		return
+	}
+
+	elems := make([]rpc.BatchElem, len(chunk))
+	for j, i := range chunk {
+		elems[j] = rpc.BatchElem{Method: reqs[i].method, Args: reqs[i].args, Result: &raws[j]}
+	}
+	err := b.rpc.BatchCallContext(ctxTimeout, elems)
+	for j, i := range chunk {
+		switch {
+		case err != nil:
+			errs[i] = err
+		case elems[j].Error != nil:
+			errs[i] = elems[j].Error
+		default:
+			errs[i] = decodeResult(raws[j], reqs[i].result)
+		}
+	}
+}
+
+func decodeResult(raw json.RawMessage, out interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ethereum.NotFound
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func isMethodUnsupported(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "method not found") ||
+		strings.Contains(msg, "does not exist") ||
+		strings.Contains(msg, "not supported") ||
+		strings.Contains(msg, "unsupported method")
+}
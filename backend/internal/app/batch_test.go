@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"pumppilot/internal/config"
+)
+
+func TestBatchCallerRetriesOnlyFailedElements(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct {
+			ID     json.RawMessage `json:"id"`
+			Params []string        `json:"params"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			// Single call.
+			var one struct {
+				ID     json.RawMessage `json:"id"`
+				Params []string        `json:"params"`
+			}
+			_ = json.Unmarshal(body, &one)
+			reqs = append(reqs, one)
+		}
+		resps := make([]map[string]interface{}, 0, len(reqs))
+		mu.Lock()
+		for _, req := range reqs {
+			key := req.Params[0]
+			calls[key]++
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+			if key == "b" && calls[key] == 1 {
+				resp["result"] = nil
+			} else {
+				resp["result"] = key
+			}
+			resps = append(resps, resp)
+		}
+		mu.Unlock()
+		if len(resps) == 1 && body[0] != '[' {
+			_ = json.NewEncoder(w).Encode(resps[0])
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resps)
+	}))
+	defer srv.Close()
+
+	client, err := rpc.Dial(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	cfg := &config.Config{}
+	cfg.Performance.BatchSize = 10
+	cfg.Performance.RetryMax = 2
+	b := newBatchCaller(slog.New(slog.NewTextHandler(io.Discard, nil)), client, cfg)
+
+	out := make([]string, 3)
+	reqs := make([]batchRequest, 3)
+	for i, key := range []string{"a", "b", "c"} {
+		reqs[i] = batchRequest{method: "test_echo", args: []interface{}{key}, result: &out[i]}
+	}
+	for i, err := range b.callBatch(context.Background(), reqs) {
+		if err != nil {
+			t.Fatalf("element %d: %v", i, err)
+		}
+	}
+	if out[0] != "a" || out[1] != "b" || out[2] != "c" {
+		t.Fatalf("unexpected results: %v", out)
+	}
+	if calls["a"] != 1 || calls["b"] != 2 || calls["c"] != 1 {
+		t.Fatalf("unexpected call counts: %v", calls)
+	}
+}
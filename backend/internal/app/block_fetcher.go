@@ -7,23 +7,26 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/core/types"
 	"log/slog"
 
 	"pumppilot/internal/config"
+	"pumppilot/internal/filter"
 	"pumppilot/internal/queue"
-	"pumppilot/internal/util"
 )
 
 type rpcBlock struct {
 	Number       string  `json:"number"`
 	Hash         string  `json:"hash"`
+	ParentHash   string  `json:"parentHash"`
 	Timestamp    string  `json:"timestamp"`
 	Transactions []rpcTx `json:"transactions"`
 }
 
 type rpcTx struct {
 	Hash                 string  `json:"hash"`
+	BlockHash            *string `json:"blockHash"`
+	BlockNumber          *string `json:"blockNumber"`
 	From                 string  `json:"from"`
 	To                   *string `json:"to"`
 	Nonce                string  `json:"nonce"`
@@ -36,68 +39,145 @@ type rpcTx struct {
 	Input                string  `json:"input"`
 }
 
-func runBlockFetchers(ctx context.Context, logger *slog.Logger, rpcClient *rpc.Client, cfg *config.Config, in <-chan uint64, out chan<- queue.TxItem) error {
+type blockMeta struct {
+	number    uint64
+	hash      common.Hash
+	parent    common.Hash
+	timestamp uint64
+}
+
+func runBlockFetchers(ctx context.Context, logger *slog.Logger, batcher *batchCaller, cfg *config.Config, engine *filter.Engine, detector *reorgDetector, dlq *deadLetterQueue, in <-chan uint64, out chan<- queue.TxItem) error {
 	workers := cfg.Performance.BlockFetchConcurrency
 	if workers < 1 {
 		workers = 1
 	}
 	for i := 0; i < workers; i++ {
-		go blockFetcher(ctx, logger, rpcClient, cfg, in, out, i)
+		go blockFetcher(ctx, logger, batcher, engine, detector, dlq, in, out, i)
 	}
 	<-ctx.Done()
 	return context.Canceled
 }
 
-func blockFetcher(ctx context.Context, logger *slog.Logger, rpcClient *rpc.Client, cfg *config.Config, in <-chan uint64, out chan<- queue.TxItem, workerID int) {
+func blockFetcher(ctx context.Context, logger *slog.Logger, batcher *batchCaller, engine *filter.Engine, detector *reorgDetector, dlq *deadLetterQueue, in <-chan uint64, out chan<- queue.TxItem, workerID int) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case num := <-in:
-			block, err := fetchBlockWithRetry(ctx, rpcClient, cfg, num)
-			if err != nil {
-				logger.Error("fetch block failed", "block", num, "error", err, "worker", workerID)
-				continue
+			nums := []uint64{num}
+		drain:
+			for len(nums) < batcher.maxSize {
+				select {
+				case n := <-in:
+					nums = append(nums, n)
+				default:
+					break drain
+				}
+			}
+			blocks, errs := fetchBlocks(ctx, batcher, nums)
+			logs := fetchBlockLogs(ctx, batcher, engine, blocks, errs)
+			for i, num := range nums {
+				if errs[i] != nil {
+					logger.Error("fetch block failed", "block", num, "error", errs[i], "worker", workerID)
+					dlq.add(num, errs[i])
+					continue
+				}
+				blocksFetched.With().Inc()
+				meta := decodeBlockMeta(logger, blocks[i], num)
+				ok, gen, err := detector.accept(ctx, meta)
+				if err != nil {
+					logger.Error("reorg check failed", "block", num, "error", err, "worker", workerID)
+					dlq.add(num, err)
+					continue
+				}
+				dlq.resolve(num)
+				if !ok {
+					continue
+				}
+				pushBlock(ctx, logger, blocks[i], meta, gen, logs[i], out)
 			}
-			pushBlock(ctx, logger, block, out, num)
 		}
 	}
 }
 
-func fetchBlockWithRetry(ctx context.Context, rpcClient *rpc.Client, cfg *config.Config, num uint64) (*rpcBlock, error) {
-	var block rpcBlock
-	err := util.Retry(ctx, cfg.Performance.RetryMax, cfg.Performance.RetryBackoff.Duration, func() error {
-		ctxTimeout, cancel := withTimeout(ctx, cfg.Performance.RequestTimeout.Duration)
-		defer cancel()
-		if err := rpcClient.CallContext(ctxTimeout, &block, "eth_getBlockByNumber", hexutil.EncodeUint64(num), true); err != nil {
-			return err
+// fetchBlocks downloads full blocks in JSON-RPC batches. Blocks the node
+// does not have yet come back as errors and are retried like failed ones.
+func fetchBlocks(ctx context.Context, batcher *batchCaller, nums []uint64) ([]*rpcBlock, []error) {
+	blocks := make([]*rpcBlock, len(nums))
+	reqs := make([]batchRequest, len(nums))
+	for i, num := range nums {
+		blocks[i] = &rpcBlock{}
+		reqs[i] = batchRequest{
+			method: "eth_getBlockByNumber",
+			args:   []interface{}{hexutil.EncodeUint64(num), true},
+			result: blocks[i],
 		}
-		return nil
-	})
-	return &block, err
+	}
+	return blocks, batcher.callBatch(ctx, reqs)
 }
 
-func pushBlock(ctx context.Context, logger *slog.Logger, block *rpcBlock, out chan<- queue.TxItem, requested uint64) {
-	blockNumber := requested
-	blockHash := common.HexToHash(block.Hash)
-	blockTime := uint64(0)
+// fetchBlockLogs loads the logs the filter rules look at for every block
+// that was fetched without error. A failed log request is recorded in errs
+// so that the block is retried as a whole.
+func fetchBlockLogs(ctx context.Context, batcher *batchCaller, engine *filter.Engine, blocks []*rpcBlock, errs []error) [][]types.Log {
+	logs := make([][]types.Log, len(blocks))
+	if !engine.NeedsLogs() {
+		return logs
+	}
+	idx := make([]int, 0, len(blocks))
+	reqs := make([]batchRequest, 0, len(blocks))
+	for i, block := range blocks {
+		if errs[i] != nil {
+			continue
+		}
+		idx = append(idx, i)
+		reqs = append(reqs, batchRequest{
+			method: "eth_getLogs",
+			args: []interface{}{map[string]interface{}{
+				"blockHash": block.Hash,
+				"address":   engine.LogAddresses(),
+			}},
+			result: &logs[i],
+		})
+	}
+	for j, err := range batcher.callBatch(ctx, reqs) {
+		if err != nil {
+			errs[idx[j]] = fmt.Errorf("logs: %w", err)
+		}
+	}
+	return logs
+}
 
+func decodeBlockMeta(logger *slog.Logger, block *rpcBlock, requested uint64) blockMeta {
+	meta := blockMeta{
+		number: requested,
+		hash:   common.HexToHash(block.Hash),
+		parent: common.HexToHash(block.ParentHash),
+	}
 	if block.Number != "" {
 		if n, err := hexutil.DecodeUint64(block.Number); err == nil {
-			blockNumber = n
+			meta.number = n
 		} else {
 			logger.Warn("block number decode failed", "block", requested, "value", block.Number, "error", err)
 		}
 	}
 	if block.Timestamp != "" {
 		if ts, err := hexutil.DecodeUint64(block.Timestamp); err == nil {
-			blockTime = ts
+			meta.timestamp = ts
 		} else {
 			logger.Warn("block timestamp decode failed", "block", requested, "value", block.Timestamp, "error", err)
 		}
 	}
+	return meta
+}
 
-	logger.Debug("block fetched", "block", blockNumber, "txs", len(block.Transactions))
+func pushBlock(ctx context.Context, logger *slog.Logger, block *rpcBlock, meta blockMeta, gen uint64, logs []types.Log, out chan<- queue.TxItem) {
+	blockNumber := meta.number
+	blockHash := meta.hash
+	blockTime := meta.timestamp
+
+	logger.Debug("block fetched", "block", blockNumber, "txs", len(block.Transactions), "logs", len(logs))
+	byTx := logsByTx(logs)
 
 	for _, tx := range block.Transactions {
 		raw, ok := parseRawTx(tx, logger, blockNumber)
@@ -108,7 +188,9 @@ func pushBlock(ctx context.Context, logger *slog.Logger, block *rpcBlock, out ch
 			BlockNumber: blockNumber,
 			BlockHash:   blockHash,
 			Timestamp:   blockTime,
+			Generation:  gen,
 			Tx:          raw,
+			Logs:        byTx[common.HexToHash(raw.Hash)],
 		}
 		select {
 		case <-ctx.Done():
@@ -121,6 +203,7 @@ func pushBlock(ctx context.Context, logger *slog.Logger, block *rpcBlock, out ch
 		BlockNumber: blockNumber,
 		BlockHash:   blockHash,
 		Timestamp:   blockTime,
+		Generation:  gen,
 		End:         true,
 	}
 	select {
@@ -130,6 +213,17 @@ func pushBlock(ctx context.Context, logger *slog.Logger, block *rpcBlock, out ch
 	}
 }
 
+func logsByTx(logs []types.Log) map[common.Hash][]*types.Log {
+	out := make(map[common.Hash][]*types.Log)
+	for i := range logs {
+		if logs[i].Removed {
+			continue
+		}
+		out[logs[i].TxHash] = append(out[logs[i].TxHash], &logs[i])
+	}
+	return out
+}
+
 func parseRawTx(tx rpcTx, logger *slog.Logger, blockNumber uint64) (*queue.RawTx, bool) {
 	errs := make([]string, 0)
 
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"pumppilot/internal/checkpoint"
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+const (
+	ConfirmedStream = "confirmed"
+
+	TierHead      = "head"
+	TierConfirmed = "confirmed"
+)
+
+// progress reports the last block whose records have all been queued for
+// the confirmer: the main checkpoint, or the sequencer when output is ordered.
+type progress interface {
+	Last() uint64
+}
+
+// confirmer sits behind the enrichers when the head tier is enabled. Every
+// record goes to the head output right away and is held back until its block
+// has the configured confirmations, then written to the confirmed output.
+// Reverted records retract held records, and are passed on to the confirmed
+// output too when a reorg reaches below what was already confirmed.
+type confirmer struct {
+	logger    *slog.Logger
+	cfg       *config.Config
+	processed progress
+	confirmed *checkpoint.Stream
+	held      map[uint64][]queue.EnrichedTx
+	done      uint64
+	// high is the highest block ever confirmed. It stays put when a reorg
+	// rewinds done, since the records above done were already written.
+	high uint64
+}
+
+func newConfirmer(logger *slog.Logger, cfg *config.Config, processed progress, confirmed *checkpoint.Stream) *confirmer {
+	return &confirmer{
+		logger:    logger,
+		cfg:       cfg,
+		processed: processed,
+		confirmed: confirmed,
+		held:      map[uint64][]queue.EnrichedTx{},
+		done:      confirmed.Last(),
+		high:      confirmed.Last(),
+	}
+}
+
+func runConfirmer(ctx context.Context, logger *slog.Logger, cfg *config.Config, processed progress, confirmed *checkpoint.Stream, status *pipelineStatus, in <-chan queue.EnrichedTx, head chan<- queue.EnrichedTx, out chan<- any) error {
+	c := newConfirmer(logger, cfg, processed, confirmed)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case rec := <-in:
+			if err := c.handle(ctx, rec, head, out); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			// Records are queued before their block is acked to the tracker,
+			// so after reading the processed block everything it covers is
+			// either handled already or still buffered in the channel.
+			last := c.processed.Last()
+			for drained := false; !drained; {
+				select {
+				case rec := <-in:
+					if err := c.handle(ctx, rec, head, out); err != nil {
+						return err
+					}
+				default:
+					drained = true
+				}
+			}
+			h := status.headBlock()
+			target := min(last, h-min(h, cfg.Ingestion.Confirmations))
+			if err := c.advance(ctx, target, out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *confirmer) handle(ctx context.Context, rec queue.EnrichedTx, head chan<- queue.EnrichedTx, out chan<- any) error {
+	if rec.Reverted {
+		c.retract(rec)
+		if rec.BlockNumber <= c.high {
+			c.logger.Warn("reorg below confirmed block", "block", rec.BlockNumber, "confirmed", c.high, "tx", rec.TxHash)
+			retraction := rec
+			retraction.Tier = TierConfirmed
+			if err := send(ctx, out, any(retraction)); err != nil {
+				return err
+			}
+		}
+		if rec.BlockNumber <= c.done {
+			c.done = rec.BlockNumber - 1
+			if err := c.confirmed.Rewind(c.done); err != nil {
+				c.logger.Error("confirmed checkpoint rewind failed", "block", c.done, "error", err)
+			}
+		}
+	} else if rec.BlockNumber > c.done {
+		c.held[rec.BlockNumber] = append(c.held[rec.BlockNumber], rec)
+	}
+	rec.Tier = TierHead
+	return send(ctx, head, rec)
+}
+
+func (c *confirmer) retract(rec queue.EnrichedTx) {
+	held := c.held[rec.BlockNumber]
+	kept := held[:0]
+	for _, h := range held {
+		if h.TxHash == rec.TxHash && h.BlockHash == rec.BlockHash {
+			continue
+		}
+		// The block complete marker of an orphaned block goes with its records.
+		if h.Marker != nil && h.BlockHash == rec.BlockHash {
+			continue
+		}
+		kept = append(kept, h)
+	}
+	if len(kept) == 0 {
+		delete(c.held, rec.BlockNumber)
+	} else {
+		c.held[rec.BlockNumber] = kept
+	}
+}
+
+// advance writes the held records of every block up to target in block
+// order and saves the confirmed stream.
+func (c *confirmer) advance(ctx context.Context, target uint64, out chan<- any) error {
+	if target <= c.done {
+		return nil
+	}
+	blocks := make([]uint64, 0)
+	for n := range c.held {
+		if n <= target {
+			blocks = append(blocks, n)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	count := 0
+	for _, n := range blocks {
+		for _, rec := range c.held[n] {
+			if err := send(ctx, out, c.confirmedRecord(rec)); err != nil {
+				return err
+			}
+			count++
+		}
+		delete(c.held, n)
+	}
+	if err := c.confirmed.Save(checkpoint.BlockRef{Number: target}); err != nil {
+		c.logger.Error("confirmed checkpoint save failed", "block", target, "error", err)
+		return nil
+	}
+	c.logger.Debug("blocks confirmed", "from", c.done+1, "to", target, "records", count)
+	c.done = target
+	c.high = max(c.high, target)
+	return nil
+}
+
+func (c *confirmer) confirmedRecord(rec queue.EnrichedTx) any {
+	if c.cfg.Tiers.ConfirmedMode == config.ConfirmedModeReference && rec.Marker == nil {
+		return queue.ConfirmedRef{
+			Tier:        TierConfirmed,
+			Chain:       rec.Chain,
+			ChainID:     rec.ChainID,
+			BlockNumber: rec.BlockNumber,
+			BlockHash:   rec.BlockHash,
+			TxHash:      rec.TxHash,
+		}
+	}
+	rec.Tier = TierConfirmed
+	return rec
+}
+
+func send[T any](ctx context.Context, ch chan<- T, v T) error {
+	select {
+	case <-ctx.Done():
+		return context.Canceled
+	case ch <- v:
+		return nil
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"pumppilot/internal/checkpoint"
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+func TestConfirmerHoldsAndRetractsHeadRecords(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tiers.ConfirmedMode = config.ConfirmedModeReemit
+	cp := checkpoint.NewWithOptions(filepath.Join(t.TempDir(), "checkpoint.json"), checkpoint.Options{HashDepth: 8})
+	if _, err := cp.Load(); err != nil {
+		t.Fatal(err)
+	}
+	c := newConfirmer(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, cp.Stream(checkpoint.MainStream), cp.Stream(ConfirmedStream))
+	ctx := context.Background()
+	head := make(chan queue.EnrichedTx, 8)
+	out := make(chan any, 8)
+
+	for _, rec := range []queue.EnrichedTx{
+		{BlockNumber: 10, BlockHash: "0xa", TxHash: "0x1"},
+		{BlockNumber: 11, BlockHash: "0xb", TxHash: "0x2"},
+		{BlockNumber: 11, BlockHash: "0xb", TxHash: "0x2", Reverted: true},
+	} {
+		if err := c.handle(ctx, rec, head, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(head) != 3 || len(out) != 0 {
+		t.Fatalf("head=%d confirmed=%d, want 3 and 0", len(head), len(out))
+	}
+	if rec := <-head; rec.Tier != TierHead {
+		t.Fatalf("head record tier %q", rec.Tier)
+	}
+
+	if err := c.advance(ctx, 11, out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("want 1 confirmed record, got %d", len(out))
+	}
+	if rec := (<-out).(queue.EnrichedTx); rec.TxHash != "0x1" || rec.Tier != TierConfirmed {
+		t.Fatalf("unexpected confirmed record %+v", rec)
+	}
+	if got := cp.Stream(ConfirmedStream).Last(); got != 11 {
+		t.Fatalf("confirmed stream at %d, want 11", got)
+	}
+
+	// A reorg below the confirmed block is retracted in the confirmed tier
+	// and the replacement is confirmed again.
+	if err := c.handle(ctx, queue.EnrichedTx{BlockNumber: 10, BlockHash: "0xa", TxHash: "0x1", Reverted: true}, head, out); err != nil {
+		t.Fatal(err)
+	}
+	if rec := (<-out).(queue.EnrichedTx); !rec.Reverted || rec.Tier != TierConfirmed {
+		t.Fatalf("unexpected retraction %+v", rec)
+	}
+	if err := c.handle(ctx, queue.EnrichedTx{BlockNumber: 10, BlockHash: "0xc", TxHash: "0x1"}, head, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.advance(ctx, 11, out); err != nil {
+		t.Fatal(err)
+	}
+	if rec := (<-out).(queue.EnrichedTx); rec.BlockHash != "0xc" {
+		t.Fatalf("replacement not confirmed: %+v", rec)
+	}
+}
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"pumppilot/internal/config"
+)
+
+// DeadLetter is a block that could not be fetched and is waiting for retry.
+type DeadLetter struct {
+	Block       uint64    `json:"block"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error"`
+	FirstFailed time.Time `json:"first_failed"`
+	NextRetry   time.Time `json:"next_retry"`
+	Abandoned   bool      `json:"abandoned,omitempty"`
+}
+
+// deadLetterQueue persists failed block numbers and hands them back to the
+// fetch stage with escalating backoff until they succeed.
+type deadLetterQueue struct {
+	logger    *slog.Logger
+	path      string
+	backoff   time.Duration
+	maxWait   time.Duration
+	skipAfter int
+
+	mu      sync.Mutex
+	entries map[uint64]*DeadLetter
+}
+
+func newDeadLetterQueue(logger *slog.Logger, cfg *config.Config) *deadLetterQueue {
+	return &deadLetterQueue{
+		logger:    logger,
+		path:      cfg.DeadLetter.Path,
+		backoff:   cfg.DeadLetter.RetryBackoff.Duration,
+		maxWait:   cfg.DeadLetter.MaxBackoff.Duration,
+		skipAfter: cfg.DeadLetter.SkipAfter,
+		entries:   map[uint64]*DeadLetter{},
+	}
+}
+
+// load reads the persisted queue. Entries at or below the checkpoint were
+// handled by an earlier run and are dropped unless they were abandoned.
+func (q *deadLetterQueue) load(checkpoint uint64) error {
+	b, err := os.ReadFile(q.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var list []DeadLetter
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	for i := range list {
+		e := list[i]
+		if e.Block <= checkpoint && !e.Abandoned {
+			continue
+		}
+		// Retry right away after a restart; the provider may be fine now.
+		if !e.Abandoned {
+			e.NextRetry = now
+		}
+		q.entries[e.Block] = &e
+	}
+	return nil
+}
+
+// add records a failed attempt for block. A nil queue ignores the call.
+func (q *deadLetterQueue) add(block uint64, err error) {
+	q.addBlocks([]uint64{block}, err)
+}
+
+func (q *deadLetterQueue) addBlocks(blocks []uint64, err error) {
+	if q == nil || len(blocks) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var last *DeadLetter
+	for _, block := range blocks {
+		e := q.entries[block]
+		if e == nil {
+			e = &DeadLetter{Block: block, FirstFailed: now}
+			q.entries[block] = e
+		}
+		e.Attempts++
+		if err != nil {
+			e.LastError = err.Error()
+		}
+		e.NextRetry = now.Add(q.delay(e.Attempts))
+		if q.skipAfter > 0 && e.Attempts >= q.skipAfter && !e.Abandoned {
+			e.Abandoned = true
+			q.logger.Error("block abandoned after repeated failures", "block", block, "attempts", e.Attempts, "error", e.LastError)
+		}
+		last = e
+	}
+	q.logger.Warn("blocks queued for retry", "from", blocks[0], "to", blocks[len(blocks)-1], "count", len(blocks), "attempts", last.Attempts, "next_retry", last.NextRetry.Format(time.RFC3339), "error", last.LastError)
+	q.persist()
+}
+
+// resolve drops block from the queue after it went through.
+func (q *deadLetterQueue) resolve(block uint64) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.entries[block]
+	if !ok {
+		return
+	}
+	delete(q.entries, block)
+	q.logger.Info("dead-letter block recovered", "block", block, "attempts", e.Attempts)
+	q.persist()
+}
+
+func (q *deadLetterQueue) get(block uint64) (DeadLetter, bool) {
+	if q == nil {
+		return DeadLetter{}, false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.entries[block]
+	if !ok {
+		return DeadLetter{}, false
+	}
+	return *e, true
+}
+
+func (q *deadLetterQueue) list() []DeadLetter {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]DeadLetter, 0, len(q.entries))
+	for _, e := range q.entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Block < out[j].Block })
+	return out
+}
+
+// due returns the blocks whose retry time has come and pushes their next
+// retry out so that they are not handed out twice while in flight.
+func (q *deadLetterQueue) due(now time.Time) []uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]uint64, 0)
+	for _, e := range q.entries {
+		if e.Abandoned || now.Before(e.NextRetry) {
+			continue
+		}
+		e.NextRetry = now.Add(q.delay(e.Attempts + 1))
+		out = append(out, e.Block)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func (q *deadLetterQueue) delay(attempts int) time.Duration {
+	shift := attempts - 1
+	if shift < 0 {
+		shift = 0
+	}
+	if shift > 16 {
+		shift = 16
+	}
+	d := q.backoff * time.Duration(1<<shift)
+	if q.maxWait > 0 && d > q.maxWait {
+		d = q.maxWait
+	}
+	return d
+}
+
+func (q *deadLetterQueue) persist() {
+	if q.path == "" {
+		return
+	}
+	list := make([]DeadLetter, 0, len(q.entries))
+	for _, e := range q.entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Block < list[j].Block })
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(q.path, b)
+	}
+	if err != nil {
+		q.logger.Error("dead-letter persist failed", "path", q.path, "error", err)
+	}
+}
+
+// runDeadLetterRetrier feeds due blocks back into the fetch stage.
+func runDeadLetterRetrier(ctx context.Context, q *deadLetterQueue, out chan<- uint64) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case now := <-ticker.C:
+			for _, block := range q.due(now) {
+				select {
+				case <-ctx.Done():
+					return context.Canceled
+				case out <- block:
+				}
+			}
+		}
+	}
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Join(err, os.Remove(tmp))
+	}
+	return nil
+}
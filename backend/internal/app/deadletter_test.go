@@ -0,0 +1,55 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pumppilot/internal/config"
+)
+
+func TestDeadLetterQueueBackoffAndPersistence(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.DeadLetter.Path = filepath.Join(t.TempDir(), "deadletter.json")
+	cfg.DeadLetter.RetryBackoff = config.Duration{Duration: time.Second}
+	cfg.DeadLetter.MaxBackoff = config.Duration{Duration: 3 * time.Second}
+	cfg.DeadLetter.SkipAfter = 4
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	q := newDeadLetterQueue(logger, cfg)
+	q.add(10, errors.New("boom"))
+	q.add(11, errors.New("boom"))
+	now := time.Now()
+	if due := q.due(now); len(due) != 0 {
+		t.Fatalf("nothing should be due yet, got %v", due)
+	}
+	if due := q.due(now.Add(2 * time.Second)); len(due) != 2 || due[0] != 10 {
+		t.Fatalf("unexpected due blocks: %v", due)
+	}
+	if due := q.due(now.Add(2 * time.Second)); len(due) != 0 {
+		t.Fatalf("in-flight blocks handed out twice: %v", due)
+	}
+
+	q.add(10, errors.New("again"))
+	q.add(10, errors.New("again"))
+	if e, _ := q.get(10); e.Attempts != 3 || e.NextRetry.Sub(time.Now()) > 3*time.Second {
+		t.Fatalf("backoff not capped: %+v", e)
+	}
+	q.add(10, errors.New("again"))
+	if e, _ := q.get(10); !e.Abandoned {
+		t.Fatalf("block should be abandoned after 4 attempts: %+v", e)
+	}
+	q.resolve(11)
+
+	reloaded := newDeadLetterQueue(logger, cfg)
+	if err := reloaded.load(20); err != nil {
+		t.Fatal(err)
+	}
+	list := reloaded.list()
+	if len(list) != 1 || list[0].Block != 10 || !list[0].Abandoned || list[0].LastError != "again" {
+		t.Fatalf("unexpected reloaded queue: %+v", list)
+	}
+}
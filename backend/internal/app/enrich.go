@@ -2,32 +2,69 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"log/slog"
 
 	"pumppilot/internal/config"
 	"pumppilot/internal/decoder"
 	"pumppilot/internal/queue"
-	"pumppilot/internal/util"
 )
 
-func runEnrichers(ctx context.Context, logger *slog.Logger, client *ethclient.Client, cfg *config.Config, dec *decoder.Decoder, in <-chan queue.FilteredTx, out chan<- queue.EnrichedTx, blockAck chan<- uint64) error {
+// deployerProfiler sums up the launches a deployer made before a block.
+type deployerProfiler interface {
+	Profile(ctx context.Context, deployer string, before uint64) (*queue.DeployerProfile, error)
+}
+
+var errIndexCatchingUp = errors.New("index is still reading earlier output")
+
+// catchUpProfiler holds back profiles until the index has read the output
+// written before this run, which on a first start may be all of it. Launches
+// enriched until then get an error instead of a partial profile.
+type catchUpProfiler struct {
+	profiler deployerProfiler
+	done     chan struct{}
+	err      error
+}
+
+func newCatchUpProfiler(p deployerProfiler) *catchUpProfiler {
+	return &catchUpProfiler{profiler: p, done: make(chan struct{})}
+}
+
+// finish records the outcome of the catch-up.
+func (p *catchUpProfiler) finish(err error) {
+	p.err = err
+	close(p.done)
+}
+
+func (p *catchUpProfiler) Profile(ctx context.Context, deployer string, before uint64) (*queue.DeployerProfile, error) {
+	select {
+	case <-p.done:
+	default:
+		return nil, errIndexCatchingUp
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("index catch-up failed: %w", p.err)
+	}
+	return p.profiler.Profile(ctx, deployer, before)
+}
+
+func runEnrichers(ctx context.Context, logger *slog.Logger, receipts *receiptFetcher, cfg *config.Config, dec *decoder.Decoder, profiler deployerProfiler, detector *reorgDetector, in <-chan queue.FilteredTx, out chan<- queue.EnrichedTx, blockAck chan<- queue.BlockRef) error {
 	workers := cfg.Performance.ReceiptFetchConcurrency
 	if workers < 1 {
 		workers = 1
 	}
 	for i := 0; i < workers; i++ {
-		go enrichWorker(ctx, logger, client, cfg, dec, in, out, blockAck, i)
+		go enrichWorker(ctx, logger, receipts, cfg, dec, profiler, detector, in, out, blockAck, i)
 	}
 	<-ctx.Done()
 	return context.Canceled
 }
 
-func enrichWorker(ctx context.Context, logger *slog.Logger, client *ethclient.Client, cfg *config.Config, dec *decoder.Decoder, in <-chan queue.FilteredTx, out chan<- queue.EnrichedTx, blockAck chan<- uint64, workerID int) {
+func enrichWorker(ctx context.Context, logger *slog.Logger, receipts *receiptFetcher, cfg *config.Config, dec *decoder.Decoder, profiler deployerProfiler, detector *reorgDetector, in <-chan queue.FilteredTx, out chan<- queue.EnrichedTx, blockAck chan<- queue.BlockRef, workerID int) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -36,106 +73,113 @@ func enrichWorker(ctx context.Context, logger *slog.Logger, client *ethclient.Cl
 			if item.Tx == nil {
 				continue
 			}
-			enriched := queue.EnrichedTx{
-				Chain:           cfg.Chain,
-				ChainID:         cfg.ChainID,
-				BlockNumber:     item.BlockNumber,
-				BlockHash:       item.BlockHash.Hex(),
-				BlockTimestamp:  item.Timestamp,
-				TxHash:          item.Tx.Hash,
-				From:            item.Tx.From,
-				To:              item.Tx.To,
-				Nonce:           item.Tx.Nonce,
-				ValueWei:        item.Tx.ValueWei,
-				Gas:             item.Tx.Gas,
-				GasPriceWei:     item.Tx.GasPriceWei,
-				MaxFeePerGasWei: item.Tx.MaxFeePerGasWei,
-				MaxPriorityFee:  item.Tx.MaxPriorityFeeWei,
-				Input:           item.Tx.Input,
-			}
-			enriched.Errors = append(enriched.Errors, item.Tx.ParseErrors...)
-
-			if item.Tx.Type > 255 {
-				enriched.Type = 255
-				enriched.Errors = append(enriched.Errors, "tx_type_overflow")
-			} else {
-				enriched.Type = uint8(item.Tx.Type)
-			}
-
-			if item.Tx.Hash == "" {
-				enriched.Errors = append(enriched.Errors, "missing_tx_hash")
-			} else {
-				receipt, rerr := fetchReceiptWithRetry(ctx, client, cfg, common.HexToHash(item.Tx.Hash))
-				if rerr != nil {
-					logger.Error("receipt fetch failed", "tx", item.Tx.Hash, "error", rerr, "worker", workerID)
-					enriched.Errors = append(enriched.Errors, "receipt: "+rerr.Error())
-				} else if receipt != nil {
-					enriched.Receipt = &queue.ReceiptInfo{
-						Status:            receipt.Status,
-						CumulativeGasUsed: receipt.CumulativeGasUsed,
-						GasUsed:           receipt.GasUsed,
-						TxIndex:           receipt.TransactionIndex,
-						LogsCount:         len(receipt.Logs),
-					}
-					if receipt.EffectiveGasPrice != nil {
-						enriched.Receipt.EffectiveGasPrice = receipt.EffectiveGasPrice.String()
-					}
-					if receipt.ContractAddress != (common.Address{}) {
-						enriched.Receipt.ContractAddress = receipt.ContractAddress.Hex()
+			enriched := enrichTx(ctx, logger, receipts, cfg, dec, item, workerID)
+			if profiler != nil && enriched.IsLaunch() {
+				profile, err := profiler.Profile(ctx, enriched.From, enriched.BlockNumber)
+				if err != nil {
+					level := slog.LevelWarn
+					if errors.Is(err, errIndexCatchingUp) {
+						level = slog.LevelDebug
 					}
-					if cfg.Decoding.DecodeLogs {
-						logs, pool, tokens, derr := dec.DecodeLogs(receipt.Logs)
-						if derr != nil {
-							enriched.Errors = append(enriched.Errors, "decode_logs: "+derr.Error())
-						} else {
-							enriched.DecodedLogs = logs
-							enriched.PoolAddress = pool
-							enriched.TokenAddresses = tokens
-						}
-					}
-				}
-			}
-
-			if cfg.Decoding.DecodeInput && item.Tx.Input != "" {
-				inputBytes, derr := hexutil.Decode(item.Tx.Input)
-				if derr != nil {
-					enriched.Errors = append(enriched.Errors, "decode_input_hex: "+derr.Error())
+					logger.Log(ctx, level, "deployer profile failed", "tx", enriched.TxHash, "deployer", enriched.From, "error", err)
+					enriched.Errors = append(enriched.Errors, "deployer_profile: "+err.Error())
 				} else {
-					method, err := dec.DecodeInput(inputBytes)
-					if err != nil {
-						enriched.Errors = append(enriched.Errors, "decode_input: "+err.Error())
-					} else {
-						enriched.Method = method
-					}
+					enriched.DeployerProfile = profile
 				}
 			}
 
-			select {
-			case <-ctx.Done():
+			if detector.send(ctx, out, enriched, item.Generation) != nil {
 				return
-			case out <- enriched:
 			}
 
 			select {
 			case <-ctx.Done():
 				return
-			case blockAck <- item.BlockNumber:
+			case blockAck <- queue.BlockRef{Number: item.BlockNumber, Hash: item.BlockHash, Generation: item.Generation}:
 			}
 		}
 	}
 }
 
-func fetchReceiptWithRetry(ctx context.Context, client *ethclient.Client, cfg *config.Config, hash common.Hash) (*types.Receipt, error) {
-	var receipt *types.Receipt
-	err := util.Retry(ctx, cfg.Performance.RetryMax, cfg.Performance.RetryBackoff.Duration, func() error {
-		ctxTimeout, cancel := withTimeout(ctx, cfg.Performance.RequestTimeout.Duration)
-		defer cancel()
-		r, err := client.TransactionReceipt(ctxTimeout, hash)
-		if err != nil {
-			return err
+func enrichTx(ctx context.Context, logger *slog.Logger, receipts *receiptFetcher, cfg *config.Config, dec *decoder.Decoder, item queue.FilteredTx, workerID int) queue.EnrichedTx {
+	enriched := queue.EnrichedTx{
+		Chain:           cfg.Chain,
+		ChainID:         cfg.ChainID,
+		BlockNumber:     item.BlockNumber,
+		BlockHash:       item.BlockHash.Hex(),
+		BlockTimestamp:  item.Timestamp,
+		TxHash:          item.Tx.Hash,
+		From:            item.Tx.From,
+		To:              item.Tx.To,
+		Nonce:           item.Tx.Nonce,
+		ValueWei:        item.Tx.ValueWei,
+		Gas:             item.Tx.Gas,
+		GasPriceWei:     item.Tx.GasPriceWei,
+		MaxFeePerGasWei: item.Tx.MaxFeePerGasWei,
+		MaxPriorityFee:  item.Tx.MaxPriorityFeeWei,
+		Input:           item.Tx.Input,
+		MatchedRules:    item.MatchedRules,
+	}
+	enriched.Errors = append(enriched.Errors, item.Tx.ParseErrors...)
+
+	if item.Tx.Type > 255 {
+		enriched.Type = 255
+		enriched.Errors = append(enriched.Errors, "tx_type_overflow")
+	} else {
+		enriched.Type = uint8(item.Tx.Type)
+	}
+
+	if item.Tx.Hash == "" {
+		enriched.Errors = append(enriched.Errors, "missing_tx_hash")
+	} else {
+		receipt, rerr := receipts.fetch(ctx, item.BlockHash, common.HexToHash(item.Tx.Hash))
+		if rerr != nil {
+			logger.Error("receipt fetch failed", "tx", item.Tx.Hash, "error", rerr, "worker", workerID)
+			receiptsFetched.With("error").Inc()
+			enriched.Errors = append(enriched.Errors, "receipt: "+rerr.Error())
+		} else if receipt != nil {
+			receiptsFetched.With("ok").Inc()
+			enriched.Receipt = &queue.ReceiptInfo{
+				Status:            receipt.Status,
+				CumulativeGasUsed: receipt.CumulativeGasUsed,
+				GasUsed:           receipt.GasUsed,
+				TxIndex:           receipt.TransactionIndex,
+				LogsCount:         len(receipt.Logs),
+			}
+			if receipt.EffectiveGasPrice != nil {
+				enriched.Receipt.EffectiveGasPrice = receipt.EffectiveGasPrice.String()
+			}
+			if receipt.ContractAddress != (common.Address{}) {
+				enriched.Receipt.ContractAddress = receipt.ContractAddress.Hex()
+			}
+			if cfg.Decoding.DecodeLogs {
+				logs, pool, tokens, derr := dec.DecodeLogs(receipt.Logs)
+				if derr != nil {
+					decodeErrors.With("logs").Inc()
+					enriched.Errors = append(enriched.Errors, "decode_logs: "+derr.Error())
+				} else {
+					enriched.DecodedLogs = logs
+					enriched.PoolAddress = pool
+					enriched.TokenAddresses = tokens
+				}
+			}
 		}
-		receipt = r
-		return nil
-	})
-	return receipt, err
+	}
+
+	if cfg.Decoding.DecodeInput && item.Tx.Input != "" {
+		inputBytes, derr := hexutil.Decode(item.Tx.Input)
+		if derr != nil {
+			decodeErrors.With("input").Inc()
+			enriched.Errors = append(enriched.Errors, "decode_input_hex: "+derr.Error())
+		} else {
+			method, err := dec.DecodeInput(inputBytes)
+			if err != nil {
+				decodeErrors.With("input").Inc()
+				enriched.Errors = append(enriched.Errors, "decode_input: "+err.Error())
+			} else {
+				enriched.Method = method
+			}
+		}
+	}
+	return enriched
 }
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"pumppilot/internal/queue"
+)
+
+type staticProfiler struct{}
+
+func (staticProfiler) Profile(ctx context.Context, deployer string, before uint64) (*queue.DeployerProfile, error) {
+	return &queue.DeployerProfile{}, nil
+}
+
+func TestCatchUpProfilerWaitsForCatchUp(t *testing.T) {
+	ctx := context.Background()
+	p := newCatchUpProfiler(staticProfiler{})
+	if _, err := p.Profile(ctx, "0x01", 10); !errors.Is(err, errIndexCatchingUp) {
+		t.Fatalf("profile during catch-up: %v, want errIndexCatchingUp", err)
+	}
+	p.finish(nil)
+	if prof, err := p.Profile(ctx, "0x01", 10); err != nil || prof == nil {
+		t.Fatalf("profile after catch-up: %v, %v", prof, err)
+	}
+
+	failed := newCatchUpProfiler(staticProfiler{})
+	failed.finish(errors.New("bad segment"))
+	if _, err := failed.Profile(ctx, "0x01", 10); err == nil {
+		t.Fatal("profile after a failed catch-up succeeded")
+	}
+}
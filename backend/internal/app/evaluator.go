@@ -7,20 +7,44 @@ import (
 	"os"
 	"path/filepath"
 
-	"pumppilot/internal/config"
 	"pumppilot/internal/queue"
 )
 
-func runEvaluator(ctx context.Context, logger *slog.Logger, cfg *config.Config, in <-chan queue.EnrichedTx) error {
+// OutputStream is the checkpoint stream of the exactly-once output writer.
+const OutputStream = "output"
+
+func runEvaluator(ctx context.Context, logger *slog.Logger, path string, mempool *mempoolWatcher, in <-chan queue.EnrichedTx) error {
+	records := make(chan queue.EnrichedTx)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case item := <-in:
+				mempool.confirm(ctx, item)
+				select {
+				case <-ctx.Done():
+					return
+				case records <- item:
+				}
+			}
+		}
+	}()
+	return writeJSONL(ctx, logger, path, records)
+}
+
+// writeJSONL appends every value from in to path as one JSON line. A path
+// of "-" writes to stdout.
+func writeJSONL[T any](ctx context.Context, logger *slog.Logger, path string, in <-chan T) error {
 	var file *os.File
-	if cfg.Output.JSONLPath == "-" {
+	if path == "-" {
 		file = os.Stdout
 	} else {
-		dir := filepath.Dir(cfg.Output.JSONLPath)
+		dir := filepath.Dir(path)
 		if err := os.MkdirAll(dir, 0o755); err != nil {
 			return err
 		}
-		f, err := os.OpenFile(cfg.Output.JSONLPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 		if err != nil {
 			return err
 		}
@@ -30,6 +54,7 @@ func runEvaluator(ctx context.Context, logger *slog.Logger, cfg *config.Config,
 
 	enc := json.NewEncoder(file)
 	enc.SetEscapeHTML(false)
+	written := recordsWritten.With(path)
 
 	for {
 		select {
@@ -37,8 +62,10 @@ func runEvaluator(ctx context.Context, logger *slog.Logger, cfg *config.Config,
 			return context.Canceled
 		case item := <-in:
 			if err := enc.Encode(item); err != nil {
-				logger.Error("output encode failed", "error", err)
+				logger.Error("output encode failed", "path", path, "error", err)
+				continue
 			}
+			written.Inc()
 		}
 	}
 }
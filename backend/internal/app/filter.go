@@ -2,17 +2,14 @@ package app
 
 import (
 	"context"
-	"strings"
 
-	"github.com/ethereum/go-ethereum/common"
 	"log/slog"
 
-	"pumppilot/internal/config"
+	"pumppilot/internal/filter"
 	"pumppilot/internal/queue"
 )
 
-func runFilter(ctx context.Context, logger *slog.Logger, cfg *config.Config, in <-chan queue.TxItem, out chan<- queue.FilteredTx, blockFiltered chan<- queue.BlockFiltered) error {
-	factory := common.HexToAddress(cfg.FactoryAddress)
+func runFilter(ctx context.Context, logger *slog.Logger, engine *filter.Engine, window *chainWindow, in <-chan queue.TxItem, out chan<- queue.FilteredTx, blockFiltered chan<- queue.BlockFiltered) error {
 	counts := map[uint64]int{}
 
 	for {
@@ -26,25 +23,29 @@ func runFilter(ctx context.Context, logger *slog.Logger, cfg *config.Config, in
 				select {
 				case <-ctx.Done():
 					return context.Canceled
-				case blockFiltered <- queue.BlockFiltered{BlockNumber: item.BlockNumber, FilteredCount: count}:
+				case blockFiltered <- queue.BlockFiltered{BlockNumber: item.BlockNumber, BlockHash: item.BlockHash, Timestamp: item.Timestamp, Generation: item.Generation, FilteredCount: count}:
 				}
 				continue
 			}
-			if item.Tx == nil {
+			rules := engine.Match(item.Tx, item.Logs)
+			if len(rules) == 0 {
 				continue
 			}
-			if item.Tx.To == "" {
-				continue
-			}
-			if !strings.EqualFold(item.Tx.To, factory.Hex()) {
+			if !window.addTx(item.BlockNumber, item.BlockHash, item.Tx) {
+				logger.Debug("tx from orphaned block skipped", "block", item.BlockNumber, "tx", item.Tx.Hash)
 				continue
 			}
 			counts[item.BlockNumber]++
+			for _, r := range rules {
+				txsFiltered.With(r).Inc()
+			}
 			filtered := queue.FilteredTx{
-				BlockNumber: item.BlockNumber,
-				BlockHash:   item.BlockHash,
-				Timestamp:   item.Timestamp,
-				Tx:          item.Tx,
+				BlockNumber:  item.BlockNumber,
+				BlockHash:    item.BlockHash,
+				Timestamp:    item.Timestamp,
+				Generation:   item.Generation,
+				Tx:           item.Tx,
+				MatchedRules: rules,
 			}
 			select {
 			case <-ctx.Done():
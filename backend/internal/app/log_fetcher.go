@@ -0,0 +1,339 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"log/slog"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/filter"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/util"
+)
+
+// logFetcher is the "logs" ingestion mode: instead of downloading every
+// block it asks for the logs of the filter rules' contracts over a block
+// range and only fetches the transactions that emitted them.
+type logFetcher struct {
+	logger    *slog.Logger
+	client    *ethclient.Client
+	batcher   *batchCaller
+	cfg       *config.Config
+	engine    *filter.Engine
+	detector  *reorgDetector
+	window    *chainWindow
+	addresses []common.Address
+
+	maxRange  uint64
+	rangeSize uint64
+	successes int
+}
+
+func newLogFetcher(logger *slog.Logger, rpcClient *rpc.Client, batcher *batchCaller, cfg *config.Config, engine *filter.Engine, detector *reorgDetector, window *chainWindow) *logFetcher {
+	f := &logFetcher{
+		logger:    logger,
+		client:    ethclient.NewClient(rpcClient),
+		batcher:   batcher,
+		cfg:       cfg,
+		engine:    engine,
+		detector:  detector,
+		window:    window,
+		addresses: engine.LogAddresses(),
+		maxRange:  cfg.Ingestion.LogRangeSize,
+		rangeSize: cfg.Ingestion.LogRangeSize,
+	}
+	if f.maxRange < 1 {
+		f.maxRange = 1
+		f.rangeSize = 1
+	}
+	return f
+}
+
+func runLogFetcher(ctx context.Context, logger *slog.Logger, rpcClient *rpc.Client, batcher *batchCaller, cfg *config.Config, engine *filter.Engine, detector *reorgDetector, window *chainWindow, dlq *deadLetterQueue, in <-chan uint64, out chan<- queue.FilteredTx, blockFiltered chan<- queue.BlockFiltered) error {
+	f := newLogFetcher(logger, rpcClient, batcher, cfg, engine, detector, window)
+
+	var pending *uint64
+	for {
+		var from uint64
+		if pending != nil {
+			from = *pending
+			pending = nil
+		} else {
+			select {
+			case <-ctx.Done():
+				return context.Canceled
+			case from = <-in:
+			}
+		}
+		to := from
+	drain:
+		for to-from+1 < f.rangeSize {
+			select {
+			case n := <-in:
+				if n != to+1 {
+					pending = &n
+					break drain
+				}
+				to = n
+			default:
+				break drain
+			}
+		}
+
+		err := f.processRange(ctx, from, to, out, blockFiltered)
+		if err != nil && ctx.Err() != nil {
+			return context.Canceled
+		}
+		// Blocks before the failing one went through.
+		failedFrom := to + 1
+		var rerr *rangeError
+		if errors.As(err, &rerr) {
+			failedFrom = rerr.from
+		} else if err != nil {
+			failedFrom = from
+		}
+		if err != nil {
+			logger.Error("log range failed", "from", from, "to", to, "failed_from", failedFrom, "error", err)
+		}
+		failed := make([]uint64, 0)
+		for n := from; n <= to; n++ {
+			if n >= failedFrom {
+				failed = append(failed, n)
+			} else {
+				dlq.resolve(n)
+			}
+		}
+		dlq.addBlocks(failed, err)
+	}
+}
+
+// rangeError marks the first block of a range that was not processed.
+type rangeError struct {
+	from uint64
+	err  error
+}
+
+func (e *rangeError) Error() string { return fmt.Sprintf("block %d: %v", e.from, e.err) }
+func (e *rangeError) Unwrap() error { return e.err }
+
+func (f *logFetcher) processRange(ctx context.Context, from, to uint64, out chan<- queue.FilteredTx, blockFiltered chan<- queue.BlockFiltered) error {
+	logs, err := f.fetchLogs(ctx, from, to)
+	if err != nil {
+		return &rangeError{from: from, err: err}
+	}
+	byBlock := map[uint64][]types.Log{}
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+		byBlock[l.BlockNumber] = append(byBlock[l.BlockNumber], l)
+	}
+	f.logger.Debug("logs fetched", "from", from, "to", to, "logs", len(logs), "blocks_with_logs", len(byBlock))
+
+	// Every header in the range is linked, not only those with logs, so that
+	// a reorg of blocks without logs is seen and the parent-hash chain has
+	// no gaps.
+	headers, errs := f.fetchHeaders(ctx, from, to)
+	for i, n := 0, from; n <= to; i, n = i+1, n+1 {
+		if errs[i] != nil {
+			return &rangeError{from: n, err: fmt.Errorf("header: %w", errs[i])}
+		}
+		if err := f.processBlock(ctx, n, headers[i], byBlock[n], out, blockFiltered); err != nil {
+			return &rangeError{from: n, err: err}
+		}
+	}
+	return nil
+}
+
+// fetchHeaders reads the headers of from..to in batches.
+func (f *logFetcher) fetchHeaders(ctx context.Context, from, to uint64) ([]*rpcHeader, []error) {
+	headers := make([]*rpcHeader, to-from+1)
+	reqs := make([]batchRequest, len(headers))
+	for i := range reqs {
+		reqs[i] = batchRequest{method: "eth_getBlockByNumber", args: []interface{}{hexutil.EncodeUint64(from + uint64(i)), false}, result: &headers[i]}
+	}
+	errs := f.batcher.callBatch(ctx, reqs)
+	for i, h := range headers {
+		if errs[i] == nil && h == nil {
+			errs[i] = fmt.Errorf("block %d not found", from+uint64(i))
+		}
+	}
+	return headers, errs
+}
+
+func (f *logFetcher) processBlock(ctx context.Context, num uint64, header *rpcHeader, logs []types.Log, out chan<- queue.FilteredTx, blockFiltered chan<- queue.BlockFiltered) error {
+	blocksFetched.With().Inc()
+	meta := decodeBlockMeta(f.logger, &rpcBlock{
+		Number:     header.Number,
+		Hash:       header.Hash,
+		ParentHash: header.ParentHash,
+		Timestamp:  header.Timestamp,
+	}, num)
+	ok, gen, err := f.detector.accept(ctx, meta)
+	if err != nil {
+		return fmt.Errorf("block %d reorg check: %w", num, err)
+	}
+	if !ok {
+		return nil
+	}
+	if len(logs) == 0 {
+		return sendBlockFiltered(ctx, blockFiltered, queue.BlockFiltered{BlockNumber: num, BlockHash: meta.hash, Timestamp: meta.timestamp, Generation: gen})
+	}
+
+	hashes := make([]common.Hash, 0, len(logs))
+	seen := map[common.Hash]bool{}
+	for _, l := range logs {
+		if seen[l.TxHash] {
+			continue
+		}
+		seen[l.TxHash] = true
+		if l.BlockHash != meta.hash {
+			// The logs were read from a fork the header is no longer on;
+			// retry the block rather than miss its txs.
+			f.window.forget(num, meta.hash)
+			return fmt.Errorf("log of tx %s is from block hash %s, header has %s", l.TxHash.Hex(), l.BlockHash.Hex(), meta.hash.Hex())
+		}
+		hashes = append(hashes, l.TxHash)
+	}
+
+	txs := make([]rpcTx, len(hashes))
+	reqs := make([]batchRequest, len(hashes))
+	for i, h := range hashes {
+		reqs[i] = batchRequest{method: "eth_getTransactionByHash", args: []interface{}{h}, result: &txs[i]}
+	}
+	for i, err := range f.batcher.callBatch(ctx, reqs) {
+		if err != nil {
+			f.window.forget(num, meta.hash)
+			return fmt.Errorf("tx %s: %w", hashes[i].Hex(), err)
+		}
+	}
+
+	byTx := logsByTx(logs)
+	count := 0
+	for _, tx := range txs {
+		raw, ok := parseRawTx(tx, f.logger, num)
+		if !ok {
+			continue
+		}
+		rules := f.engine.Match(raw, byTx[common.HexToHash(raw.Hash)])
+		if len(rules) == 0 {
+			continue
+		}
+		if !f.window.addTx(num, meta.hash, raw) {
+			continue
+		}
+		count++
+		for _, r := range rules {
+			txsFiltered.With(r).Inc()
+		}
+		item := queue.FilteredTx{
+			BlockNumber:  num,
+			BlockHash:    meta.hash,
+			Timestamp:    meta.timestamp,
+			Generation:   gen,
+			Tx:           raw,
+			MatchedRules: rules,
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- item:
+		}
+	}
+	return sendBlockFiltered(ctx, blockFiltered, queue.BlockFiltered{BlockNumber: num, BlockHash: meta.hash, Timestamp: meta.timestamp, Generation: gen, FilteredCount: count})
+}
+
+// fetchLogs splits the range in half whenever the provider rejects it as too
+// large, and adapts the range size used for the following requests.
+func (f *logFetcher) fetchLogs(ctx context.Context, from, to uint64) ([]types.Log, error) {
+	logs, err := f.filterLogs(ctx, from, to)
+	if err == nil {
+		f.grow()
+		return logs, nil
+	}
+	if to > from && isRangeTooLarge(err) {
+		f.shrink(to - from + 1)
+		f.logger.Debug("log range rejected, splitting", "from", from, "to", to, "next_range", f.rangeSize, "error", err)
+		mid := from + (to-from)/2
+		left, err := f.fetchLogs(ctx, from, mid)
+		if err != nil {
+			return nil, err
+		}
+		right, err := f.fetchLogs(ctx, mid+1, to)
+		if err != nil {
+			return nil, err
+		}
+		return append(left, right...), nil
+	}
+	err = util.Retry(ctx, f.cfg.Performance.RetryMax, f.cfg.Performance.RetryBackoff.Duration, func() error {
+		var ferr error
+		logs, ferr = f.filterLogs(ctx, from, to)
+		return ferr
+	})
+	return logs, err
+}
+
+func (f *logFetcher) filterLogs(ctx context.Context, from, to uint64) ([]types.Log, error) {
+	ctxTimeout, cancel := withTimeout(ctx, f.cfg.Performance.RequestTimeout.Duration)
+	defer cancel()
+	return f.client.FilterLogs(ctxTimeout, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: f.addresses,
+	})
+}
+
+func (f *logFetcher) shrink(failed uint64) {
+	next := failed / 2
+	if next < 1 {
+		next = 1
+	}
+	if next < f.rangeSize {
+		f.rangeSize = next
+	}
+	f.successes = 0
+}
+
+func (f *logFetcher) grow() {
+	if f.rangeSize >= f.maxRange {
+		return
+	}
+	f.successes++
+	if f.successes < 10 {
+		return
+	}
+	f.successes = 0
+	f.rangeSize *= 2
+	if f.rangeSize > f.maxRange {
+		f.rangeSize = f.maxRange
+	}
+}
+
+func isRangeTooLarge(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"range", "too many", "too large", "limit", "exceed", "response size", "more than"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func sendBlockFiltered(ctx context.Context, ch chan<- queue.BlockFiltered, f queue.BlockFiltered) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ch <- f:
+		return nil
+	}
+}
@@ -0,0 +1,291 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/decoder"
+	"pumppilot/internal/filter"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/rpcpool"
+)
+
+const (
+	PendingStatusPending   = "pending"
+	PendingStatusConfirmed = "confirmed"
+	PendingStatusDropped   = "dropped"
+)
+
+// mempoolWatcher follows newPendingTransactions, writes the txs matching the
+// filter rules as pending records and reconciles them with the confirmed
+// output. Pending txs have no logs yet, so rules that need logs never match.
+type mempoolWatcher struct {
+	logger  *slog.Logger
+	cfg     *config.Config
+	pool    *rpcpool.Pool
+	batcher *batchCaller
+	engine  *filter.Engine
+	dec     *decoder.Decoder
+
+	records chan queue.PendingTx
+	hashes  chan string
+
+	mu      sync.Mutex
+	pending map[string]*queue.PendingTx
+}
+
+func newMempoolWatcher(logger *slog.Logger, cfg *config.Config, pool *rpcpool.Pool, batcher *batchCaller, engine *filter.Engine, dec *decoder.Decoder) *mempoolWatcher {
+	return &mempoolWatcher{
+		logger:  logger,
+		cfg:     cfg,
+		pool:    pool,
+		batcher: batcher,
+		engine:  engine,
+		dec:     dec,
+		records: make(chan queue.PendingTx, cfg.Performance.QueueSize),
+		hashes:  make(chan string, cfg.Performance.QueueSize),
+		pending: map[string]*queue.PendingTx{},
+	}
+}
+
+func (m *mempoolWatcher) run(ctx context.Context) error {
+	for i := 0; i < m.cfg.Mempool.LookupConcurrency; i++ {
+		go m.lookupWorker(ctx)
+	}
+	go m.subscribe(ctx)
+	go m.expire(ctx)
+	return writeJSONL(ctx, m.logger, m.cfg.Mempool.OutputPath, m.records)
+}
+
+// confirm resolves the pending record of a tx that reached the confirmed
+// output. A nil watcher ignores the call.
+func (m *mempoolWatcher) confirm(ctx context.Context, rec queue.EnrichedTx) {
+	if m == nil || rec.Reverted {
+		return
+	}
+	m.mu.Lock()
+	p, ok := m.pending[strings.ToLower(rec.TxHash)]
+	if ok {
+		delete(m.pending, strings.ToLower(rec.TxHash))
+	}
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	p.Status = PendingStatusConfirmed
+	p.BlockNumber = rec.BlockNumber
+	p.BlockHash = rec.BlockHash
+	p.Failed = rec.Receipt != nil && rec.Receipt.Status == 0
+	m.emit(ctx, *p)
+}
+
+func (m *mempoolWatcher) subscribe(ctx context.Context) {
+	backoff := 500 * time.Millisecond
+	attempt := 0
+	for ctx.Err() == nil {
+		urls := m.pool.WSURLs()
+		if len(urls) == 0 {
+			m.logger.Warn("no ws endpoints configured, mempool watcher disabled")
+			return
+		}
+		wsURL := urls[attempt%len(urls)]
+		err := m.follow(ctx, wsURL)
+		if ctx.Err() != nil {
+			return
+		}
+		m.logger.Warn("mempool subscription failed", "url", rpcpool.Redact(wsURL), "error", err)
+		m.pool.ReportWS(wsURL, err)
+		attempt++
+		wait(ctx, backoff)
+		backoff = minDuration(backoff*2, 10*time.Second)
+	}
+}
+
+// follow subscribes with full tx objects and falls back to hash
+// notifications when the node rejects the extra parameter. Some nodes ignore
+// it and send hashes anyway, so both shapes are accepted either way.
+func (m *mempoolWatcher) follow(ctx context.Context, wsURL string) error {
+	client, err := rpc.DialWebsocket(ctx, wsURL, "")
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	ch := make(chan json.RawMessage, 256)
+	full := true
+	sub, err := client.EthSubscribe(ctx, ch, "newPendingTransactions", true)
+	if err != nil {
+		full = false
+		sub, err = client.EthSubscribe(ctx, ch, "newPendingTransactions")
+		if err != nil {
+			return err
+		}
+	}
+	defer sub.Unsubscribe()
+	m.logger.Info("ws subscribed to newPendingTransactions", "url", rpcpool.Redact(wsURL), "full_tx", full)
+	m.pool.ReportWS(wsURL, nil)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			if err == nil {
+				err = errors.New("mempool subscription closed")
+			}
+			return err
+		case msg := <-ch:
+			var hash string
+			if json.Unmarshal(msg, &hash) == nil {
+				select {
+				case m.hashes <- hash:
+				default:
+					m.logger.Debug("mempool lookup queue full, tx skipped", "tx", hash)
+				}
+				continue
+			}
+			var tx rpcTx
+			if err := json.Unmarshal(msg, &tx); err != nil {
+				m.logger.Debug("mempool notification decode failed", "error", err)
+				continue
+			}
+			m.handle(ctx, tx)
+		}
+	}
+}
+
+func (m *mempoolWatcher) lookupWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case hash := <-m.hashes:
+			var tx rpcTx
+			if err := m.batcher.Call(ctx, &tx, "eth_getTransactionByHash", hash); err != nil {
+				if !errors.Is(err, ethereum.NotFound) {
+					m.logger.Debug("pending tx lookup failed", "tx", hash, "error", err)
+				}
+				continue
+			}
+			// Already mined; the confirmed pipeline will pick it up.
+			if tx.BlockHash != nil {
+				continue
+			}
+			m.handle(ctx, tx)
+		}
+	}
+}
+
+func (m *mempoolWatcher) handle(ctx context.Context, tx rpcTx) {
+	raw, ok := parseRawTx(tx, m.logger, 0)
+	if !ok {
+		return
+	}
+	rules := m.engine.Match(raw, nil)
+	if len(rules) == 0 {
+		return
+	}
+	rec := &queue.PendingTx{
+		Status:            PendingStatusPending,
+		Chain:             m.cfg.Chain,
+		ChainID:           m.cfg.ChainID,
+		TxHash:            raw.Hash,
+		From:              raw.From,
+		To:                raw.To,
+		Nonce:             raw.Nonce,
+		ValueWei:          raw.ValueWei,
+		Gas:               raw.Gas,
+		GasPriceWei:       raw.GasPriceWei,
+		MaxFeePerGasWei:   raw.MaxFeePerGasWei,
+		MaxPriorityFeeWei: raw.MaxPriorityFeeWei,
+		Type:              raw.Type,
+		Input:             raw.Input,
+		MatchedRules:      rules,
+		SeenAt:            time.Now().UTC(),
+		Errors:            raw.ParseErrors,
+	}
+	if m.cfg.Decoding.DecodeInput && raw.Input != "" {
+		if input, err := hexutil.Decode(raw.Input); err != nil {
+			decodeErrors.With("input").Inc()
+			rec.Errors = append(rec.Errors, "decode_input_hex: "+err.Error())
+		} else if method, err := m.dec.DecodeInput(input); err != nil {
+			decodeErrors.With("input").Inc()
+			rec.Errors = append(rec.Errors, "decode_input: "+err.Error())
+		} else {
+			rec.Method = method
+		}
+	}
+
+	key := strings.ToLower(raw.Hash)
+	m.mu.Lock()
+	if _, seen := m.pending[key]; seen {
+		m.mu.Unlock()
+		return
+	}
+	m.pending[key] = rec
+	out := *rec
+	m.mu.Unlock()
+	m.emit(ctx, out)
+}
+
+// expire checks txs pending for longer than drop_after. Txs the node reports
+// as mined are confirmed from the lookup, the rest are marked dropped.
+func (m *mempoolWatcher) expire(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		deadline := time.Now().Add(-m.cfg.Mempool.DropAfter.Duration)
+		m.mu.Lock()
+		expired := make([]*queue.PendingTx, 0)
+		for key, p := range m.pending {
+			if p.SeenAt.Before(deadline) {
+				expired = append(expired, p)
+				delete(m.pending, key)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, p := range expired {
+			p.Status = PendingStatusDropped
+			var tx rpcTx
+			err := m.batcher.Call(ctx, &tx, "eth_getTransactionByHash", p.TxHash)
+			switch {
+			case err == nil && tx.BlockHash != nil:
+				p.Status = PendingStatusConfirmed
+				p.BlockHash = *tx.BlockHash
+				if tx.BlockNumber != nil {
+					p.BlockNumber, _ = hexutil.DecodeUint64(*tx.BlockNumber)
+				}
+			case err != nil && !errors.Is(err, ethereum.NotFound):
+				p.Errors = append(p.Errors, "drop_check: "+err.Error())
+			}
+			m.emit(ctx, *p)
+		}
+	}
+}
+
+func (m *mempoolWatcher) emit(ctx context.Context, rec queue.PendingTx) {
+	if rec.Status != PendingStatusPending {
+		now := time.Now().UTC()
+		rec.ResolvedAt = &now
+	}
+	mempoolTxs.With(rec.Status).Inc()
+	select {
+	case <-ctx.Done():
+	case m.records <- rec:
+	}
+}
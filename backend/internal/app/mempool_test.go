@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/filter"
+	"pumppilot/internal/queue"
+)
+
+func TestMempoolWatcherReconcilesPendingTx(t *testing.T) {
+	cfg := &config.Config{FactoryAddress: "0x07DFAEC8e182C5eF79844ADc70708C1c15aA60fb"}
+	cfg.Performance.QueueSize = 8
+	engine, err := filter.New(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newMempoolWatcher(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, nil, nil, engine, nil)
+	ctx := context.Background()
+
+	to := "0x07dfaec8e182c5ef79844adc70708c1c15aa60fb"
+	other := "0x1111111111111111111111111111111111111111"
+	m.handle(ctx, rpcTx{Hash: "0xAA", To: &other, Value: "0x0"})
+	m.handle(ctx, rpcTx{Hash: "0xBB", To: &to, Value: "0x1"})
+	m.handle(ctx, rpcTx{Hash: "0xbb", To: &to, Value: "0x1"})
+	if len(m.records) != 1 {
+		t.Fatalf("want 1 pending record, got %d", len(m.records))
+	}
+	rec := <-m.records
+	if rec.Status != PendingStatusPending || rec.TxHash != "0xBB" || rec.MatchedRules[0] != filter.DefaultRule {
+		t.Fatalf("unexpected pending record %+v", rec)
+	}
+
+	m.confirm(ctx, queue.EnrichedTx{TxHash: "0xbb", BlockNumber: 7, Receipt: &queue.ReceiptInfo{Status: 0}})
+	rec = <-m.records
+	if rec.Status != PendingStatusConfirmed || rec.BlockNumber != 7 || !rec.Failed || rec.ResolvedAt == nil {
+		t.Fatalf("unexpected confirmed record %+v", rec)
+	}
+	m.confirm(ctx, queue.EnrichedTx{TxHash: "0xbb", BlockNumber: 7})
+	if len(m.records) != 0 {
+		t.Fatal("tx confirmed twice")
+	}
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"pumppilot/internal/metrics"
+)
+
+var (
+	blocksFetched   = metrics.NewCounter("pumppilot_blocks_fetched_total", "Blocks fetched from the node.")
+	txsFiltered     = metrics.NewCounter("pumppilot_txs_filtered_total", "Txs that matched a filter rule.", "rule")
+	receiptsFetched = metrics.NewCounter("pumppilot_receipts_fetched_total", "Receipt lookups by result.", "result")
+	decodeErrors    = metrics.NewCounter("pumppilot_decode_errors_total", "Input and log decode failures.", "kind")
+	recordsWritten  = metrics.NewCounter("pumppilot_records_written_total", "Records written per output file.", "output")
+	mempoolTxs      = metrics.NewCounter("pumppilot_mempool_txs_total", "Mempool records by status.", "status")
+	sinkRecords     = metrics.NewCounter("pumppilot_sink_records_total", "Records per output sink by result.", "sink", "result")
+
+	headBlock      = metrics.NewGauge("pumppilot_head_block", "Latest head seen.")
+	processedBlock = metrics.NewGauge("pumppilot_processed_block", "Block the main checkpoint is at.")
+	lagBlocks      = metrics.NewGauge("pumppilot_lag_blocks", "Blocks between the checkpoint and the head the reader may read.")
+	lagSeconds     = metrics.NewGauge("pumppilot_lag_seconds", "Age of the last processed block.")
+	queueLength    = metrics.NewGauge("pumppilot_queue_length", "Items waiting in a pipeline queue.", "queue")
+	queueCapacity  = metrics.NewGauge("pumppilot_queue_capacity", "Capacity of a pipeline queue.", "queue")
+	deadLetters    = metrics.NewGauge("pumppilot_dead_letter_blocks", "Blocks in the dead-letter queue.", "state")
+	watchdogAlerts = metrics.NewGauge("pumppilot_watchdog_alerts", "Active watchdog alerts.", "kind")
+)
+
+// collectStatus copies the pipeline status into the gauges on every scrape.
+func collectStatus(status *pipelineStatus) func() {
+	return func() {
+		st := status.snapshot()
+		headBlock.With().Set(float64(st.Head))
+		processedBlock.With().Set(float64(st.ProcessedBlock))
+		lagBlocks.With().Set(float64(st.LagBlocks))
+		lagSeconds.With().Set(st.LagSeconds)
+		for _, q := range st.Queues {
+			queueLength.With(q.Name).Set(float64(q.Len))
+			queueCapacity.With(q.Name).Set(float64(q.Cap))
+		}
+		var pending, abandoned int
+		for _, dl := range st.DeadLetters {
+			if dl.Abandoned {
+				abandoned++
+			} else {
+				pending++
+			}
+		}
+		deadLetters.With("pending").Set(float64(pending))
+		deadLetters.With("abandoned").Set(float64(abandoned))
+		watchdogAlerts.Reset()
+		for _, a := range st.Alerts {
+			watchdogAlerts.With(a.Kind).Set(1)
+		}
+	}
+}
@@ -10,17 +10,17 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 	"log/slog"
 
-	"pumppilot/internal/checkpoint"
 	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/rpcpool"
 )
 
-func runReader(ctx context.Context, logger *slog.Logger, httpClient *ethclient.Client, cfg *config.Config, cp *checkpoint.Store, out chan<- uint64) error {
-	lastProcessed := cp.Last()
-
+func runReader(ctx context.Context, logger *slog.Logger, httpClient *ethclient.Client, pool *rpcpool.Pool, cfg *config.Config, lastProcessed uint64, status *pipelineStatus, out chan<- uint64, rewind <-chan queue.Rewind, reconnect <-chan struct{}) error {
 	head, err := fetchHead(ctx, httpClient, cfg)
 	if err != nil {
 		return err
 	}
+	status.setHead(head)
 
 	startBlock, startLatest, err := cfg.StartBlockNumber()
 	if err != nil {
@@ -32,8 +32,8 @@ func runReader(ctx context.Context, logger *slog.Logger, httpClient *ethclient.C
 	}
 
 	if startLatest {
-		if head > cfg.Ingestion.Confirmations {
-			startBlock = head - cfg.Ingestion.Confirmations
+		if head > cfg.ReadDelay() {
+			startBlock = head - cfg.ReadDelay()
 		} else {
 			startBlock = 0
 		}
@@ -50,29 +50,40 @@ func runReader(ctx context.Context, logger *slog.Logger, httpClient *ethclient.C
 		"head", head,
 		"start_block", startBlock,
 		"confirmations", cfg.Ingestion.Confirmations,
+		"head_tier", cfg.Tiers.Head,
 		"reorg_replay_depth", cfg.Ingestion.ReorgReplayDepth,
 	)
 
 	headCh := make(chan uint64, 4)
 	go pollHeads(ctx, logger, httpClient, cfg, headCh)
-	go subscribeHeads(ctx, logger, cfg.RPC.WS, headCh)
+	go subscribeHeads(ctx, logger, pool, headCh, reconnect)
 
 	nextBlock := startBlock
 	currentHead := head
 
+	rewindTo := func(fork uint64) {
+		if fork+1 < nextBlock {
+			logger.Warn("reader rewound", "next_block", fork+1, "previous", nextBlock)
+			nextBlock = fork + 1
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return context.Canceled
+		case r := <-rewind:
+			rewindTo(r.Fork)
 		case h := <-headCh:
 			if h > currentHead {
 				currentHead = h
+				status.setHead(h)
 			}
 		default:
 			// no new head, just fall through
 		}
 
-		ready := int64(currentHead) - int64(cfg.Ingestion.Confirmations)
+		ready := int64(currentHead) - int64(cfg.ReadDelay())
 		if ready < 0 {
 			ready = 0
 		}
@@ -80,6 +91,8 @@ func runReader(ctx context.Context, logger *slog.Logger, httpClient *ethclient.C
 			select {
 			case <-ctx.Done():
 				return context.Canceled
+			case r := <-rewind:
+				rewindTo(r.Fork)
 			case out <- nextBlock:
 				nextBlock++
 			}
@@ -124,31 +137,45 @@ func pollHeads(ctx context.Context, logger *slog.Logger, client *ethclient.Clien
 	}
 }
 
-func subscribeHeads(ctx context.Context, logger *slog.Logger, wsURL string, out chan<- uint64) {
+func subscribeHeads(ctx context.Context, logger *slog.Logger, pool *rpcpool.Pool, out chan<- uint64, reconnect <-chan struct{}) {
 	backoff := 500 * time.Millisecond
+	attempt := 0
 	for {
 		if ctx.Err() != nil {
 			return
 		}
-		rpcClient, err := rpc.DialWebsocket(ctx, wsURL, "")
-		if err != nil {
-			logger.Warn("ws dial failed", "error", err)
+		urls := pool.WSURLs()
+		if len(urls) == 0 {
+			logger.Warn("no ws endpoints configured, relying on polling")
+			return
+		}
+		wsURL := urls[attempt%len(urls)]
+		retry := func(err error) {
+			pool.ReportWS(wsURL, err)
+			attempt++
 			wait(ctx, backoff)
 			backoff = minDuration(backoff*2, 10*time.Second)
+		}
+
+		rpcClient, err := rpc.DialWebsocket(ctx, wsURL, "")
+		if err != nil {
+			logger.Warn("ws dial failed", "url", rpcpool.Redact(wsURL), "error", err)
+			retry(err)
 			continue
 		}
 		client := ethclient.NewClient(rpcClient)
 		headers := make(chan *types.Header, 16)
 		sub, err := client.SubscribeNewHead(ctx, headers)
 		if err != nil {
-			logger.Warn("ws subscribe failed", "error", err)
+			logger.Warn("ws subscribe failed", "url", rpcpool.Redact(wsURL), "error", err)
 			client.Close()
-			wait(ctx, backoff)
-			backoff = minDuration(backoff*2, 10*time.Second)
+			retry(err)
 			continue
 		}
-		logger.Info("ws subscribed to newHeads")
+		logger.Info("ws subscribed to newHeads", "url", rpcpool.Redact(wsURL))
+		pool.ReportWS(wsURL, nil)
 		backoff = 500 * time.Millisecond
+		attempt = 0
 
 		for {
 			select {
@@ -158,12 +185,20 @@ func subscribeHeads(ctx context.Context, logger *slog.Logger, wsURL string, out
 				return
 			case err := <-sub.Err():
 				if err != nil && !errors.Is(err, context.Canceled) {
-					logger.Warn("ws subscription error", "error", err)
+					logger.Warn("ws subscription error", "url", rpcpool.Redact(wsURL), "error", err)
 				}
 				sub.Unsubscribe()
 				client.Close()
-				wait(ctx, backoff)
-				backoff = minDuration(backoff*2, 10*time.Second)
+				if err == nil {
+					err = errors.New("ws subscription closed")
+				}
+				retry(err)
+				goto reconnect
+			case <-reconnect:
+				logger.Warn("ws reconnect forced", "url", rpcpool.Redact(wsURL))
+				sub.Unsubscribe()
+				client.Close()
+				retry(errors.New("ws reconnect forced"))
 				goto reconnect
 			case h := <-headers:
 				if h == nil {
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log/slog"
+
+	"pumppilot/internal/config"
+)
+
+const receiptCacheBlocks = 32
+
+type blockReceipts struct {
+	ready chan struct{}
+	byTx  map[common.Hash]*types.Receipt
+	err   error
+}
+
+// receiptFetcher loads receipts either one tx at a time through the batch
+// caller or, with block_receipts enabled, a whole block at a time through
+// eth_getBlockReceipts. It falls back to per-tx calls when the provider does
+// not support the block method.
+type receiptFetcher struct {
+	logger  *slog.Logger
+	batcher *batchCaller
+	byBlock bool
+
+	mu          sync.Mutex
+	unsupported bool
+	blocks      map[common.Hash]*blockReceipts
+	order       []common.Hash
+}
+
+func newReceiptFetcher(logger *slog.Logger, batcher *batchCaller, cfg *config.Config) *receiptFetcher {
+	return &receiptFetcher{
+		logger:  logger,
+		batcher: batcher,
+		byBlock: cfg.Performance.BlockReceipts,
+		blocks:  map[common.Hash]*blockReceipts{},
+	}
+}
+
+func (f *receiptFetcher) fetch(ctx context.Context, blockHash, txHash common.Hash) (*types.Receipt, error) {
+	if f.useBlockReceipts() && blockHash != (common.Hash{}) {
+		receipt, err := f.fromBlock(ctx, blockHash, txHash)
+		if err == nil && receipt != nil {
+			return receipt, nil
+		}
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+		if err != nil && !isMethodUnsupported(err) {
+			f.logger.Debug("block receipts failed, fetching tx receipt", "block_hash", blockHash.Hex(), "tx", txHash.Hex(), "error", err)
+		}
+	}
+	var receipt types.Receipt
+	if err := f.batcher.Call(ctx, &receipt, "eth_getTransactionReceipt", txHash); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+func (f *receiptFetcher) useBlockReceipts() bool {
+	if !f.byBlock {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.unsupported
+}
+
+func (f *receiptFetcher) fromBlock(ctx context.Context, blockHash, txHash common.Hash) (*types.Receipt, error) {
+	f.mu.Lock()
+	entry, ok := f.blocks[blockHash]
+	if !ok {
+		entry = &blockReceipts{ready: make(chan struct{})}
+		f.blocks[blockHash] = entry
+		f.order = append(f.order, blockHash)
+		if len(f.order) > receiptCacheBlocks {
+			delete(f.blocks, f.order[0])
+			f.order = f.order[1:]
+		}
+	}
+	f.mu.Unlock()
+
+	if ok {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-entry.ready:
+		}
+		return entry.byTx[txHash], entry.err
+	}
+
+	var receipts []*types.Receipt
+	err := f.batcher.Call(ctx, &receipts, "eth_getBlockReceipts", blockHash)
+	if err != nil {
+		entry.err = err
+		f.mu.Lock()
+		if isMethodUnsupported(err) && !f.unsupported {
+			f.unsupported = true
+			f.logger.Warn("eth_getBlockReceipts not supported, using per-tx receipts", "error", err)
+		}
+		// Don't cache failures; the next tx of the block tries again.
+		if f.blocks[blockHash] == entry {
+			delete(f.blocks, blockHash)
+		}
+		f.mu.Unlock()
+	} else {
+		entry.byTx = make(map[common.Hash]*types.Receipt, len(receipts))
+		for _, r := range receipts {
+			if r != nil {
+				entry.byTx[r.TxHash] = r
+			}
+		}
+	}
+	close(entry.ready)
+	return entry.byTx[txHash], entry.err
+}
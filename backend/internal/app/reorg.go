@@ -0,0 +1,360 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"log/slog"
+
+	"pumppilot/internal/checkpoint"
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/util"
+)
+
+type linkResult int
+
+const (
+	linkOK linkResult = iota
+	linkDuplicate
+	linkConflict
+)
+
+type windowBlock struct {
+	number    uint64
+	hash      common.Hash
+	parent    common.Hash
+	timestamp uint64
+	txs       []*queue.RawTx
+	seeded    bool
+}
+
+// chainWindow keeps the hashes of the most recently fetched blocks so that
+// a block which does not chain onto its stored neighbours can be detected.
+type chainWindow struct {
+	mu     sync.Mutex
+	size   uint64
+	high   uint64
+	blocks map[uint64]*windowBlock
+}
+
+func newChainWindow(size uint64) *chainWindow {
+	if size < 2 {
+		size = 2
+	}
+	return &chainWindow{size: size, blocks: map[uint64]*windowBlock{}}
+}
+
+func (w *chainWindow) link(number uint64, hash, parent common.Hash, timestamp uint64) linkResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e := w.blocks[number]; e != nil {
+		if e.hash != hash {
+			return linkConflict
+		}
+		if !e.seeded {
+			return linkDuplicate
+		}
+	}
+	if number > 0 {
+		if p := w.blocks[number-1]; p != nil && p.hash != parent {
+			return linkConflict
+		}
+	}
+	if c := w.blocks[number+1]; c != nil && c.parent != (common.Hash{}) && c.parent != hash {
+		return linkConflict
+	}
+	w.blocks[number] = &windowBlock{number: number, hash: hash, parent: parent, timestamp: timestamp}
+	if number > w.high {
+		w.high = number
+	}
+	w.prune()
+	return linkOK
+}
+
+// forget removes a linked block whose processing failed before any of its
+// txs were emitted, so that a retry is not mistaken for a duplicate.
+func (w *chainWindow) forget(number uint64, hash common.Hash) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e := w.blocks[number]; e != nil && e.hash == hash && len(e.txs) == 0 {
+		delete(w.blocks, number)
+	}
+}
+
+// seed loads block hashes persisted by a previous run so that a reorg which
+// happened while the process was down is detected during the startup replay.
+func (w *chainWindow) seed(refs []checkpoint.BlockRef) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, r := range refs {
+		if r.Hash == "" {
+			continue
+		}
+		w.blocks[r.Number] = &windowBlock{number: r.Number, hash: common.HexToHash(r.Hash), seeded: true}
+		if r.Number > w.high {
+			w.high = r.Number
+		}
+	}
+	w.prune()
+}
+
+// addTx attaches an emitted tx to its block. It returns false when the block
+// has been dropped by a reorg in the meantime and the tx must not be emitted.
+func (w *chainWindow) addTx(number uint64, hash common.Hash, tx *queue.RawTx) bool {
+	if w == nil {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e := w.blocks[number]
+	if e == nil {
+		return number < w.floor()
+	}
+	if e.hash != hash {
+		return false
+	}
+	e.txs = append(e.txs, tx)
+	return true
+}
+
+// dropAbove removes every block above fork and returns them in block order.
+func (w *chainWindow) dropAbove(fork uint64) []*windowBlock {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dropped := make([]*windowBlock, 0)
+	for n, e := range w.blocks {
+		if n > fork {
+			dropped = append(dropped, e)
+			delete(w.blocks, n)
+		}
+	}
+	sort.Slice(dropped, func(i, j int) bool { return dropped[i].number < dropped[j].number })
+	if w.high > fork {
+		w.high = fork
+	}
+	return dropped
+}
+
+// descending returns the stored block refs from highest to lowest.
+func (w *chainWindow) descending() []queue.BlockRef {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]queue.BlockRef, 0, len(w.blocks))
+	for n, e := range w.blocks {
+		out = append(out, queue.BlockRef{Number: n, Hash: e.hash})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Number > out[j].Number })
+	return out
+}
+
+func (w *chainWindow) floor() uint64 {
+	if w.high < w.size {
+		return 0
+	}
+	return w.high - w.size + 1
+}
+
+func (w *chainWindow) prune() {
+	floor := w.floor()
+	for n := range w.blocks {
+		if n < floor {
+			delete(w.blocks, n)
+		}
+	}
+}
+
+type rpcHeader struct {
+	Number     string `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// reorgDetector links fetched blocks into the chain window and, when a block
+// does not chain, rewinds the pipeline to the fork point and retracts the
+// txs that were emitted from the orphaned blocks.
+type reorgDetector struct {
+	logger   *slog.Logger
+	rpc      *rpc.Client
+	cfg      *config.Config
+	window   *chainWindow
+	reverted chan<- queue.EnrichedTx
+	rewinds  []chan<- queue.Rewind
+	mu       sync.Mutex
+	gen      uint64
+
+	// emit orders the enrich stage's sends against reverts: rewinds are
+	// recorded under the write lock, sends check them under the read lock.
+	emit    sync.RWMutex
+	rewound rewindLog
+}
+
+func newReorgDetector(logger *slog.Logger, rpcClient *rpc.Client, cfg *config.Config, window *chainWindow, reverted chan<- queue.EnrichedTx, rewinds ...chan<- queue.Rewind) *reorgDetector {
+	return &reorgDetector{
+		logger:   logger,
+		rpc:      rpcClient,
+		cfg:      cfg,
+		window:   window,
+		reverted: reverted,
+		rewinds:  rewinds,
+	}
+}
+
+// accept reports whether the block should be pushed downstream, and the
+// generation its items carry. A nil detector accepts every block.
+func (d *reorgDetector) accept(ctx context.Context, meta blockMeta) (bool, uint64, error) {
+	if d == nil {
+		return true, 0, nil
+	}
+	d.mu.Lock()
+	switch d.window.link(meta.number, meta.hash, meta.parent, meta.timestamp) {
+	case linkOK:
+		gen := d.gen
+		d.mu.Unlock()
+		return true, gen, nil
+	case linkDuplicate:
+		d.mu.Unlock()
+		d.logger.Debug("block already processed", "block", meta.number, "hash", meta.hash.Hex())
+		return false, 0, nil
+	}
+
+	fork, err := d.findForkPoint(ctx)
+	if err != nil {
+		d.mu.Unlock()
+		return false, 0, err
+	}
+	if meta.number > 0 && fork >= meta.number {
+		fork = meta.number - 1
+	}
+	dropped := d.window.dropAbove(fork)
+	// Blocks linked from now on, including ones that were queued before the
+	// rewind, belong to the new generation. The tracker keeps them even if
+	// they reach it before the rewind does; a re-sent number is then a
+	// duplicate of work it still has.
+	d.gen++
+	rewind := queue.Rewind{Fork: fork, Generation: d.gen}
+	d.emit.Lock()
+	d.rewound.add(rewind)
+	d.emit.Unlock()
+	d.mu.Unlock()
+
+	txCount := 0
+	for _, b := range dropped {
+		txCount += len(b.txs)
+	}
+	d.logger.Warn("reorg detected",
+		"block", meta.number,
+		"hash", meta.hash.Hex(),
+		"fork_block", fork,
+		"dropped_blocks", len(dropped),
+		"dropped_txs", txCount,
+	)
+
+	for _, b := range dropped {
+		for _, tx := range b.txs {
+			rec := revertedRecord(d.cfg, b, tx, fork)
+			select {
+			case <-ctx.Done():
+				return false, 0, ctx.Err()
+			case d.reverted <- rec:
+			}
+		}
+	}
+	for _, ch := range d.rewinds {
+		select {
+		case <-ctx.Done():
+			return false, 0, ctx.Err()
+		case ch <- rewind:
+		}
+	}
+	return false, 0, nil
+}
+
+// send passes rec on unless a rewind since generation gen orphaned its
+// block. Without ordered output nothing downstream drops such records, so
+// an original is either sent before the revert of its block or not at all.
+func (d *reorgDetector) send(ctx context.Context, out chan<- queue.EnrichedTx, rec queue.EnrichedTx, gen uint64) error {
+	if d == nil {
+		return send(ctx, out, rec)
+	}
+	d.emit.RLock()
+	defer d.emit.RUnlock()
+	if d.rewound.stale(rec.BlockNumber, gen) {
+		d.logger.Debug("dropping record of orphaned block", "block", rec.BlockNumber, "tx", rec.TxHash)
+		return nil
+	}
+	return send(ctx, out, rec)
+}
+
+func (d *reorgDetector) findForkPoint(ctx context.Context) (uint64, error) {
+	refs := d.window.descending()
+	for _, ref := range refs {
+		canonical, err := fetchBlockHash(ctx, d.rpc, d.cfg, ref.Number)
+		if err != nil {
+			return 0, err
+		}
+		if canonical == ref.Hash {
+			return ref.Number, nil
+		}
+	}
+	if len(refs) == 0 {
+		return 0, nil
+	}
+	lowest := refs[len(refs)-1].Number
+	d.logger.Error("reorg deeper than window", "lowest_block", lowest, "window", d.cfg.Ingestion.ReorgWindow)
+	if lowest == 0 {
+		return 0, nil
+	}
+	return lowest - 1, nil
+}
+
+func revertedRecord(cfg *config.Config, b *windowBlock, tx *queue.RawTx, fork uint64) queue.EnrichedTx {
+	return queue.EnrichedTx{
+		Chain:          cfg.Chain,
+		ChainID:        cfg.ChainID,
+		BlockNumber:    b.number,
+		BlockHash:      b.hash.Hex(),
+		BlockTimestamp: b.timestamp,
+		TxHash:         tx.Hash,
+		From:           tx.From,
+		To:             tx.To,
+		Nonce:          tx.Nonce,
+		ValueWei:       tx.ValueWei,
+		Reverted:       true,
+		Meta:           map[string]string{"reorg_fork_block": strconv.FormatUint(fork, 10)},
+	}
+}
+
+func fetchBlockHash(ctx context.Context, rpcClient *rpc.Client, cfg *config.Config, num uint64) (common.Hash, error) {
+	header, err := fetchHeaderWithRetry(ctx, rpcClient, cfg, num)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.HexToHash(header.Hash), nil
+}
+
+func fetchHeaderWithRetry(ctx context.Context, rpcClient *rpc.Client, cfg *config.Config, num uint64) (*rpcHeader, error) {
+	var header *rpcHeader
+	err := util.Retry(ctx, cfg.Performance.RetryMax, cfg.Performance.RetryBackoff.Duration, func() error {
+		ctxTimeout, cancel := withTimeout(ctx, cfg.Performance.RequestTimeout.Duration)
+		defer cancel()
+		if err := rpcClient.CallContext(ctxTimeout, &header, "eth_getBlockByNumber", hexutil.EncodeUint64(num), false); err != nil {
+			return err
+		}
+		if header == nil {
+			return fmt.Errorf("block %d not found", num)
+		}
+		return nil
+	})
+	return header, err
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+func TestChainWindowLink(t *testing.T) {
+	w := newChainWindow(16)
+	h := func(b byte) common.Hash { return common.BytesToHash([]byte{b}) }
+
+	if got := w.link(10, h(10), h(9), 0); got != linkOK {
+		t.Fatalf("link 10: got %v", got)
+	}
+	if got := w.link(12, h(12), h(11), 0); got != linkOK {
+		t.Fatalf("link 12: got %v", got)
+	}
+	if got := w.link(11, h(11), h(10), 0); got != linkOK {
+		t.Fatalf("link 11: got %v", got)
+	}
+	if got := w.link(11, h(11), h(10), 0); got != linkDuplicate {
+		t.Fatalf("relink 11: got %v", got)
+	}
+	if got := w.link(13, h(99), h(98), 0); got != linkConflict {
+		t.Fatalf("link 13 with wrong parent: got %v", got)
+	}
+	if got := w.link(11, h(77), h(10), 0); got != linkConflict {
+		t.Fatalf("link 11 with new hash: got %v", got)
+	}
+}
+
+func TestChainWindowDropAbove(t *testing.T) {
+	w := newChainWindow(16)
+	h := func(b byte) common.Hash { return common.BytesToHash([]byte{b}) }
+	for n := uint64(1); n <= 5; n++ {
+		w.link(n, h(byte(n)), h(byte(n-1)), 0)
+	}
+	if !w.addTx(4, h(4), &queue.RawTx{Hash: "0x04"}) {
+		t.Fatalf("addTx on canonical block rejected")
+	}
+	if w.addTx(4, h(44), &queue.RawTx{Hash: "0x44"}) {
+		t.Fatalf("addTx with stale hash accepted")
+	}
+
+	dropped := w.dropAbove(3)
+	if len(dropped) != 2 || dropped[0].number != 4 || dropped[1].number != 5 {
+		t.Fatalf("unexpected dropped blocks: %+v", dropped)
+	}
+	if len(dropped[0].txs) != 1 || dropped[0].txs[0].Hash != "0x04" {
+		t.Fatalf("dropped block lost its txs: %+v", dropped[0].txs)
+	}
+	if w.addTx(5, h(5), &queue.RawTx{Hash: "0x05"}) {
+		t.Fatalf("addTx on dropped block accepted")
+	}
+	if got := w.link(4, h(40), h(3), 0); got != linkOK {
+		t.Fatalf("link replacement block: got %v", got)
+	}
+}
+
+func TestChainWindowPrune(t *testing.T) {
+	w := newChainWindow(4)
+	h := func(b byte) common.Hash { return common.BytesToHash([]byte{b}) }
+	for n := uint64(1); n <= 10; n++ {
+		w.link(n, h(byte(n)), h(byte(n-1)), 0)
+	}
+	refs := w.descending()
+	if len(refs) != 4 || refs[0].Number != 10 || refs[3].Number != 7 {
+		t.Fatalf("unexpected window: %+v", refs)
+	}
+	if !w.addTx(2, h(2), &queue.RawTx{Hash: "0x02"}) {
+		t.Fatalf("addTx below window floor rejected")
+	}
+}
+
+// fakeChain serves block hashes and holds receipt calls until released.
+type fakeChain struct {
+	hashes   map[uint64]common.Hash
+	fetching chan struct{}
+	release  chan struct{}
+}
+
+func (c *fakeChain) GetBlockByNumber(n hexutil.Uint64, full bool) (map[string]string, error) {
+	return map[string]string{
+		"number":     hexutil.EncodeUint64(uint64(n)),
+		"hash":       c.hashes[uint64(n)].Hex(),
+		"parentHash": c.hashes[uint64(n)-1].Hex(),
+		"timestamp":  "0x0",
+	}, nil
+}
+
+func (c *fakeChain) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]string, error) {
+	c.fetching <- struct{}{}
+	<-c.release
+	return nil, errors.New("unavailable")
+}
+
+func TestReorgDropsOriginalStillInFlight(t *testing.T) {
+	h := func(b byte) common.Hash { return common.BytesToHash([]byte{b}) }
+	chain := &fakeChain{
+		hashes:   map[uint64]common.Hash{0: h(0), 1: h(1), 2: h(2), 3: h(0x33)},
+		fetching: make(chan struct{}, 1),
+		release:  make(chan struct{}),
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", chain); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(srv)
+	defer client.Close()
+
+	cfg := &config.Config{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	window := newChainWindow(16)
+	for n := uint64(1); n <= 3; n++ {
+		window.link(n, h(byte(n)), h(byte(n-1)), 0)
+	}
+	tx := &queue.RawTx{Hash: "0x03"}
+	window.addTx(3, h(3), tx)
+
+	// Unordered output: the enricher writes straight to out.
+	out := make(chan queue.EnrichedTx, 4)
+	rewind := make(chan queue.Rewind, 1)
+	detector := newReorgDetector(logger, client, cfg, window, out, rewind)
+	receipts := newReceiptFetcher(logger, newBatchCaller(logger, client, cfg), cfg)
+	in := make(chan queue.FilteredTx, 1)
+	ack := make(chan queue.BlockRef, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go enrichWorker(ctx, logger, receipts, cfg, nil, nil, detector, in, out, ack, 0)
+
+	in <- queue.FilteredTx{BlockNumber: 3, BlockHash: h(3), Tx: tx}
+	<-chain.fetching
+	ok, _, err := detector.accept(ctx, blockMeta{number: 3, hash: h(0x33), parent: h(2)})
+	if err != nil || ok {
+		t.Fatalf("accept = %v, %v; want a reorg", ok, err)
+	}
+	if r := <-rewind; r.Fork != 2 {
+		t.Fatalf("rewound to %d, want 2", r.Fork)
+	}
+	close(chain.release)
+
+	if rec := <-out; !rec.Reverted || rec.TxHash != "0x03" {
+		t.Fatalf("first record %+v, want the revert of 0x03", rec)
+	}
+	select {
+	case <-ack:
+	case <-time.After(2 * time.Second):
+		t.Fatal("original not acked")
+	}
+	select {
+	case rec := <-out:
+		t.Fatalf("orphaned original written after its revert: %+v", rec)
+	default:
+	}
+}
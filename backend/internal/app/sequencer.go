@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sort"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+// sequencer holds enriched records until the tracker reports their block
+// done and releases them in (block, tx index) order, optionally followed by
+// a block complete marker.
+type sequencer struct {
+	logger *slog.Logger
+	cfg    *config.Config
+	held   map[uint64][]queue.EnrichedTx
+	// released is the last block whose records were all sent on. Blocks at
+	// or below it are only seen again during the startup replay, and their
+	// records pass through unordered.
+	released atomic.Uint64
+}
+
+func newSequencer(logger *slog.Logger, cfg *config.Config, released uint64) *sequencer {
+	s := &sequencer{logger: logger, cfg: cfg, held: map[uint64][]queue.EnrichedTx{}}
+	s.released.Store(released)
+	return s
+}
+
+// Last reports the released block, so that the confirmer can stand in for
+// the main checkpoint behind the sequencer.
+func (s *sequencer) Last() uint64 {
+	return s.released.Load()
+}
+
+func (s *sequencer) run(ctx context.Context, in <-chan queue.EnrichedTx, done <-chan queue.BlockDone, out chan<- queue.EnrichedTx) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case rec := <-in:
+			if err := s.handle(ctx, rec, out); err != nil {
+				return err
+			}
+		case b := <-done:
+			// The records of b were queued before the block was acked, so
+			// they are either held already or still buffered in in.
+			for drained := false; !drained; {
+				select {
+				case rec := <-in:
+					if err := s.handle(ctx, rec, out); err != nil {
+						return err
+					}
+				default:
+					drained = true
+				}
+			}
+			if err := s.release(ctx, b, out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *sequencer) handle(ctx context.Context, rec queue.EnrichedTx, out chan<- queue.EnrichedTx) error {
+	if rec.BlockNumber <= s.Last() {
+		if rec.Reverted {
+			s.released.Store(rec.BlockNumber - 1)
+		}
+		return send(ctx, out, rec)
+	}
+	if rec.Reverted {
+		// The record it retracts was never written; drop both.
+		held := s.held[rec.BlockNumber]
+		kept := held[:0]
+		for _, h := range held {
+			if h.TxHash != rec.TxHash || h.BlockHash != rec.BlockHash {
+				kept = append(kept, h)
+			}
+		}
+		s.held[rec.BlockNumber] = kept
+		return nil
+	}
+	s.held[rec.BlockNumber] = append(s.held[rec.BlockNumber], rec)
+	return nil
+}
+
+func (s *sequencer) release(ctx context.Context, b queue.BlockDone, out chan<- queue.EnrichedTx) error {
+	records := make([]queue.EnrichedTx, 0, len(s.held[b.Number]))
+	for _, rec := range s.held[b.Number] {
+		// Records of an orphaned version of the block that were still
+		// being enriched when the reorg was handled.
+		if b.Hash != (common.Hash{}) && rec.BlockHash != b.Hash.Hex() {
+			continue
+		}
+		records = append(records, rec)
+	}
+	for n := range s.held {
+		if n <= b.Number {
+			delete(s.held, n)
+		}
+	}
+	if len(records) != b.TxCount {
+		s.logger.Warn("ordered block record count mismatch", "block", b.Number, "records", len(records), "expected", b.TxCount)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return txIndex(records[i]) < txIndex(records[j]) })
+	for _, rec := range records {
+		if err := send(ctx, out, rec); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Output.BlockMarkers {
+		if err := send(ctx, out, s.marker(b, len(records))); err != nil {
+			return err
+		}
+	}
+	s.released.Store(b.Number)
+	return nil
+}
+
+func (s *sequencer) marker(b queue.BlockDone, count int) queue.EnrichedTx {
+	return queue.EnrichedTx{
+		Chain:          s.cfg.Chain,
+		ChainID:        s.cfg.ChainID,
+		BlockNumber:    b.Number,
+		BlockHash:      b.Hash.Hex(),
+		BlockTimestamp: b.Timestamp,
+		Marker: &queue.BlockComplete{
+			Type:           queue.TypeBlockComplete,
+			Chain:          s.cfg.Chain,
+			ChainID:        s.cfg.ChainID,
+			BlockNumber:    b.Number,
+			BlockHash:      b.Hash.Hex(),
+			BlockTimestamp: b.Timestamp,
+			TxCount:        count,
+		},
+	}
+}
+
+// txIndex sorts records without a receipt after the rest of their block.
+func txIndex(rec queue.EnrichedTx) uint64 {
+	if rec.Receipt == nil {
+		return math.MaxUint64
+	}
+	return uint64(rec.Receipt.TxIndex)
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+func TestSequencerReleasesBlocksInOrder(t *testing.T) {
+	cfg := &config.Config{Chain: "base", ChainID: 8453}
+	cfg.Output.Ordered = true
+	cfg.Output.BlockMarkers = true
+	s := newSequencer(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, 9)
+	ctx := context.Background()
+	out := make(chan queue.EnrichedTx, 16)
+	hash := common.HexToHash("0xa")
+
+	for _, rec := range []queue.EnrichedTx{
+		{BlockNumber: 10, BlockHash: hash.Hex(), TxHash: "0x3", Receipt: &queue.ReceiptInfo{TxIndex: 3}},
+		{BlockNumber: 10, BlockHash: hash.Hex(), TxHash: "0x9"},
+		{BlockNumber: 10, BlockHash: hash.Hex(), TxHash: "0x1", Receipt: &queue.ReceiptInfo{TxIndex: 1}},
+		{BlockNumber: 10, BlockHash: "0xorphan", TxHash: "0x5", Receipt: &queue.ReceiptInfo{TxIndex: 0}},
+		{BlockNumber: 9, BlockHash: "0xb", TxHash: "0x0"},
+	} {
+		if err := s.handle(ctx, rec, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(out) != 1 || (<-out).TxHash != "0x0" {
+		t.Fatal("replayed record should pass through")
+	}
+
+	if err := s.release(ctx, queue.BlockDone{Number: 10, Hash: hash, TxCount: 3}, out); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for len(out) > 0 {
+		rec := <-out
+		if rec.Marker != nil {
+			got = append(got, rec.Marker.Type)
+			continue
+		}
+		got = append(got, rec.TxHash)
+	}
+	if strings.Join(got, ",") != "0x1,0x3,0x9,"+queue.TypeBlockComplete {
+		t.Fatalf("released %v", got)
+	}
+	if s.Last() != 10 {
+		t.Fatalf("released up to %d, want 10", s.Last())
+	}
+
+	line, err := json.Marshal(s.marker(queue.BlockDone{Number: 11, Hash: hash}, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(line), `"type":"block_complete"`) || strings.Contains(string(line), "tx_hash") {
+		t.Fatalf("unexpected marker line %s", line)
+	}
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/index"
+	"pumppilot/internal/queue"
+)
+
+// Sink receives the output records next to output.jsonl_path. Write is
+// called from one goroutine per sink. A failed record is logged and
+// dropped, so sinks retry on their own where that makes sense.
+type Sink interface {
+	Write(ctx context.Context, rec queue.EnrichedTx) error
+	Close() error
+}
+
+func newSink(logger *slog.Logger, cfg config.Sink) (Sink, error) {
+	switch cfg.Type {
+	case config.SinkJSONL:
+		return newJSONLSink(cfg.Path)
+	case config.SinkWebhook:
+		return newWebhookSink(cfg)
+	case config.SinkSQLite:
+		return newSQLiteSink(cfg.Path)
+	case config.SinkTCP:
+		return newTCPSink(logger, cfg), nil
+	}
+	return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+}
+
+type sinkQueue struct {
+	cfg  config.Sink
+	sink Sink
+	ch   chan queue.EnrichedTx
+}
+
+// openSinks opens every configured sink. Any failure closes the ones
+// already open.
+func openSinks(logger *slog.Logger, cfg *config.Config) ([]*sinkQueue, error) {
+	sinks := make([]*sinkQueue, 0, len(cfg.Output.Sinks))
+	for _, sc := range cfg.Output.Sinks {
+		s, err := newSink(logger.With("sink", sc.Name), sc)
+		if err != nil {
+			for _, q := range sinks {
+				q.sink.Close()
+			}
+			return nil, fmt.Errorf("sink %s: %w", sc.Name, err)
+		}
+		sinks = append(sinks, &sinkQueue{cfg: sc, sink: s, ch: make(chan queue.EnrichedTx, sc.Buffer)})
+	}
+	return sinks, nil
+}
+
+// serveSinks writes the queued records of every sink until ctx is done and
+// then closes the sinks.
+func serveSinks(ctx context.Context, logger *slog.Logger, sinks []*sinkQueue) error {
+	var wg sync.WaitGroup
+	for _, q := range sinks {
+		wg.Add(1)
+		go func(q *sinkQueue) {
+			defer wg.Done()
+			q.drain(ctx, logger.With("sink", q.cfg.Name))
+		}(q)
+	}
+	wg.Wait()
+	for _, q := range sinks {
+		if err := q.sink.Close(); err != nil {
+			logger.Warn("sink close failed", "sink", q.cfg.Name, "error", err)
+		}
+	}
+	return context.Canceled
+}
+
+// teeSinks passes every record of in on to out after offering it to the
+// sinks.
+func teeSinks(ctx context.Context, sinks []*sinkQueue, in <-chan queue.EnrichedTx, out chan<- queue.EnrichedTx) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case rec := <-in:
+			if err := offerSinks(ctx, sinks, rec); err != nil {
+				return err
+			}
+			if err := send(ctx, out, rec); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// offerSinks queues rec for every sink. A full queue holds up the caller or
+// drops the record, as the sink's on_full says.
+func offerSinks(ctx context.Context, sinks []*sinkQueue, rec queue.EnrichedTx) error {
+	for _, q := range sinks {
+		if q.cfg.OnFull == config.OnFullDrop {
+			select {
+			case q.ch <- rec:
+			default:
+				sinkRecords.With(q.cfg.Name, "dropped").Inc()
+			}
+			continue
+		}
+		if err := send(ctx, q.ch, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *sinkQueue) drain(ctx context.Context, logger *slog.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case rec := <-q.ch:
+			if err := q.sink.Write(ctx, rec); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Warn("sink write failed", "tx", rec.TxHash, "block", rec.BlockNumber, "error", err)
+				sinkRecords.With(q.cfg.Name, "failed").Inc()
+				continue
+			}
+			sinkRecords.With(q.cfg.Name, "written").Inc()
+		}
+	}
+}
+
+// funcSink hands records to code in the same process.
+type funcSink func(queue.EnrichedTx)
+
+func (f funcSink) Write(_ context.Context, rec queue.EnrichedTx) error {
+	f(rec)
+	return nil
+}
+
+func (f funcSink) Close() error {
+	return nil
+}
+
+// indexSink keeps idx up to date. It blocks rather than drops, since the
+// profiles of later launches are read from it.
+func indexSink(logger *slog.Logger, cfg *config.Config, idx *index.Index) *sinkQueue {
+	return &sinkQueue{
+		cfg: config.Sink{Name: "index", OnFull: config.OnFullBlock},
+		sink: funcSink(func(rec queue.EnrichedTx) {
+			if err := idx.Add(context.Background(), rec); err != nil {
+				logger.Warn("index add failed", "tx", rec.TxHash, "block", rec.BlockNumber, "error", err)
+			}
+		}),
+		ch: make(chan queue.EnrichedTx, cfg.Performance.QueueSize),
+	}
+}
+
+// jsonlSink appends records to a second file, like the main output without
+// exactly-once or rotation.
+type jsonlSink struct {
+	file *os.File
+	enc  *json.Encoder
+}
+
+func newJSONLSink(path string) (*jsonlSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	return &jsonlSink{file: f, enc: enc}, nil
+}
+
+func (s *jsonlSink) Write(_ context.Context, rec queue.EnrichedTx) error {
+	return s.enc.Encode(rec)
+}
+
+func (s *jsonlSink) Close() error {
+	return s.file.Close()
+}
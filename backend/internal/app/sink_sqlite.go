@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"pumppilot/internal/queue"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS txs (
+	tx_hash         TEXT    NOT NULL,
+	block_hash      TEXT    NOT NULL,
+	block_number    INTEGER NOT NULL,
+	block_timestamp INTEGER NOT NULL,
+	tier            TEXT    NOT NULL DEFAULT '',
+	from_address    TEXT    NOT NULL,
+	to_address      TEXT    NOT NULL,
+	value_wei       TEXT    NOT NULL,
+	method          TEXT,
+	status          INTEGER,
+	matched_rules   TEXT    NOT NULL DEFAULT '',
+	record          TEXT    NOT NULL,
+	PRIMARY KEY (tx_hash, block_hash)
+);
+CREATE INDEX IF NOT EXISTS txs_block_number ON txs (block_number);
+CREATE INDEX IF NOT EXISTS txs_from_address ON txs (from_address);
+
+CREATE TABLE IF NOT EXISTS logs (
+	tx_hash    TEXT    NOT NULL,
+	block_hash TEXT    NOT NULL,
+	log_index  INTEGER NOT NULL,
+	address    TEXT    NOT NULL,
+	event      TEXT    NOT NULL,
+	args       TEXT    NOT NULL,
+	PRIMARY KEY (tx_hash, block_hash, log_index)
+);
+CREATE INDEX IF NOT EXISTS logs_address_event ON logs (address, event);
+
+CREATE TABLE IF NOT EXISTS tokens (
+	token_address   TEXT    NOT NULL PRIMARY KEY,
+	pool_address    TEXT    NOT NULL,
+	deployer        TEXT    NOT NULL,
+	tx_hash         TEXT    NOT NULL,
+	block_hash      TEXT    NOT NULL,
+	block_number    INTEGER NOT NULL,
+	block_timestamp INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tokens_deployer ON tokens (deployer);
+CREATE INDEX IF NOT EXISTS tokens_tx ON tokens (tx_hash, block_hash);
+`
+
+// sqliteSink keeps records in indexed tables: one row per tx, per decoded
+// log and per token launched. Addresses are stored lower case. A reverted
+// record deletes the rows of the tx in its orphaned block.
+type sqliteSink struct {
+	db *sql.DB
+}
+
+func newSQLiteSink(path string) (*sqliteSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteSink{db: db}, nil
+}
+
+func (s *sqliteSink) Write(ctx context.Context, rec queue.EnrichedTx) error {
+	if rec.Marker != nil {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"txs", "logs", "tokens"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE tx_hash = ? AND block_hash = ?", rec.TxHash, rec.BlockHash); err != nil {
+			return err
+		}
+	}
+	if rec.Reverted {
+		return tx.Commit()
+	}
+
+	record, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	var method, status any
+	if rec.Method != nil {
+		method = rec.Method.Name
+	}
+	if rec.Receipt != nil {
+		status = rec.Receipt.Status
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO txs (tx_hash, block_hash, block_number, block_timestamp, tier, from_address, to_address, value_wei, method, status, matched_rules, record)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.TxHash, rec.BlockHash, rec.BlockNumber, rec.BlockTimestamp, rec.Tier, strings.ToLower(rec.From), strings.ToLower(rec.To),
+		rec.ValueWei, method, status, strings.Join(rec.MatchedRules, ","), string(record),
+	); err != nil {
+		return err
+	}
+	for i, l := range rec.DecodedLogs {
+		args, err := json.Marshal(l.Args)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO logs (tx_hash, block_hash, log_index, address, event, args) VALUES (?, ?, ?, ?, ?, ?)`,
+			rec.TxHash, rec.BlockHash, i, strings.ToLower(l.Address), l.Event, string(args),
+		); err != nil {
+			return err
+		}
+	}
+	for _, token := range rec.TokenAddresses {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO tokens (token_address, pool_address, deployer, tx_hash, block_hash, block_number, block_timestamp)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			strings.ToLower(token), strings.ToLower(rec.PoolAddress), strings.ToLower(rec.From), rec.TxHash, rec.BlockHash, rec.BlockNumber, rec.BlockTimestamp,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteSink) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/util"
+)
+
+// tcpSink pushes records over a plain TCP connection, either as NATS PUB
+// messages on the configured subject or as bare JSON lines. The connection
+// is opened on the first record and again after any write error.
+type tcpSink struct {
+	logger *slog.Logger
+	cfg    config.Sink
+
+	mu   sync.Mutex
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+func newTCPSink(logger *slog.Logger, cfg config.Sink) *tcpSink {
+	return &tcpSink{logger: logger, cfg: cfg}
+}
+
+func (s *tcpSink) Write(ctx context.Context, rec queue.EnrichedTx) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return util.Retry(ctx, s.cfg.Retries, 500*time.Millisecond, func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.conn == nil {
+			if err := s.connect(ctx); err != nil {
+				return err
+			}
+		}
+		if err := s.push(body); err != nil {
+			s.closeLocked()
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *tcpSink) push(body []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(s.cfg.Timeout.Duration))
+	if s.cfg.Protocol == config.TCPProtocolNATS {
+		fmt.Fprintf(s.w, "PUB %s %d\r\n", s.cfg.Subject, len(body))
+		s.w.Write(body)
+		s.w.WriteString("\r\n")
+	} else {
+		s.w.Write(body)
+		s.w.WriteByte('\n')
+	}
+	return s.w.Flush()
+}
+
+// connect dials the address. For NATS it waits for the server INFO, sends
+// CONNECT and keeps answering PINGs for as long as the connection lives.
+func (s *tcpSink) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: s.cfg.Timeout.Duration}
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Address)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.w = bufio.NewWriter(conn)
+	if s.cfg.Protocol != config.TCPProtocolNATS {
+		s.logger.Info("tcp sink connected", "address", s.cfg.Address)
+		return nil
+	}
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(s.cfg.Timeout.Duration))
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		s.closeLocked()
+		return errors.Join(errors.New("nats server did not send INFO"), err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	fmt.Fprintf(s.w, "CONNECT %s\r\n", `{"verbose":false,"pedantic":false,"name":"pumppilot","lang":"go"}`)
+	if err := s.w.Flush(); err != nil {
+		s.closeLocked()
+		return err
+	}
+	go s.read(conn, r)
+	s.logger.Info("tcp sink connected", "address", s.cfg.Address, "subject", s.cfg.Subject)
+	return nil
+}
+
+func (s *tcpSink) read(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			s.mu.Lock()
+			if s.conn == conn {
+				s.logger.Warn("tcp sink connection lost", "error", err)
+				s.closeLocked()
+			}
+			s.mu.Unlock()
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			s.mu.Lock()
+			if s.conn == conn {
+				s.w.WriteString("PONG\r\n")
+				s.w.Flush()
+			}
+			s.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			s.logger.Warn("nats server error", "message", strings.TrimSpace(line))
+		}
+	}
+}
+
+func (s *tcpSink) closeLocked() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+		s.w = nil
+	}
+}
+
+func (s *tcpSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+	return nil
+}
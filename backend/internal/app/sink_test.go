@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+func TestWebhookSinkSignsAndRetries(t *testing.T) {
+	t.Setenv("TEST_WEBHOOK_SECRET", "s3cret")
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + signWebhook([]byte("s3cret"), r.Header.Get(WebhookTimestampHeader), body)
+		if r.Header.Get(WebhookSignatureHeader) != want {
+			t.Errorf("bad signature %q", r.Header.Get(WebhookSignatureHeader))
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := newWebhookSink(config.Sink{URL: srv.URL, SecretEnv: "TEST_WEBHOOK_SECRET", Retries: 2, Timeout: config.Duration{Duration: time.Second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(context.Background(), queue.EnrichedTx{TxHash: "0x1"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("webhook called %d times, want 2", calls)
+	}
+}
+
+func TestSQLiteSinkRetractsReverted(t *testing.T) {
+	s, err := newSQLiteSink(filepath.Join(t.TempDir(), "out.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	rec := queue.EnrichedTx{
+		BlockNumber:    10,
+		BlockHash:      "0xa",
+		TxHash:         "0x1",
+		From:           "0xABC",
+		DecodedLogs:    []queue.DecodedLog{{Event: "PoolCreated", Address: "0xF"}},
+		PoolAddress:    "0xP",
+		TokenAddresses: []string{"0xT"},
+	}
+	if err := s.Write(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	// Written twice, as on a replay.
+	if err := s.Write(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	var deployer string
+	if err := s.db.QueryRow(`SELECT deployer FROM tokens WHERE token_address = '0xt'`).Scan(&deployer); err != nil || deployer != "0xabc" {
+		t.Fatalf("token row: %q %v", deployer, err)
+	}
+
+	rec.Reverted = true
+	if err := s.Write(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"txs", "logs", "tokens"} {
+		var n int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil || n != 0 {
+			t.Fatalf("%s has %d rows after revert (%v)", table, n, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/util"
+)
+
+const (
+	WebhookTimestampHeader = "X-PumpPilot-Timestamp"
+	WebhookSignatureHeader = "X-PumpPilot-Signature"
+)
+
+// webhookSink POSTs each record as JSON. With a secret, the request carries
+// the unix time and an HMAC-SHA256 of "<timestamp>.<body>" so the receiver
+// can check the sender and reject replays.
+type webhookSink struct {
+	cfg    config.Sink
+	client *http.Client
+	secret []byte
+}
+
+func newWebhookSink(cfg config.Sink) (*webhookSink, error) {
+	s := &webhookSink{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout.Duration}}
+	if cfg.SecretEnv != "" {
+		secret := os.Getenv(cfg.SecretEnv)
+		if secret == "" {
+			return nil, fmt.Errorf("%s is not set", cfg.SecretEnv)
+		}
+		s.secret = []byte(secret)
+	}
+	return s, nil
+}
+
+func (s *webhookSink) Write(ctx context.Context, rec queue.EnrichedTx) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	// util.Retry has no notion of a final failure, so rejected requests are
+	// passed out around it.
+	var rejected error
+	err = util.Retry(ctx, s.cfg.Retries, 500*time.Millisecond, func() error {
+		status, err := s.post(ctx, body)
+		switch {
+		case err != nil:
+			return err
+		case status == http.StatusTooManyRequests || status >= 500:
+			return fmt.Errorf("webhook returned %d", status)
+		case status >= 400:
+			rejected = fmt.Errorf("webhook rejected record with %d", status)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return rejected
+}
+
+func (s *webhookSink) post(ctx context.Context, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pumppilot")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.secret != nil {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, ts)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhook(s.secret, ts, body))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func signWebhook(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
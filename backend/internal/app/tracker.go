@@ -2,7 +2,11 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 
 	"pumppilot/internal/checkpoint"
 	"pumppilot/internal/config"
@@ -10,59 +14,201 @@ import (
 )
 
 type blockState struct {
-	expected int
-	done     int
+	hash      common.Hash
+	gen       uint64
+	timestamp uint64
+	filtered  bool
+	expected  int
+	done      int
 }
 
-func runTracker(ctx context.Context, logger *slog.Logger, cfg *config.Config, cp *checkpoint.Store, filtered <-chan queue.BlockFiltered, ack <-chan uint64) error {
+func runTracker(ctx context.Context, logger *slog.Logger, cfg *config.Config, cp *checkpoint.Stream, status *pipelineStatus, dlq *deadLetterQueue, filtered <-chan queue.BlockFiltered, ack <-chan queue.BlockRef, rewind <-chan queue.Rewind, done chan<- queue.BlockDone) error {
 	last := cp.Last()
 	next := last + 1
 	states := map[uint64]*blockState{}
-	completed := map[uint64]bool{}
+	completed := map[uint64]*blockState{}
+	var rewinds rewindLog
+
+	ticker := time.NewTicker(cfg.DeadLetter.StallAfter.Duration / 2)
+	defer ticker.Stop()
+	var blockedAt uint64
+	var blockedSince, reportedAt time.Time
 
 	for {
 		select {
 		case <-ctx.Done():
 			return context.Canceled
+		case <-ticker.C:
+			if _, ok := completed[next]; ok || len(completed) == 0 {
+				blockedAt = 0
+				status.setBlocker(nil)
+				break
+			}
+			if dl, ok := dlq.get(next); ok && dl.Abandoned {
+				logger.Error("skipping abandoned block, its txs are missing from the output", "block", next, "attempts", dl.Attempts, "error", dl.LastError)
+				completed[next] = &blockState{}
+				break
+			}
+			now := time.Now()
+			if blockedAt != next {
+				blockedAt = next
+				blockedSince = now
+				reportedAt = time.Time{}
+			}
+			if now.Sub(blockedSince) < cfg.DeadLetter.StallAfter.Duration {
+				break
+			}
+			b := blockerFor(next, states[next], dlq, blockedSince, len(completed))
+			status.setBlocker(&b)
+			if now.Sub(reportedAt) >= cfg.DeadLetter.StallAfter.Duration {
+				reportedAt = now
+				logger.Warn("checkpoint blocked", "block", next, "reason", b.Reason, "since", blockedSince.Format(time.RFC3339), "completed_after", b.CompletedAfter)
+			}
 		case f := <-filtered:
-			if f.BlockNumber <= last {
+			if f.BlockNumber <= last || rewinds.stale(f.BlockNumber, f.Generation) {
 				continue
 			}
 			st := states[f.BlockNumber]
-			if st == nil {
-				st = &blockState{}
+			if st == nil || st.hash != f.BlockHash || st.gen != f.Generation {
+				st = &blockState{hash: f.BlockHash, gen: f.Generation}
 				states[f.BlockNumber] = st
 			}
+			st.filtered = true
+			st.timestamp = f.Timestamp
 			st.expected = f.FilteredCount
-			if st.expected == 0 && st.done == 0 {
-				completed[f.BlockNumber] = true
+			if st.done >= st.expected {
+				completed[f.BlockNumber] = st
 				delete(states, f.BlockNumber)
 			}
 		case b := <-ack:
-			if b <= last {
+			if b.Number <= last || rewinds.stale(b.Number, b.Generation) {
 				continue
 			}
-			st := states[b]
+			st := states[b.Number]
 			if st == nil {
-				st = &blockState{}
-				states[b] = st
+				st = &blockState{hash: b.Hash, gen: b.Generation}
+				states[b.Number] = st
+			}
+			if st.hash != b.Hash || st.gen != b.Generation {
+				continue
 			}
 			st.done++
-			if st.expected > 0 && st.done >= st.expected {
-				completed[b] = true
-				delete(states, b)
+			if st.filtered && st.done >= st.expected {
+				completed[b.Number] = st
+				delete(states, b.Number)
+			}
+		case r := <-rewind:
+			fork := r.Fork
+			rewinds.add(r)
+			// Blocks of the new generation may have been linked after the
+			// rewind and reached the tracker before it.
+			for n, st := range states {
+				if rewinds.stale(n, st.gen) {
+					delete(states, n)
+				}
+			}
+			for n, st := range completed {
+				if rewinds.stale(n, st.gen) {
+					delete(completed, n)
+				}
+			}
+			if last > fork {
+				if err := cp.Rewind(fork); err != nil {
+					logger.Error("checkpoint rewind failed", "block", fork, "error", err)
+				} else {
+					logger.Warn("checkpoint rewound", "block", fork, "previous", last)
+				}
+				last = fork
+				next = fork + 1
+				status.setProcessed(fork, 0)
 			}
 		}
 
-		for completed[next] {
-			if err := cp.Save(next); err != nil {
+		for {
+			st, ok := completed[next]
+			// A block of a generation whose rewind has not arrived yet waits
+			// for it, so that the rewind does not undo its checkpoint.
+			if !ok || st.gen > rewinds.current() {
+				break
+			}
+			ref := checkpoint.BlockRef{Number: next}
+			if st.hash != (common.Hash{}) {
+				ref.Hash = st.hash.Hex()
+			}
+			if err := cp.Save(ref); err != nil {
 				logger.Error("checkpoint save failed", "block", next, "error", err)
 				break
 			}
 			logger.Info("checkpoint advanced", "block", next)
+			status.setProcessed(next, st.timestamp)
+			if done != nil {
+				select {
+				case <-ctx.Done():
+					return context.Canceled
+				case done <- queue.BlockDone{Number: next, Hash: st.hash, Timestamp: st.timestamp, TxCount: st.expected}:
+				}
+			}
 			delete(completed, next)
 			last = next
 			next++
 		}
 	}
 }
+
+// rewindLog holds the latest rewinds, to tell stale items from ones that
+// are still valid: an item is stale if a later rewind forked below its block.
+type rewindLog []queue.Rewind
+
+// maxRewinds bounds the log. Items cannot be in flight across that many
+// reorgs.
+const maxRewinds = 64
+
+func (l *rewindLog) add(r queue.Rewind) {
+	*l = append(*l, r)
+	if len(*l) > maxRewinds {
+		*l = (*l)[len(*l)-maxRewinds:]
+	}
+}
+
+func (l rewindLog) current() uint64 {
+	if len(l) == 0 {
+		return 0
+	}
+	return l[len(l)-1].Generation
+}
+
+func (l rewindLog) stale(block, gen uint64) bool {
+	for _, r := range l {
+		if r.Generation > gen && block > r.Fork {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocker describes the block that keeps the checkpoint from advancing.
+type Blocker struct {
+	Block          uint64      `json:"block"`
+	Reason         string      `json:"reason"`
+	Since          time.Time   `json:"since"`
+	CompletedAfter int         `json:"completed_after"`
+	DeadLetter     *DeadLetter `json:"dead_letter,omitempty"`
+}
+
+func blockerFor(block uint64, st *blockState, dlq *deadLetterQueue, since time.Time, completedAfter int) Blocker {
+	b := Blocker{Block: block, Since: since, CompletedAfter: completedAfter}
+	if dl, ok := dlq.get(block); ok {
+		b.DeadLetter = &dl
+		b.Reason = fmt.Sprintf("fetch failed %d times, retry at %s: %s", dl.Attempts, dl.NextRetry.Format(time.RFC3339), dl.LastError)
+		return b
+	}
+	switch {
+	case st == nil:
+		b.Reason = "block not fetched yet"
+	case !st.filtered:
+		b.Reason = fmt.Sprintf("waiting for filter, %d txs enriched", st.done)
+	default:
+		b.Reason = fmt.Sprintf("waiting for enrichment, %d/%d txs done", st.done, st.expected)
+	}
+	return b
+}
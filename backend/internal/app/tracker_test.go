@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"pumppilot/internal/checkpoint"
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+func TestTrackerRewindKeepsNewGeneration(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.DeadLetter.Path = filepath.Join(dir, "deadletter.json")
+	cfg.DeadLetter.StallAfter = config.Duration{Duration: time.Minute}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cp := checkpoint.New(filepath.Join(dir, "checkpoint.json")).Stream(checkpoint.MainStream)
+
+	filtered := make(chan queue.BlockFiltered)
+	ack := make(chan queue.BlockRef)
+	rewind := make(chan queue.Rewind)
+	done := make(chan queue.BlockDone, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runTracker(ctx, logger, cfg, cp, newPipelineStatus(cfg), newDeadLetterQueue(logger, cfg), filtered, ack, rewind, done)
+
+	old, fresh := common.HexToHash("0x02"), common.HexToHash("0x2f")
+	filtered <- queue.BlockFiltered{BlockNumber: 1, BlockHash: common.HexToHash("0x01")}
+	filtered <- queue.BlockFiltered{BlockNumber: 2, BlockHash: old, FilteredCount: 1}
+	// The refetched block 2 reaches the tracker before the rewind does.
+	filtered <- queue.BlockFiltered{BlockNumber: 2, BlockHash: fresh, Generation: 1}
+	rewind <- queue.Rewind{Fork: 1, Generation: 1}
+	// Late items of the orphaned block are dropped.
+	ack <- queue.BlockRef{Number: 2, Hash: old}
+	filtered <- queue.BlockFiltered{BlockNumber: 3, BlockHash: common.HexToHash("0x03")}
+	filtered <- queue.BlockFiltered{BlockNumber: 3, BlockHash: common.HexToHash("0x3f"), Generation: 1}
+
+	want := []queue.BlockRef{{Number: 1, Hash: common.HexToHash("0x01")}, {Number: 2, Hash: fresh}, {Number: 3, Hash: common.HexToHash("0x3f")}}
+	for _, w := range want {
+		select {
+		case d := <-done:
+			if d.Number != w.Number || d.Hash != w.Hash {
+				t.Fatalf("got block %d %s, want %d %s", d.Number, d.Hash.Hex(), w.Number, w.Hash.Hex())
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("block %d not done", w.Number)
+		}
+	}
+	if last := cp.Last(); last != 3 {
+		t.Fatalf("checkpoint at %d, want 3", last)
+	}
+}
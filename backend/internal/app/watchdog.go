@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/rpcpool"
+)
+
+const (
+	AlertHeadStale  = "head_stale"
+	AlertLagBlocks  = "lag_blocks"
+	AlertLagSeconds = "lag_seconds"
+	AlertQueueFull  = "queue_full"
+	AlertBlocked    = "checkpoint_blocked"
+)
+
+type Alert struct {
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+type QueueDepth struct {
+	Name string `json:"name"`
+	Len  int    `json:"len"`
+	Cap  int    `json:"cap"`
+}
+
+// Status is a point-in-time view of the pipeline's progress.
+type Status struct {
+	Head               uint64       `json:"head"`
+	HeadSeenAt         time.Time    `json:"head_seen_at"`
+	HeadAgeSeconds     float64      `json:"head_age_seconds"`
+	ProcessedBlock     uint64       `json:"processed_block"`
+	ProcessedTimestamp uint64       `json:"processed_timestamp,omitempty"`
+	LagBlocks          uint64       `json:"lag_blocks"`
+	LagSeconds         float64      `json:"lag_seconds"`
+	Queues             []QueueDepth `json:"queues"`
+	Alerts             []Alert      `json:"alerts"`
+	Blocker            *Blocker     `json:"blocker,omitempty"`
+	DeadLetters        []DeadLetter `json:"dead_letters"`
+}
+
+type queueGauge struct {
+	name string
+	len  func() int
+	cap  int
+}
+
+func gauge[T any](name string, ch chan T) queueGauge {
+	return queueGauge{name: name, len: func() int { return len(ch) }, cap: cap(ch)}
+}
+
+// pipelineStatus is updated by the reader and the tracker and read by the
+// watchdog and App.Status.
+type pipelineStatus struct {
+	mu            sync.Mutex
+	confirmations uint64
+	head          uint64
+	headSeenAt    time.Time
+	processed     uint64
+	processedTs   uint64
+	queues        []queueGauge
+	alerts        map[string]Alert
+	blocker       *Blocker
+	dlq           *deadLetterQueue
+}
+
+func newPipelineStatus(cfg *config.Config) *pipelineStatus {
+	return &pipelineStatus{confirmations: cfg.ReadDelay(), alerts: map[string]Alert{}}
+}
+
+func (s *pipelineStatus) setHead(head uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if head > s.head {
+		s.head = head
+		s.headSeenAt = time.Now()
+	}
+}
+
+func (s *pipelineStatus) headBlock() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.head
+}
+
+func (s *pipelineStatus) setProcessed(block, timestamp uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed = block
+	if timestamp > 0 {
+		s.processedTs = timestamp
+	}
+}
+
+func (s *pipelineStatus) setQueues(queues ...queueGauge) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queues = queues
+}
+
+func (s *pipelineStatus) setBlocker(b *Blocker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocker = b
+}
+
+func (s *pipelineStatus) setDeadLetters(q *deadLetterQueue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dlq = q
+}
+
+func (s *pipelineStatus) setAlerts(alerts map[string]Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = alerts
+}
+
+func (s *pipelineStatus) snapshot() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	st := Status{
+		Head:               s.head,
+		HeadSeenAt:         s.headSeenAt,
+		ProcessedBlock:     s.processed,
+		ProcessedTimestamp: s.processedTs,
+		Queues:             make([]QueueDepth, 0, len(s.queues)),
+		Alerts:             make([]Alert, 0, len(s.alerts)),
+		Blocker:            s.blocker,
+		DeadLetters:        s.dlq.list(),
+	}
+	if !s.headSeenAt.IsZero() {
+		st.HeadAgeSeconds = now.Sub(s.headSeenAt).Seconds()
+	}
+	if ready := s.head - min(s.head, s.confirmations); ready > s.processed && s.processed > 0 {
+		st.LagBlocks = ready - s.processed
+	}
+	if s.processedTs > 0 {
+		st.LagSeconds = float64(now.Unix() - int64(s.processedTs))
+		if st.LagSeconds < 0 {
+			st.LagSeconds = 0
+		}
+	}
+	for _, q := range s.queues {
+		st.Queues = append(st.Queues, QueueDepth{Name: q.name, Len: q.len(), Cap: q.cap})
+	}
+	for _, a := range s.alerts {
+		st.Alerts = append(st.Alerts, a)
+	}
+	sort.Slice(st.Alerts, func(i, j int) bool { return st.Alerts[i].Kind < st.Alerts[j].Kind })
+	return st
+}
+
+// runWatchdog raises alerts when the head goes stale, processing lags behind
+// head, or a queue fills up. With auto_recover it also forces a WS reconnect
+// and an RPC endpoint switch when the head is stale.
+func runWatchdog(ctx context.Context, logger *slog.Logger, cfg *config.Config, status *pipelineStatus, pool *rpcpool.Pool, reconnect chan<- struct{}) error {
+	ticker := time.NewTicker(cfg.Watchdog.Interval.Duration)
+	defer ticker.Stop()
+	started := time.Now()
+	active := map[string]Alert{}
+	var lastAction time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case <-ticker.C:
+		}
+		st := status.snapshot()
+		now := time.Now()
+		raised := map[string]string{}
+
+		headAge := st.HeadAgeSeconds
+		if st.HeadSeenAt.IsZero() {
+			headAge = now.Sub(started).Seconds()
+		}
+		if headAge > cfg.Watchdog.HeadStaleAfter.Duration.Seconds() {
+			raised[AlertHeadStale] = fmt.Sprintf("no new head for %.0fs (head %d)", headAge, st.Head)
+		}
+		if st.LagBlocks > cfg.Watchdog.MaxLagBlocks {
+			raised[AlertLagBlocks] = fmt.Sprintf("processed block %d is %d blocks behind head %d", st.ProcessedBlock, st.LagBlocks, st.Head)
+		}
+		if st.LagSeconds > cfg.Watchdog.MaxLagSeconds.Duration.Seconds() {
+			raised[AlertLagSeconds] = fmt.Sprintf("processed block %d is %.0fs old", st.ProcessedBlock, st.LagSeconds)
+		}
+		if st.Blocker != nil {
+			raised[AlertBlocked] = fmt.Sprintf("checkpoint held at block %d: %s", st.Blocker.Block, st.Blocker.Reason)
+		}
+		for _, q := range st.Queues {
+			if q.Cap > 0 && float64(q.Len) >= cfg.Watchdog.QueueHighWater*float64(q.Cap) {
+				raised[AlertQueueFull+":"+q.Name] = fmt.Sprintf("queue %s at %d/%d", q.Name, q.Len, q.Cap)
+			}
+		}
+
+		next := map[string]Alert{}
+		for kind, msg := range raised {
+			a, ok := active[kind]
+			if !ok {
+				a = Alert{Kind: kind, Since: now}
+				logger.Warn("watchdog alert", "kind", kind, "message", msg)
+			}
+			a.Message = msg
+			next[kind] = a
+		}
+		for kind, a := range active {
+			if _, ok := next[kind]; !ok {
+				logger.Info("watchdog alert cleared", "kind", kind, "duration", now.Sub(a.Since).Round(time.Second).String())
+			}
+		}
+		active = next
+		status.setAlerts(next)
+
+		if _, stale := next[AlertHeadStale]; stale && cfg.Watchdog.AutoRecover && now.Sub(lastAction) >= cfg.Watchdog.ActionCooldown.Duration {
+			lastAction = now
+			select {
+			case reconnect <- struct{}{}:
+			default:
+			}
+			switched := pool.Failover(errors.New("watchdog: head stale"))
+			logger.Warn("watchdog recovery", "ws_reconnect", true, "rpc_switched", switched)
+		}
+	}
+}
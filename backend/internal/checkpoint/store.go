@@ -2,69 +2,394 @@ package checkpoint
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 )
 
-type Store struct {
-	path string
-	mu   sync.Mutex
-	last uint64
+const (
+	// SchemaVersion is the version written by this store. Version 1 is the
+	// legacy format that only held last_processed_block.
+	SchemaVersion = 2
+
+	MainStream = "main"
+
+	defaultHashDepth = 64
+)
+
+var ErrFingerprintMismatch = errors.New("checkpoint was written under a different config fingerprint")
+
+type Options struct {
+	Fingerprint            string
+	HashDepth              int
+	AllowFingerprintChange bool
+}
+
+type BlockRef struct {
+	Number uint64 `json:"number"`
+	Hash   string `json:"hash"`
+}
+
+// Position is how far an output file had been written when its cursor was
+// saved.
+type Position struct {
+	Offset  int64  `json:"offset"`
+	Records uint64 `json:"records"`
+}
+
+type Cursor struct {
+	FirstBlock         uint64     `json:"first_block,omitempty"`
+	LastProcessedBlock uint64     `json:"last_processed_block"`
+	RecentBlocks       []BlockRef `json:"recent_blocks,omitempty"`
+	Output             *Position  `json:"output,omitempty"`
+	UpdatedAt          time.Time  `json:"updated_at"`
 }
 
 type state struct {
+	Version     int                `json:"version"`
+	Fingerprint string             `json:"fingerprint,omitempty"`
+	Streams     map[string]*Cursor `json:"streams"`
+}
+
+type legacyState struct {
 	LastProcessedBlock uint64 `json:"last_processed_block"`
 }
 
+type Store struct {
+	path     string
+	opts     Options
+	mu       sync.Mutex
+	st       state
+	owned    map[string]bool
+	migrated bool
+}
+
 func New(path string) *Store {
-	return &Store{path: path}
+	return NewWithOptions(path, Options{})
+}
+
+func NewWithOptions(path string, opts Options) *Store {
+	if opts.HashDepth <= 0 {
+		opts.HashDepth = defaultHashDepth
+	}
+	return &Store{
+		path:  path,
+		opts:  opts,
+		st:    emptyState(opts.Fingerprint),
+		owned: map[string]bool{},
+	}
 }
 
+// Load reads the checkpoint file, migrating the legacy format if needed, and
+// returns the last processed block of the main stream.
 func (s *Store) Load() (uint64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	st, migrated, err := s.read()
+	if err != nil {
+		return 0, err
+	}
+	if st.Fingerprint != "" && s.opts.Fingerprint != "" && st.Fingerprint != s.opts.Fingerprint {
+		if !s.opts.AllowFingerprintChange {
+			return 0, fmt.Errorf("%w: stored %s, current %s", ErrFingerprintMismatch, st.Fingerprint, s.opts.Fingerprint)
+		}
+	}
+	if s.opts.Fingerprint != "" {
+		st.Fingerprint = s.opts.Fingerprint
+	}
+	s.st = st
+	s.migrated = migrated
+	return s.cursor(MainStream).LastProcessedBlock, nil
+}
+
+// Migrated reports whether the last Load converted a legacy checkpoint.
+func (s *Store) Migrated() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.migrated
+}
+
+func (s *Store) Fingerprint() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.st.Fingerprint
+}
+
+// Last returns the last processed block of the main stream.
+func (s *Store) Last() uint64 {
+	return s.Stream(MainStream).Last()
+}
+
+func (s *Store) Stream(name string) *Stream {
+	return &Stream{store: s, name: name}
+}
+
+func (s *Store) StreamNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, 0, len(s.st.Streams))
+	for name := range s.st.Streams {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Store) cursor(name string) *Cursor {
+	c := s.st.Streams[name]
+	if c == nil {
+		c = &Cursor{}
+		s.st.Streams[name] = c
+	}
+	return c
+}
+
+func (s *Store) read() (state, bool, error) {
 	b, err := os.ReadFile(s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return 0, nil
+			return emptyState(""), false, nil
 		}
-		return 0, err
+		return state{}, false, err
+	}
+	var probe struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return state{}, false, err
+	}
+	if probe.Version == nil {
+		var legacy legacyState
+		if err := json.Unmarshal(b, &legacy); err != nil {
+			return state{}, false, err
+		}
+		st := emptyState("")
+		st.Streams[MainStream] = &Cursor{LastProcessedBlock: legacy.LastProcessedBlock}
+		return st, true, nil
+	}
+	if *probe.Version > SchemaVersion {
+		return state{}, false, fmt.Errorf("checkpoint schema version %d is newer than supported %d", *probe.Version, SchemaVersion)
 	}
 	var st state
 	if err := json.Unmarshal(b, &st); err != nil {
-		return 0, err
+		return state{}, false, err
+	}
+	if st.Streams == nil {
+		st.Streams = map[string]*Cursor{}
 	}
-	s.last = st.LastProcessedBlock
-	return s.last, nil
+	st.Version = SchemaVersion
+	return st, false, nil
 }
 
-func (s *Store) Save(last uint64) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// persist writes the streams owned by this process on top of the file's
+// current contents so that other processes sharing the file keep theirs.
+// A lock on a sidecar file keeps the read and the rename of one process
+// from interleaving with another's.
+func (s *Store) persist() error {
 	dir := filepath.Dir(s.path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return err
 	}
-	st := state{LastProcessedBlock: last}
-	b, err := json.MarshalIndent(st, "", "  ")
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("checkpoint lock: %w", err)
+	}
+	defer unlock()
+	disk, _, err := s.read()
+	if err != nil {
+		return fmt.Errorf("checkpoint read: %w", err)
+	}
+	out := emptyState(s.st.Fingerprint)
+	for name, c := range disk.Streams {
+		out.Streams[name] = c
+	}
+	for name, c := range s.st.Streams {
+		if s.owned[name] || out.Streams[name] == nil {
+			out.Streams[name] = c
+		}
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileSync(s.path, b)
+}
+
+func writeFileSync(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	tmp := s.path + ".tmp"
-	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+	tmp := f.Name()
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		os.Remove(tmp)
 		return err
 	}
-	if err := os.Rename(tmp, s.path); err != nil {
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
 		return fmt.Errorf("checkpoint rename: %w", err)
 	}
-	s.last = last
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
 	return nil
 }
 
-func (s *Store) Last() uint64 {
+func emptyState(fingerprint string) state {
+	return state{Version: SchemaVersion, Fingerprint: fingerprint, Streams: map[string]*Cursor{}}
+}
+
+// Migrate rewrites a checkpoint file in the current schema, adopting the
+// given fingerprint. It reports whether the file was in the legacy format.
+func Migrate(path string, fingerprint string) (bool, error) {
+	s := NewWithOptions(path, Options{Fingerprint: fingerprint, AllowFingerprintChange: true})
+	if _, err := s.Load(); err != nil {
+		return false, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.last
+	for name := range s.st.Streams {
+		s.owned[name] = true
+	}
+	return s.migrated, s.persist()
+}
+
+// Stream is a named cursor inside the checkpoint file.
+type Stream struct {
+	store *Store
+	name  string
+}
+
+func (st *Stream) Name() string {
+	return st.name
+}
+
+func (st *Stream) Last() uint64 {
+	st.store.mu.Lock()
+	defer st.store.mu.Unlock()
+	if c := st.store.st.Streams[st.name]; c != nil {
+		return c.LastProcessedBlock
+	}
+	return 0
+}
+
+// First returns the first block this stream ever saved, or 0 if unknown.
+func (st *Stream) First() uint64 {
+	st.store.mu.Lock()
+	defer st.store.mu.Unlock()
+	if c := st.store.st.Streams[st.name]; c != nil {
+		return c.FirstBlock
+	}
+	return 0
+}
+
+// Recent returns the stored block refs, oldest first.
+func (st *Stream) Recent() []BlockRef {
+	st.store.mu.Lock()
+	defer st.store.mu.Unlock()
+	c := st.store.st.Streams[st.name]
+	if c == nil {
+		return nil
+	}
+	return append([]BlockRef(nil), c.RecentBlocks...)
+}
+
+// Position returns the output position saved with the cursor, if any.
+func (st *Stream) Position() (Position, bool) {
+	st.store.mu.Lock()
+	defer st.store.mu.Unlock()
+	if c := st.store.st.Streams[st.name]; c != nil && c.Output != nil {
+		return *c.Output, true
+	}
+	return Position{}, false
+}
+
+func (st *Stream) Save(ref BlockRef) error {
+	return st.save(ref, nil)
+}
+
+// SaveAt saves the cursor together with the output position reached at ref.
+func (st *Stream) SaveAt(ref BlockRef, pos Position) error {
+	return st.save(ref, &pos)
+}
+
+func (st *Stream) save(ref BlockRef, pos *Position) error {
+	s := st.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.cursor(st.name)
+	prev := *c
+	recent := trimAbove(c.RecentBlocks, ref.Number-1)
+	if ref.Hash != "" {
+		recent = append(recent, ref)
+	}
+	if len(recent) > s.opts.HashDepth {
+		recent = recent[len(recent)-s.opts.HashDepth:]
+	}
+	if c.FirstBlock == 0 && c.LastProcessedBlock == 0 {
+		c.FirstBlock = ref.Number
+	}
+	c.LastProcessedBlock = ref.Number
+	c.RecentBlocks = recent
+	if pos != nil {
+		c.Output = pos
+	}
+	c.UpdatedAt = time.Now().UTC()
+	s.owned[st.name] = true
+	if err := s.persist(); err != nil {
+		*c = prev
+		return err
+	}
+	return nil
+}
+
+// Rewind moves the cursor back to block and forgets newer block hashes.
+func (st *Stream) Rewind(block uint64) error {
+	s := st.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.cursor(st.name)
+	if c.LastProcessedBlock <= block {
+		return nil
+	}
+	prev := *c
+	c.LastProcessedBlock = block
+	c.RecentBlocks = trimAbove(c.RecentBlocks, block)
+	c.UpdatedAt = time.Now().UTC()
+	s.owned[st.name] = true
+	if err := s.persist(); err != nil {
+		*c = prev
+		return err
+	}
+	return nil
+}
+
+func trimAbove(refs []BlockRef, block uint64) []BlockRef {
+	out := make([]BlockRef, 0, len(refs)+1)
+	for _, r := range refs {
+		if r.Number <= block {
+			out = append(out, r)
+		}
+	}
+	return out
 }
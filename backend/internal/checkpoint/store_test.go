@@ -0,0 +1,138 @@
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLoadMigratesLegacyState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := os.WriteFile(path, []byte(`{"last_processed_block": 42}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewWithOptions(path, Options{Fingerprint: "abc"})
+	last, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if last != 42 || !s.Migrated() {
+		t.Fatalf("unexpected load result: last=%d migrated=%v", last, s.Migrated())
+	}
+	if err := s.Stream(MainStream).Save(BlockRef{Number: 43, Hash: "0x43"}); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+
+	reloaded := NewWithOptions(path, Options{Fingerprint: "abc"})
+	last, err = reloaded.Load()
+	if err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	if last != 43 || reloaded.Migrated() {
+		t.Fatalf("unexpected reload result: last=%d migrated=%v", last, reloaded.Migrated())
+	}
+	if recent := reloaded.Stream(MainStream).Recent(); len(recent) != 1 || recent[0].Hash != "0x43" {
+		t.Fatalf("unexpected recent blocks: %+v", recent)
+	}
+}
+
+func TestLoadRefusesFingerprintChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	s := NewWithOptions(path, Options{Fingerprint: "old"})
+	if _, err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Stream(MainStream).Save(BlockRef{Number: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewWithOptions(path, Options{Fingerprint: "new"}).Load()
+	if !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("expected fingerprint mismatch, got %v", err)
+	}
+	last, err := NewWithOptions(path, Options{Fingerprint: "new", AllowFingerprintChange: true}).Load()
+	if err != nil || last != 10 {
+		t.Fatalf("forced load: last=%d err=%v", last, err)
+	}
+}
+
+func TestStreamsFromSeparateStoresAreMerged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	a := New(path)
+	b := New(path)
+	if _, err := a.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Stream(MainStream).Save(BlockRef{Number: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Stream("smoke").Save(BlockRef{Number: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(path)
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Stream(MainStream).Last() != 100 || c.Stream("smoke").Last() != 7 {
+		t.Fatalf("streams not merged: main=%d smoke=%d", c.Stream(MainStream).Last(), c.Stream("smoke").Last())
+	}
+}
+
+func TestStreamRewindTrimsHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	s := NewWithOptions(path, Options{HashDepth: 3})
+	st := s.Stream(MainStream)
+	for n := uint64(1); n <= 5; n++ {
+		if err := st.Save(BlockRef{Number: n, Hash: "h"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if recent := st.Recent(); len(recent) != 3 || recent[0].Number != 3 {
+		t.Fatalf("unexpected recent blocks: %+v", recent)
+	}
+	if err := st.Rewind(3); err != nil {
+		t.Fatal(err)
+	}
+	if st.Last() != 3 || len(st.Recent()) != 1 {
+		t.Fatalf("unexpected state after rewind: last=%d recent=%+v", st.Last(), st.Recent())
+	}
+}
+
+func TestConcurrentStoresKeepEachOthersStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	live, backfill := New(path), New(path)
+	const saves = 50
+	var wg sync.WaitGroup
+	for _, s := range []*Stream{live.Stream(MainStream), backfill.Stream("backfill:1-100")} {
+		wg.Add(1)
+		go func(st *Stream) {
+			defer wg.Done()
+			for n := uint64(1); n <= saves; n++ {
+				if err := st.Save(BlockRef{Number: n}); err != nil {
+					t.Errorf("%s save %d: %v", st.Name(), n, err)
+					return
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	reloaded := New(path)
+	if _, err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{MainStream, "backfill:1-100"} {
+		if last := reloaded.Stream(name).Last(); last != saves {
+			t.Fatalf("stream %s at %d, want %d", name, last, saves)
+		}
+	}
+	if tmps, _ := filepath.Glob(path + ".*.tmp"); len(tmps) != 0 {
+		t.Fatalf("temp files left behind: %v", tmps)
+	}
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math/big"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -10,6 +14,41 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	IngestionModeBlocks = "blocks"
+	IngestionModeLogs   = "logs"
+)
+
+const (
+	ConfirmedModeReemit    = "reemit"
+	ConfirmedModeReference = "reference"
+)
+
+const (
+	FsyncNone     = "none"
+	FsyncBlock    = "block"
+	FsyncInterval = "interval"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+const (
+	SinkJSONL   = "jsonl"
+	SinkWebhook = "webhook"
+	SinkSQLite  = "sqlite"
+	SinkTCP     = "tcp"
+
+	OnFullBlock = "block"
+	OnFullDrop  = "drop"
+
+	TCPProtocolNATS  = "nats"
+	TCPProtocolLines = "lines"
+)
+
 type Duration struct {
 	time.Duration
 }
@@ -44,14 +83,23 @@ type Config struct {
 	FactoryAddress string `yaml:"factory_address"`
 
 	RPC struct {
-		HTTP string `yaml:"http"`
-		WS   string `yaml:"ws"`
+		HTTP           string     `yaml:"http"`
+		WS             string     `yaml:"ws"`
+		HTTPEndpoints  []Endpoint `yaml:"http_endpoints"`
+		WSEndpoints    []Endpoint `yaml:"ws_endpoints"`
+		EjectAfter     int        `yaml:"eject_after"`
+		EjectFor       Duration   `yaml:"eject_for"`
+		MaxErrorRate   float64    `yaml:"max_error_rate"`
+		BroadcastCount int        `yaml:"broadcast_count"`
 	} `yaml:"rpc"`
 
 	Ingestion struct {
+		Mode             string   `yaml:"mode"`
+		LogRangeSize     uint64   `yaml:"log_range_size"`
 		StartBlock       string   `yaml:"start_block"`
 		Confirmations    uint64   `yaml:"confirmations"`
 		ReorgReplayDepth uint64   `yaml:"reorg_replay_depth"`
+		ReorgWindow      uint64   `yaml:"reorg_window"`
 		PollInterval     Duration `yaml:"poll_interval"`
 	} `yaml:"ingestion"`
 
@@ -62,8 +110,51 @@ type Config struct {
 		RetryMax                int      `yaml:"retry_max"`
 		RetryBackoff            Duration `yaml:"retry_backoff"`
 		QueueSize               int      `yaml:"queue_size"`
+		BatchSize               int      `yaml:"batch_size"`
+		BatchLinger             Duration `yaml:"batch_linger"`
+		BlockReceipts           bool     `yaml:"block_receipts"`
 	} `yaml:"performance"`
 
+	Watchdog struct {
+		Interval       Duration `yaml:"interval"`
+		HeadStaleAfter Duration `yaml:"head_stale_after"`
+		MaxLagBlocks   uint64   `yaml:"max_lag_blocks"`
+		MaxLagSeconds  Duration `yaml:"max_lag_seconds"`
+		QueueHighWater float64  `yaml:"queue_high_water"`
+		AutoRecover    bool     `yaml:"auto_recover"`
+		ActionCooldown Duration `yaml:"action_cooldown"`
+	} `yaml:"watchdog"`
+
+	DeadLetter struct {
+		Path         string   `yaml:"path"`
+		RetryBackoff Duration `yaml:"retry_backoff"`
+		MaxBackoff   Duration `yaml:"max_backoff"`
+		SkipAfter    int      `yaml:"skip_after"`
+		StallAfter   Duration `yaml:"stall_after"`
+	} `yaml:"dead_letter"`
+
+	Tiers struct {
+		Head           bool   `yaml:"head"`
+		HeadOutputPath string `yaml:"head_output_path"`
+		ConfirmedMode  string `yaml:"confirmed_mode"`
+	} `yaml:"tiers"`
+
+	Metrics struct {
+		Disabled bool   `yaml:"disabled"`
+		Listen   string `yaml:"listen"`
+	} `yaml:"metrics"`
+
+	Mempool struct {
+		Enabled           bool     `yaml:"enabled"`
+		OutputPath        string   `yaml:"output_path"`
+		DropAfter         Duration `yaml:"drop_after"`
+		LookupConcurrency int      `yaml:"lookup_concurrency"`
+	} `yaml:"mempool"`
+
+	Filter struct {
+		Rules []FilterRule `yaml:"rules"`
+	} `yaml:"filter"`
+
 	Decoding struct {
 		ABIPath       string         `yaml:"abi_path"`
 		EventMappings []EventMapping `yaml:"event_mappings"`
@@ -80,8 +171,24 @@ type Config struct {
 		MaxFeeMultiplier       float64 `yaml:"max_fee_multiplier"`
 		MinPriorityFeeGwei     float64 `yaml:"min_priority_fee_gwei"`
 		FeeRefreshSeconds      uint64  `yaml:"fee_refresh_seconds"`
+		PairFeeBps             int64   `yaml:"pair_fee_bps"`
+		CurveTokenSupply       string  `yaml:"curve_token_supply"`
+		DefaultSlippageBps     int64   `yaml:"default_slippage_bps"`
+		MaxSlippageBps         int64   `yaml:"max_slippage_bps"`
 	} `yaml:"tx"`
 
+	TxTrack struct {
+		Disabled      bool     `yaml:"disabled"`
+		Path          string   `yaml:"path"`
+		PollInterval  Duration `yaml:"poll_interval"`
+		Confirmations uint64   `yaml:"confirmations"`
+		DropAfter     Duration `yaml:"drop_after"`
+		Retain        Duration `yaml:"retain"`
+		SpeedUpAfter  Duration `yaml:"speedup_after"`
+		BumpPercent   int64    `yaml:"bump_percent"`
+		MaxFeeGwei    float64  `yaml:"max_fee_gwei"`
+	} `yaml:"txtrack"`
+
 	KeyStore struct {
 		Dir                string `yaml:"dir"`
 		PassphraseEnv      string `yaml:"passphrase_env"`
@@ -89,19 +196,98 @@ type Config struct {
 	} `yaml:"keystore"`
 
 	API struct {
-		Listen    string `yaml:"listen"`
-		AuthToken string `yaml:"auth_token"`
+		Listen         string `yaml:"listen"`
+		AuthToken      string `yaml:"auth_token"`
+		RecentLaunches int    `yaml:"recent_launches"`
+		Feed           struct {
+			Path         string   `yaml:"path"`
+			Buffer       int      `yaml:"buffer"`
+			ClientBuffer int      `yaml:"client_buffer"`
+			Heartbeat    Duration `yaml:"heartbeat"`
+		} `yaml:"feed"`
 	} `yaml:"api"`
 
+	Index struct {
+		Disabled bool   `yaml:"disabled"`
+		Path     string `yaml:"path"`
+	} `yaml:"index"`
+
+	Pools struct {
+		Enabled          bool     `yaml:"enabled"`
+		Path             string   `yaml:"path"`
+		PollInterval     Duration `yaml:"poll_interval"`
+		Confirmations    uint64   `yaml:"confirmations"`
+		SnapshotInterval Duration `yaml:"snapshot_interval"`
+		IdleAfter        Duration `yaml:"idle_after"`
+		ReservesCall     string   `yaml:"reserves_call"`
+		TradeTopics      []string `yaml:"trade_topics"`
+	} `yaml:"pools"`
+
 	Checkpoint struct {
-		Path string `yaml:"path"`
+		Path              string `yaml:"path"`
+		HashDepth         int    `yaml:"hash_depth"`
+		AllowConfigChange bool   `yaml:"allow_config_change"`
 	} `yaml:"checkpoint"`
 
 	Output struct {
-		JSONLPath string `yaml:"jsonl_path"`
+		JSONLPath     string   `yaml:"jsonl_path"`
+		Ordered       bool     `yaml:"ordered"`
+		BlockMarkers  bool     `yaml:"block_markers"`
+		ExactlyOnce   bool     `yaml:"exactly_once"`
+		Fsync         string   `yaml:"fsync"`
+		FsyncInterval Duration `yaml:"fsync_interval"`
+		Rotate        struct {
+			MaxBytes    int64    `yaml:"max_bytes"`
+			Interval    Duration `yaml:"interval"`
+			Blocks      uint64   `yaml:"blocks"`
+			Compression string   `yaml:"compression"`
+			Retain      int      `yaml:"retain"`
+		} `yaml:"rotate"`
+		Sinks []Sink `yaml:"sinks"`
 	} `yaml:"output"`
 }
 
+type Endpoint struct {
+	URL    string  `yaml:"url"`
+	Weight float64 `yaml:"weight"`
+}
+
+// FilterRule selects txs for the output. Criteria that are set must all
+// match; any entry of a list criterion is enough.
+type FilterRule struct {
+	Name         string   `yaml:"name"`
+	To           []string `yaml:"to"`
+	From         []string `yaml:"from"`
+	Selectors    []string `yaml:"selectors"`
+	MinValueWei  string   `yaml:"min_value_wei"`
+	LogAddresses []string `yaml:"log_addresses"`
+	LogTopics    []string `yaml:"log_topics"`
+}
+
+// Sink is an extra destination for output records. Fields that do not
+// apply to the sink type are ignored.
+type Sink struct {
+	Name    string   `yaml:"name"`
+	Type    string   `yaml:"type"`
+	Buffer  int      `yaml:"buffer"`
+	OnFull  string   `yaml:"on_full"`
+	Timeout Duration `yaml:"timeout"`
+	Retries int      `yaml:"retries"`
+
+	// jsonl, sqlite
+	Path string `yaml:"path"`
+
+	// webhook
+	URL       string            `yaml:"url"`
+	SecretEnv string            `yaml:"secret_env"`
+	Headers   map[string]string `yaml:"headers"`
+
+	// tcp
+	Address  string `yaml:"address"`
+	Protocol string `yaml:"protocol"`
+	Subject  string `yaml:"subject"`
+}
+
 type EventMapping struct {
 	Event       string   `yaml:"event"`
 	PoolField   string   `yaml:"pool_field"`
@@ -134,12 +320,55 @@ func (c *Config) applyDefaults() {
 			c.ChainID = 8453
 		}
 	}
+	if len(c.RPC.HTTPEndpoints) == 0 && c.RPC.HTTP != "" {
+		c.RPC.HTTPEndpoints = []Endpoint{{URL: c.RPC.HTTP}}
+	}
+	if len(c.RPC.WSEndpoints) == 0 && c.RPC.WS != "" {
+		c.RPC.WSEndpoints = []Endpoint{{URL: c.RPC.WS}}
+	}
+	if c.RPC.HTTP == "" && len(c.RPC.HTTPEndpoints) > 0 {
+		c.RPC.HTTP = c.RPC.HTTPEndpoints[0].URL
+	}
+	if c.RPC.WS == "" && len(c.RPC.WSEndpoints) > 0 {
+		c.RPC.WS = c.RPC.WSEndpoints[0].URL
+	}
+	for i := range c.RPC.HTTPEndpoints {
+		if c.RPC.HTTPEndpoints[i].Weight == 0 {
+			c.RPC.HTTPEndpoints[i].Weight = 1
+		}
+	}
+	for i := range c.RPC.WSEndpoints {
+		if c.RPC.WSEndpoints[i].Weight == 0 {
+			c.RPC.WSEndpoints[i].Weight = 1
+		}
+	}
+	if c.RPC.EjectAfter == 0 {
+		c.RPC.EjectAfter = 3
+	}
+	if c.RPC.EjectFor.Duration == 0 {
+		c.RPC.EjectFor = Duration{Duration: 30 * time.Second}
+	}
+	if c.RPC.MaxErrorRate == 0 {
+		c.RPC.MaxErrorRate = 0.5
+	}
+	if c.RPC.BroadcastCount == 0 {
+		c.RPC.BroadcastCount = 3
+	}
+	if c.Ingestion.Mode == "" {
+		c.Ingestion.Mode = IngestionModeBlocks
+	}
+	if c.Ingestion.LogRangeSize == 0 {
+		c.Ingestion.LogRangeSize = 500
+	}
 	if c.Ingestion.Confirmations == 0 {
 		c.Ingestion.Confirmations = 2
 	}
 	if c.Ingestion.ReorgReplayDepth == 0 {
 		c.Ingestion.ReorgReplayDepth = 5
 	}
+	if c.Ingestion.ReorgWindow == 0 {
+		c.Ingestion.ReorgWindow = 128
+	}
 	if c.Ingestion.PollInterval.Duration == 0 {
 		c.Ingestion.PollInterval = Duration{Duration: 5 * time.Second}
 	}
@@ -161,6 +390,60 @@ func (c *Config) applyDefaults() {
 	if c.Performance.QueueSize == 0 {
 		c.Performance.QueueSize = 2000
 	}
+	if c.Performance.BatchSize == 0 {
+		c.Performance.BatchSize = 1
+	}
+	if c.Performance.BatchLinger.Duration == 0 {
+		c.Performance.BatchLinger = Duration{Duration: 5 * time.Millisecond}
+	}
+	if c.Watchdog.Interval.Duration == 0 {
+		c.Watchdog.Interval = Duration{Duration: 10 * time.Second}
+	}
+	if c.Watchdog.HeadStaleAfter.Duration == 0 {
+		c.Watchdog.HeadStaleAfter = Duration{Duration: 30 * time.Second}
+	}
+	if c.Watchdog.MaxLagBlocks == 0 {
+		c.Watchdog.MaxLagBlocks = 50
+	}
+	if c.Watchdog.MaxLagSeconds.Duration == 0 {
+		c.Watchdog.MaxLagSeconds = Duration{Duration: 2 * time.Minute}
+	}
+	if c.Watchdog.QueueHighWater == 0 {
+		c.Watchdog.QueueHighWater = 0.8
+	}
+	if c.Watchdog.ActionCooldown.Duration == 0 {
+		c.Watchdog.ActionCooldown = Duration{Duration: time.Minute}
+	}
+	if c.DeadLetter.Path == "" {
+		c.DeadLetter.Path = "data/deadletter.json"
+	}
+	if c.DeadLetter.RetryBackoff.Duration == 0 {
+		c.DeadLetter.RetryBackoff = Duration{Duration: 5 * time.Second}
+	}
+	if c.DeadLetter.MaxBackoff.Duration == 0 {
+		c.DeadLetter.MaxBackoff = Duration{Duration: 5 * time.Minute}
+	}
+	if c.DeadLetter.StallAfter.Duration == 0 {
+		c.DeadLetter.StallAfter = Duration{Duration: 30 * time.Second}
+	}
+	if c.Tiers.HeadOutputPath == "" {
+		c.Tiers.HeadOutputPath = "data/head.jsonl"
+	}
+	if c.Tiers.ConfirmedMode == "" {
+		c.Tiers.ConfirmedMode = ConfirmedModeReemit
+	}
+	if c.Metrics.Listen == "" {
+		c.Metrics.Listen = "127.0.0.1:9090"
+	}
+	if c.Mempool.OutputPath == "" {
+		c.Mempool.OutputPath = "data/pending.jsonl"
+	}
+	if c.Mempool.DropAfter.Duration == 0 {
+		c.Mempool.DropAfter = Duration{Duration: 2 * time.Minute}
+	}
+	if c.Mempool.LookupConcurrency == 0 {
+		c.Mempool.LookupConcurrency = 8
+	}
 	if c.Tx.DefaultDeadlineSeconds == 0 {
 		c.Tx.DefaultDeadlineSeconds = 120
 	}
@@ -173,6 +456,12 @@ func (c *Config) applyDefaults() {
 	if c.Tx.FeeRefreshSeconds == 0 {
 		c.Tx.FeeRefreshSeconds = 5
 	}
+	if c.Tx.MaxSlippageBps == 0 {
+		c.Tx.MaxSlippageBps = 5000
+	}
+	if c.Tx.CurveTokenSupply == "" {
+		c.Tx.CurveTokenSupply = "1000000000000000000000000000"
+	}
 	if c.KeyStore.Dir == "" {
 		c.KeyStore.Dir = "data/keystore"
 	}
@@ -182,12 +471,99 @@ func (c *Config) applyDefaults() {
 	if c.API.Listen == "" {
 		c.API.Listen = ":8080"
 	}
+	if c.Index.Path == "" {
+		c.Index.Path = "data/index.db"
+	}
+	if c.TxTrack.Path == "" {
+		c.TxTrack.Path = "data/txs.json"
+	}
+	if c.TxTrack.PollInterval.Duration == 0 {
+		c.TxTrack.PollInterval = Duration{Duration: 2 * time.Second}
+	}
+	if c.TxTrack.DropAfter.Duration == 0 {
+		c.TxTrack.DropAfter = Duration{Duration: 10 * time.Minute}
+	}
+	if c.TxTrack.Retain.Duration == 0 {
+		c.TxTrack.Retain = Duration{Duration: 24 * time.Hour}
+	}
+	if c.TxTrack.BumpPercent == 0 {
+		c.TxTrack.BumpPercent = 12
+	}
+	if c.TxTrack.MaxFeeGwei == 0 {
+		c.TxTrack.MaxFeeGwei = 200
+	}
+	if c.Pools.Path == "" {
+		c.Pools.Path = "data/pools.json"
+	}
+	if c.Pools.PollInterval.Duration == 0 {
+		c.Pools.PollInterval = Duration{Duration: 2 * time.Second}
+	}
+	if c.Pools.SnapshotInterval.Duration == 0 {
+		c.Pools.SnapshotInterval = Duration{Duration: 30 * time.Second}
+	}
+	if c.Pools.IdleAfter.Duration == 0 {
+		c.Pools.IdleAfter = Duration{Duration: 24 * time.Hour}
+	}
+	if c.Pools.ReservesCall == "" {
+		c.Pools.ReservesCall = "getReserves()"
+	}
 	if c.Checkpoint.Path == "" {
 		c.Checkpoint.Path = "data/checkpoint.json"
 	}
+	if c.Checkpoint.HashDepth == 0 {
+		c.Checkpoint.HashDepth = 64
+	}
 	if c.Output.JSONLPath == "" {
 		c.Output.JSONLPath = "data/output.jsonl"
 	}
+	if c.Output.Fsync == "" {
+		c.Output.Fsync = FsyncBlock
+	}
+	if c.Output.FsyncInterval.Duration == 0 {
+		c.Output.FsyncInterval = Duration{Duration: time.Second}
+	}
+	if c.Output.Rotate.Compression == "" {
+		c.Output.Rotate.Compression = CompressionNone
+	}
+	if c.API.RecentLaunches == 0 {
+		c.API.RecentLaunches = 200
+	}
+	if c.API.Feed.Path == "" {
+		c.API.Feed.Path = c.Output.JSONLPath
+	}
+	if c.API.Feed.Buffer == 0 {
+		c.API.Feed.Buffer = 10000
+	}
+	if c.API.Feed.ClientBuffer == 0 {
+		c.API.Feed.ClientBuffer = 256
+	}
+	if c.API.Feed.Heartbeat.Duration == 0 {
+		c.API.Feed.Heartbeat = Duration{Duration: 15 * time.Second}
+	}
+	for i := range c.Output.Sinks {
+		s := &c.Output.Sinks[i]
+		if s.Name == "" {
+			s.Name = s.Type
+		}
+		if s.Buffer == 0 {
+			s.Buffer = 1024
+		}
+		if s.OnFull == "" {
+			s.OnFull = OnFullBlock
+		}
+		if s.Timeout.Duration == 0 {
+			s.Timeout = Duration{Duration: 10 * time.Second}
+		}
+		if s.Retries == 0 {
+			s.Retries = 3
+		}
+		if s.Type == SinkTCP && s.Protocol == "" {
+			s.Protocol = TCPProtocolNATS
+		}
+		if s.Type == SinkTCP && s.Subject == "" {
+			s.Subject = "pumppilot.records"
+		}
+	}
 }
 
 func (c *Config) validate() error {
@@ -200,18 +576,147 @@ func (c *Config) validate() error {
 	if c.RPC.WS == "" {
 		return fmt.Errorf("rpc.ws is required")
 	}
+	for _, e := range append(append([]Endpoint{}, c.RPC.HTTPEndpoints...), c.RPC.WSEndpoints...) {
+		if e.URL == "" {
+			return fmt.Errorf("rpc endpoint url is required")
+		}
+		if e.Weight < 0 {
+			return fmt.Errorf("rpc endpoint weight must be >= 0")
+		}
+	}
 	if c.Ingestion.StartBlock == "" {
 		c.Ingestion.StartBlock = "latest"
 	}
+	switch c.Ingestion.Mode {
+	case IngestionModeBlocks, IngestionModeLogs:
+	default:
+		return fmt.Errorf("ingestion.mode must be %q or %q", IngestionModeBlocks, IngestionModeLogs)
+	}
 	if c.Performance.BlockFetchConcurrency < 1 {
 		return fmt.Errorf("block_fetch_concurrency must be >= 1")
 	}
 	if c.Performance.ReceiptFetchConcurrency < 1 {
 		return fmt.Errorf("receipt_fetch_concurrency must be >= 1")
 	}
+	if c.Performance.BatchSize < 1 {
+		return fmt.Errorf("batch_size must be >= 1")
+	}
+	switch c.Tiers.ConfirmedMode {
+	case ConfirmedModeReemit, ConfirmedModeReference:
+	default:
+		return fmt.Errorf("tiers.confirmed_mode must be %q or %q", ConfirmedModeReemit, ConfirmedModeReference)
+	}
+	if c.Mempool.LookupConcurrency < 1 {
+		return fmt.Errorf("mempool.lookup_concurrency must be >= 1")
+	}
+	if c.Output.BlockMarkers && !c.Output.Ordered {
+		return fmt.Errorf("output.block_markers requires output.ordered")
+	}
+	switch c.Output.Fsync {
+	case FsyncNone, FsyncBlock, FsyncInterval:
+	default:
+		return fmt.Errorf("output.fsync must be %q, %q or %q", FsyncNone, FsyncBlock, FsyncInterval)
+	}
+	if c.Output.ExactlyOnce && c.Output.JSONLPath == "-" {
+		return fmt.Errorf("output.exactly_once needs a file, not stdout")
+	}
+	switch c.Output.Rotate.Compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return fmt.Errorf("output.rotate.compression must be %q, %q or %q", CompressionNone, CompressionGzip, CompressionZstd)
+	}
+	if c.Output.Rotate.MaxBytes < 0 || c.Output.Rotate.Retain < 0 {
+		return fmt.Errorf("output.rotate.max_bytes and output.rotate.retain must be >= 0")
+	}
+	if c.OutputRotates() && !c.Output.ExactlyOnce {
+		return fmt.Errorf("output.rotate requires output.exactly_once")
+	}
+	if c.API.RecentLaunches < 1 || c.API.Feed.Buffer < 1 || c.API.Feed.ClientBuffer < 1 {
+		return fmt.Errorf("api.recent_launches, api.feed.buffer and api.feed.client_buffer must be >= 1")
+	}
+	if c.Tx.PairFeeBps < 0 || c.Tx.PairFeeBps >= 10000 {
+		return fmt.Errorf("tx.pair_fee_bps must be between 0 and 9999")
+	}
+	if c.Tx.DefaultSlippageBps < 0 || c.Tx.DefaultSlippageBps > c.Tx.MaxSlippageBps || c.Tx.MaxSlippageBps > 10000 {
+		return fmt.Errorf("tx.default_slippage_bps must be between 0 and tx.max_slippage_bps, which is at most 10000")
+	}
+	if v, ok := new(big.Int).SetString(c.Tx.CurveTokenSupply, 10); !ok || v.Sign() <= 0 {
+		return fmt.Errorf("tx.curve_token_supply must be a positive integer")
+	}
+	if c.TxTrack.PollInterval.Duration < 0 || c.TxTrack.DropAfter.Duration < 0 || c.TxTrack.Retain.Duration < 0 {
+		return fmt.Errorf("txtrack.poll_interval, txtrack.drop_after and txtrack.retain must be >= 0 (0 uses the default)")
+	}
+	if c.TxTrack.SpeedUpAfter.Duration < 0 {
+		return fmt.Errorf("txtrack.speedup_after must be >= 0")
+	}
+	if c.TxTrack.BumpPercent < 10 {
+		// Nodes only replace a pending tx whose fees are at least 10% higher.
+		return fmt.Errorf("txtrack.bump_percent must be >= 10")
+	}
+	if c.TxTrack.MaxFeeGwei < 0 {
+		return fmt.Errorf("txtrack.max_fee_gwei must be >= 0 (0 uses the default, 200)")
+	}
+	if c.Pools.PollInterval.Duration < 0 || c.Pools.SnapshotInterval.Duration < 0 || c.Pools.IdleAfter.Duration < 0 {
+		return fmt.Errorf("pools.poll_interval, pools.snapshot_interval and pools.idle_after must be >= 0 (0 uses the default)")
+	}
+	names := map[string]bool{}
+	for _, s := range c.Output.Sinks {
+		if names[s.Name] {
+			return fmt.Errorf("output.sinks: duplicate name %q", s.Name)
+		}
+		names[s.Name] = true
+		if err := s.validate(); err != nil {
+			return fmt.Errorf("output.sinks %q: %w", s.Name, err)
+		}
+	}
 	return nil
 }
 
+func (s Sink) validate() error {
+	switch s.Type {
+	case SinkJSONL, SinkSQLite:
+		if s.Path == "" {
+			return fmt.Errorf("path is required")
+		}
+	case SinkWebhook:
+		if s.URL == "" {
+			return fmt.Errorf("url is required")
+		}
+	case SinkTCP:
+		if s.Address == "" {
+			return fmt.Errorf("address is required")
+		}
+		if s.Protocol != TCPProtocolNATS && s.Protocol != TCPProtocolLines {
+			return fmt.Errorf("protocol must be %q or %q", TCPProtocolNATS, TCPProtocolLines)
+		}
+	default:
+		return fmt.Errorf("type must be %q, %q, %q or %q", SinkJSONL, SinkWebhook, SinkSQLite, SinkTCP)
+	}
+	if s.OnFull != OnFullBlock && s.OnFull != OnFullDrop {
+		return fmt.Errorf("on_full must be %q or %q", OnFullBlock, OnFullDrop)
+	}
+	if s.Buffer < 1 || s.Retries < 0 {
+		return fmt.Errorf("buffer must be >= 1 and retries >= 0")
+	}
+	return nil
+}
+
+// OutputRotates reports whether any output.rotate trigger is set.
+func (c *Config) OutputRotates() bool {
+	r := c.Output.Rotate
+	return r.MaxBytes > 0 || r.Interval.Duration > 0 || r.Blocks > 0
+}
+
+// ReadDelay is how many blocks the reader stays behind head. With the head
+// tier enabled blocks are read right away and confirmations are applied to
+// the output instead.
+func (c *Config) ReadDelay() uint64 {
+	if c.Tiers.Head {
+		return 0
+	}
+	return c.Ingestion.Confirmations
+}
+
 func (c *Config) StartBlockNumber() (uint64, bool, error) {
 	if strings.ToLower(c.Ingestion.StartBlock) == "latest" {
 		return 0, true, nil
@@ -222,3 +727,39 @@ func (c *Config) StartBlockNumber() (uint64, bool, error) {
 	}
 	return v, false, nil
 }
+
+// Fingerprint identifies the settings that decide which txs end up in the
+// output. A checkpoint written under a different fingerprint is not resumed
+// unless checkpoint.allow_config_change is set.
+func (c *Config) Fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "chain_id=%d\n", c.ChainID)
+	fmt.Fprintf(h, "factory=%s\n", strings.ToLower(strings.TrimSpace(c.FactoryAddress)))
+	// Rules are only hashed when set so that existing checkpoints written
+	// before filter rules existed keep their fingerprint.
+	for _, r := range c.Filter.Rules {
+		fmt.Fprintf(h, "rule=%s|to=%s|from=%s|sel=%s|min=%s|logs=%s|topics=%s\n",
+			r.Name,
+			normalizeList(r.To),
+			normalizeList(r.From),
+			normalizeList(r.Selectors),
+			strings.TrimSpace(r.MinValueWei),
+			normalizeList(r.LogAddresses),
+			normalizeList(r.LogTopics),
+		)
+	}
+	sum := h.Sum(nil)
+	return hex.EncodeToString(sum[:8])
+}
+
+func normalizeList(values []string) string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return strings.Join(out, ",")
+}
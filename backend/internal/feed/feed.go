@@ -0,0 +1,221 @@
+// Package feed fans output records out to live subscribers.
+//
+// A Hub keeps the most recent records in a ring so that a client can resume
+// after a reconnect, either from the ID of the last event it saw or from a
+// block number. Subscribers that fall behind are dropped instead of holding
+// up the publisher; they reconnect and resume.
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"pumppilot/internal/metrics"
+	"pumppilot/internal/queue"
+)
+
+var (
+	clients = metrics.NewGauge("pumppilot_feed_clients", "Connected live feed clients.")
+	dropped = metrics.NewCounter("pumppilot_feed_clients_dropped_total", "Live feed clients dropped for falling behind.")
+)
+
+// Event is a record with its place in the feed.
+type Event struct {
+	Seq    uint64
+	Record queue.EnrichedTx
+}
+
+// Name is the kind of record: "tx", "reverted" or "block_complete".
+func (e Event) Name() string {
+	switch {
+	case e.Record.Marker != nil:
+		return queue.TypeBlockComplete
+	case e.Record.Reverted:
+		return "reverted"
+	}
+	return "tx"
+}
+
+// Filter selects records for a subscriber. Criteria that are set must all
+// match; any entry of a list is enough. Block complete markers carry no tx,
+// so they only pass without creator and token criteria.
+type Filter struct {
+	Creators []string // tx sender
+	Events   []string // decoded log event or method name, or "block_complete"
+	Tokens   []string // launched token or pool address
+}
+
+func (f Filter) Match(rec queue.EnrichedTx) bool {
+	if rec.Marker != nil {
+		return len(f.Creators) == 0 && len(f.Tokens) == 0 && (len(f.Events) == 0 || contains(f.Events, queue.TypeBlockComplete))
+	}
+	if len(f.Creators) > 0 && !contains(f.Creators, rec.From) {
+		return false
+	}
+	if len(f.Events) > 0 && !f.matchEvent(rec) {
+		return false
+	}
+	if len(f.Tokens) > 0 && !contains(f.Tokens, rec.PoolAddress) && !containsAny(f.Tokens, rec.TokenAddresses) {
+		return false
+	}
+	return true
+}
+
+func (f Filter) matchEvent(rec queue.EnrichedTx) bool {
+	if rec.Method != nil && contains(f.Events, rec.Method.Name) {
+		return true
+	}
+	for _, l := range rec.DecodedLogs {
+		if contains(f.Events, l.Event) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list, values []string) bool {
+	for _, v := range values {
+		if contains(list, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resume says where in the ring a new subscription starts.
+type Resume struct {
+	AfterSeq  uint64 // events after this sequence number
+	FromBlock uint64 // records of this block and later
+}
+
+// Hub keeps the last records published and the live subscriptions.
+type Hub struct {
+	// epoch tells IDs of this process apart from those of an earlier run,
+	// whose sequence numbers mean nothing here.
+	epoch        int64
+	clientBuffer int
+
+	mu   sync.Mutex
+	seq  uint64
+	ring []Event
+	head int
+	size int
+	subs map[*Subscription]struct{}
+}
+
+func NewHub(buffer, clientBuffer int) *Hub {
+	return &Hub{
+		epoch:        time.Now().UnixMilli(),
+		clientBuffer: clientBuffer,
+		ring:         make([]Event, 0, buffer),
+		size:         buffer,
+		subs:         map[*Subscription]struct{}{},
+	}
+}
+
+// Publish adds rec to the ring and hands it to every matching subscriber.
+// A subscriber whose queue is full is closed.
+func (h *Hub) Publish(rec queue.EnrichedTx) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev := Event{Seq: h.seq, Record: rec}
+	if len(h.ring) < h.size {
+		h.ring = append(h.ring, ev)
+	} else {
+		h.ring[h.head] = ev
+		h.head = (h.head + 1) % h.size
+	}
+	for sub := range h.subs {
+		if !sub.filter.Match(rec) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			h.removeLocked(sub)
+			dropped.With().Inc()
+		}
+	}
+}
+
+// Subscription delivers Backlog first and then the records on C. C is
+// closed when the subscriber falls behind or is closed.
+type Subscription struct {
+	Backlog []Event
+	C       <-chan Event
+
+	hub    *Hub
+	filter Filter
+	ch     chan Event
+}
+
+// Subscribe registers a subscriber. With from set, the backlog holds the
+// records in the ring that match f and lie after from; records older than
+// the ring are gone. Without, the subscriber starts with the next record.
+func (h *Hub) Subscribe(f Filter, from *Resume) *Subscription {
+	ch := make(chan Event, h.clientBuffer)
+	sub := &Subscription{C: ch, hub: h, filter: f, ch: ch}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if from != nil {
+		for i := range h.ring {
+			ev := h.ring[(h.head+i)%len(h.ring)]
+			if ev.Seq > from.AfterSeq && ev.Record.BlockNumber >= from.FromBlock && f.Match(ev.Record) {
+				sub.Backlog = append(sub.Backlog, ev)
+			}
+		}
+	}
+	h.subs[sub] = struct{}{}
+	clients.With().Set(float64(len(h.subs)))
+	return sub
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.removeLocked(s)
+}
+
+func (h *Hub) removeLocked(sub *Subscription) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	close(sub.ch)
+	clients.With().Set(float64(len(h.subs)))
+}
+
+// ID names an event for clients as "<block>-<epoch>-<seq>".
+func (h *Hub) ID(ev Event) string {
+	return fmt.Sprintf("%d-%d-%d", ev.Record.BlockNumber, h.epoch, ev.Seq)
+}
+
+// ResumeAfter turns the ID of the last event a client saw into a Resume.
+// An ID from an earlier run resumes from its block, which may repeat some
+// records of that block.
+func (h *Hub) ResumeAfter(id string) (Resume, error) {
+	var block, epoch, seq uint64
+	if _, err := fmt.Sscanf(id, "%d-%d-%d", &block, &epoch, &seq); err != nil {
+		return Resume{}, errors.New("invalid event id")
+	}
+	if int64(epoch) != h.epoch {
+		return Resume{FromBlock: block}, nil
+	}
+	return Resume{AfterSeq: seq}, nil
+}
@@ -0,0 +1,80 @@
+package feed
+
+import (
+	"testing"
+
+	"pumppilot/internal/queue"
+)
+
+func TestFilterMatch(t *testing.T) {
+	rec := queue.EnrichedTx{
+		From:           "0xAbC",
+		DecodedLogs:    []queue.DecodedLog{{Event: "PoolCreated"}},
+		TokenAddresses: []string{"0xT1"},
+	}
+	marker := queue.EnrichedTx{Marker: &queue.BlockComplete{Type: queue.TypeBlockComplete}}
+	cases := []struct {
+		f            Filter
+		rec, markerW bool
+	}{
+		{Filter{}, true, true},
+		{Filter{Creators: []string{"0xabc"}}, true, false},
+		{Filter{Creators: []string{"0xdef"}}, false, false},
+		{Filter{Events: []string{"poolcreated", "Swap"}}, true, false},
+		{Filter{Events: []string{"block_complete"}}, false, true},
+		{Filter{Tokens: []string{"0xt1"}, Events: []string{"PoolCreated"}}, true, false},
+		{Filter{Tokens: []string{"0xt2"}}, false, false},
+	}
+	for i, c := range cases {
+		if got := c.f.Match(rec); got != c.rec {
+			t.Errorf("case %d: record match %v, want %v", i, got, c.rec)
+		}
+		if got := c.f.Match(marker); got != c.markerW {
+			t.Errorf("case %d: marker match %v, want %v", i, got, c.markerW)
+		}
+	}
+}
+
+func TestHubResumeAndSlowClient(t *testing.T) {
+	h := NewHub(3, 1)
+	for b := uint64(1); b <= 4; b++ {
+		h.Publish(queue.EnrichedTx{BlockNumber: b})
+	}
+	// The ring holds blocks 2 to 4.
+	sub := h.Subscribe(Filter{}, &Resume{FromBlock: 1})
+	if len(sub.Backlog) != 3 || sub.Backlog[0].Record.BlockNumber != 2 {
+		t.Fatalf("backlog %+v", sub.Backlog)
+	}
+	from, err := h.ResumeAfter(h.ID(sub.Backlog[1]))
+	if err != nil || from.AfterSeq != 3 {
+		t.Fatalf("resume %+v %v", from, err)
+	}
+	if again := h.Subscribe(Filter{}, &from); len(again.Backlog) != 1 || again.Backlog[0].Record.BlockNumber != 4 {
+		t.Fatalf("resumed backlog %+v", again.Backlog)
+	}
+	if old, _ := h.ResumeAfter("7-1-3"); old.FromBlock != 7 || old.AfterSeq != 0 {
+		t.Fatalf("id of an earlier run resumed as %+v", old)
+	}
+
+	// A client queue of one overflows on the second record.
+	h.Publish(queue.EnrichedTx{BlockNumber: 5})
+	h.Publish(queue.EnrichedTx{BlockNumber: 6})
+	if ev := <-sub.C; ev.Record.BlockNumber != 5 {
+		t.Fatalf("got block %d", ev.Record.BlockNumber)
+	}
+	if _, ok := <-sub.C; ok {
+		t.Fatal("slow subscriber was not closed")
+	}
+	sub.Close()
+}
+
+func TestDecodeLineMarker(t *testing.T) {
+	rec, err := decodeLine([]byte(`{"type":"block_complete","chain":"base","block_number":9,"block_hash":"0x9","tx_count":2}`))
+	if err != nil || rec.Marker == nil || rec.BlockNumber != 9 || rec.Marker.TxCount != 2 {
+		t.Fatalf("marker %+v %v", rec, err)
+	}
+	rec, err = decodeLine([]byte(`{"type":2,"block_number":9,"tx_hash":"0x1"}`))
+	if err != nil || rec.Marker != nil || rec.TxHash != "0x1" {
+		t.Fatalf("record %+v %v", rec, err)
+	}
+}
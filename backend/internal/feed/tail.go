@@ -0,0 +1,188 @@
+package feed
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"pumppilot/internal/queue"
+)
+
+// seedBytes is how much of the end of the file Tail reads on start, to fill
+// the hub's ring for clients that resume.
+const seedBytes = 8 << 20
+
+const tailPoll = 250 * time.Millisecond
+
+// Tail follows the JSONL output file at path and passes its records to
+// publish until ctx is done. A file rotated away is read to its end before
+// the new one is opened. When the file shrinks, as the exactly-once writer
+// cuts it back on start, Tail goes on from the new end.
+func Tail(ctx context.Context, logger *slog.Logger, path string, publish func(queue.EnrichedTx)) error {
+	t := &tailer{logger: logger, path: path, publish: publish}
+	defer t.close()
+	ticker := time.NewTicker(tailPoll)
+	defer ticker.Stop()
+	seed := true
+	for {
+		if t.file == nil {
+			err := t.open(seed)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if err == nil {
+				seed = false
+				logger.Info("feed following output", "path", path, "offset", t.offset)
+			}
+		}
+		if t.file != nil {
+			if err := t.follow(); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case <-ticker.C:
+		}
+	}
+}
+
+type tailer struct {
+	logger  *slog.Logger
+	path    string
+	publish func(queue.EnrichedTx)
+
+	file    *os.File
+	info    os.FileInfo
+	r       *bufio.Reader
+	offset  int64
+	partial []byte
+	// skip drops the line cut by a seek into the middle of the file.
+	skip bool
+}
+
+func (t *tailer) open(seed bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	var start int64
+	if seed && info.Size() > seedBytes {
+		start = info.Size() - seedBytes
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	t.file, t.info, t.offset, t.partial, t.skip = f, info, start, nil, start > 0
+	t.r = bufio.NewReaderSize(f, 64<<10)
+	return nil
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// follow publishes the complete lines added since the last call and then
+// checks whether the file was rotated or cut back.
+func (t *tailer) follow() error {
+	if err := t.read(); err != nil {
+		return err
+	}
+	info, err := os.Stat(t.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case !os.SameFile(info, t.info):
+		// The writer is done with the old file once it is renamed.
+		if err := t.read(); err != nil {
+			return err
+		}
+		t.close()
+	case info.Size() < t.offset:
+		if _, err := t.file.Seek(info.Size(), io.SeekStart); err != nil {
+			return err
+		}
+		t.r.Reset(t.file)
+		t.offset, t.partial, t.skip = info.Size(), nil, false
+	}
+	return nil
+}
+
+func (t *tailer) read() error {
+	for {
+		line, err := t.r.ReadBytes('\n')
+		t.offset += int64(len(line))
+		if errors.Is(err, io.EOF) {
+			t.partial = append(t.partial, line...)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if t.partial != nil {
+			line = append(t.partial, line...)
+			t.partial = nil
+		}
+		if t.skip {
+			t.skip = false
+			continue
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		rec, err := decodeLine(line)
+		if err != nil {
+			t.logger.Warn("feed skipped bad line", "path", t.path, "offset", t.offset, "error", err)
+			continue
+		}
+		t.publish(rec)
+	}
+}
+
+// decodeLine reads a record or a block complete marker. Records have a
+// numeric tx type where markers have the string "block_complete".
+func decodeLine(line []byte) (queue.EnrichedTx, error) {
+	var probe struct {
+		Type json.RawMessage `json:"type"`
+	}
+	if err := json.Unmarshal(line, &probe); err != nil {
+		return queue.EnrichedTx{}, err
+	}
+	if string(probe.Type) == `"`+queue.TypeBlockComplete+`"` {
+		var m queue.BlockComplete
+		if err := json.Unmarshal(line, &m); err != nil {
+			return queue.EnrichedTx{}, err
+		}
+		return queue.EnrichedTx{
+			Tier:           m.Tier,
+			Chain:          m.Chain,
+			ChainID:        m.ChainID,
+			BlockNumber:    m.BlockNumber,
+			BlockHash:      m.BlockHash,
+			BlockTimestamp: m.BlockTimestamp,
+			Marker:         &m,
+		}, nil
+	}
+	var rec queue.EnrichedTx
+	err := json.Unmarshal(line, &rec)
+	return rec, err
+}
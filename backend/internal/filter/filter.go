@@ -0,0 +1,260 @@
+package filter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/util"
+)
+
+// DefaultRule is the name of the rule used when filter.rules is empty. It
+// keeps the old behaviour of following the factory address only.
+const DefaultRule = "factory"
+
+// Engine decides which txs go to the output and which rules they matched.
+type Engine struct {
+	rules     []rule
+	logsMode  bool
+	logAddrs  []common.Address
+	needsLogs bool
+}
+
+type rule struct {
+	name      string
+	to        map[common.Address]struct{}
+	from      map[common.Address]struct{}
+	selectors map[[4]byte]struct{}
+	minValue  *big.Int
+	logAddrs  map[common.Address]struct{}
+	logTopics map[common.Hash]struct{}
+}
+
+func New(cfg config.Config) (*Engine, error) {
+	rules := cfg.Filter.Rules
+	if len(rules) == 0 {
+		rules = []config.FilterRule{{Name: DefaultRule, To: []string{cfg.FactoryAddress}}}
+	}
+	e := &Engine{logsMode: cfg.Ingestion.Mode == config.IngestionModeLogs}
+	names := map[string]bool{}
+	seen := map[common.Address]bool{}
+	for i, rc := range rules {
+		r, err := parseRule(rc, i)
+		if err != nil {
+			return nil, err
+		}
+		if names[r.name] {
+			return nil, fmt.Errorf("filter rule %q defined twice", r.name)
+		}
+		names[r.name] = true
+		if e.logsMode && len(r.to) == 0 && len(r.logAddrs) == 0 {
+			return nil, fmt.Errorf("filter rule %q: logs ingestion needs to or log_addresses", r.name)
+		}
+		if len(r.logAddrs) > 0 {
+			e.needsLogs = true
+		}
+		watched := r.logAddrs
+		if e.logsMode {
+			watched = union(r.to, r.logAddrs)
+		}
+		for addr := range watched {
+			if !seen[addr] {
+				seen[addr] = true
+				e.logAddrs = append(e.logAddrs, addr)
+			}
+		}
+		e.rules = append(e.rules, r)
+	}
+	return e, nil
+}
+
+// Match returns the names of the rules tx satisfies, in config order. logs
+// are the tx's logs emitted by LogAddresses; they may be nil when no rule
+// looks at logs.
+func (e *Engine) Match(tx *queue.RawTx, logs []*types.Log) []string {
+	if tx == nil {
+		return nil
+	}
+	var matched []string
+	for i := range e.rules {
+		if e.rules[i].match(tx, logs, e.logsMode) {
+			matched = append(matched, e.rules[i].name)
+		}
+	}
+	return matched
+}
+
+// NeedsLogs reports whether block ingestion has to fetch logs for the rules.
+func (e *Engine) NeedsLogs() bool {
+	return e.needsLogs
+}
+
+// LogAddresses are the contracts whose logs the rules look at. In logs
+// ingestion mode this includes the to addresses, since the log query is
+// what finds the txs in the first place.
+func (e *Engine) LogAddresses() []common.Address {
+	return e.logAddrs
+}
+
+func (r *rule) match(tx *queue.RawTx, logs []*types.Log, logsMode bool) bool {
+	if len(r.to) > 0 && !r.matchTo(tx, logs, logsMode) {
+		return false
+	}
+	if len(r.from) > 0 && !contains(r.from, tx.From) {
+		return false
+	}
+	if len(r.selectors) > 0 {
+		input, err := hex.DecodeString(strings.TrimPrefix(tx.Input, "0x"))
+		if err != nil || len(input) < 4 {
+			return false
+		}
+		if _, ok := r.selectors[[4]byte(input[:4])]; !ok {
+			return false
+		}
+	}
+	if r.minValue != nil {
+		v, ok := new(big.Int).SetString(tx.ValueWei, 10)
+		if !ok || v.Cmp(r.minValue) < 0 {
+			return false
+		}
+	}
+	if len(r.logAddrs) > 0 && !r.matchLogs(logs) {
+		return false
+	}
+	return true
+}
+
+// matchTo also accepts txs sent through a router when the target contract
+// emitted a log, which is how the logs ingestion mode finds them.
+func (r *rule) matchTo(tx *queue.RawTx, logs []*types.Log, logsMode bool) bool {
+	if contains(r.to, tx.To) {
+		return true
+	}
+	if !logsMode {
+		return false
+	}
+	for _, l := range logs {
+		if _, ok := r.to[l.Address]; ok && !l.Removed {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) matchLogs(logs []*types.Log) bool {
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+		if _, ok := r.logAddrs[l.Address]; !ok {
+			continue
+		}
+		if len(r.logTopics) == 0 {
+			return true
+		}
+		if len(l.Topics) > 0 {
+			if _, ok := r.logTopics[l.Topics[0]]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseRule(rc config.FilterRule, index int) (rule, error) {
+	r := rule{name: strings.TrimSpace(rc.Name)}
+	if r.name == "" {
+		r.name = fmt.Sprintf("rule%d", index+1)
+	}
+	var err error
+	if r.to, err = parseAddresses(rc.To); err != nil {
+		return r, fmt.Errorf("filter rule %q to: %w", r.name, err)
+	}
+	if r.from, err = parseAddresses(rc.From); err != nil {
+		return r, fmt.Errorf("filter rule %q from: %w", r.name, err)
+	}
+	if r.logAddrs, err = parseAddresses(rc.LogAddresses); err != nil {
+		return r, fmt.Errorf("filter rule %q log_addresses: %w", r.name, err)
+	}
+	r.selectors = map[[4]byte]struct{}{}
+	for _, s := range rc.Selectors {
+		sel, err := util.Selector(s)
+		if err != nil {
+			return r, fmt.Errorf("filter rule %q selectors: %w", r.name, err)
+		}
+		r.selectors[sel] = struct{}{}
+	}
+	r.logTopics = map[common.Hash]struct{}{}
+	for _, s := range rc.LogTopics {
+		topic, err := parseTopic(s)
+		if err != nil {
+			return r, fmt.Errorf("filter rule %q log_topics: %w", r.name, err)
+		}
+		r.logTopics[topic] = struct{}{}
+	}
+	if len(r.logTopics) > 0 && len(r.logAddrs) == 0 {
+		return r, fmt.Errorf("filter rule %q: log_topics needs log_addresses", r.name)
+	}
+	if v := strings.TrimSpace(rc.MinValueWei); v != "" {
+		min, ok := new(big.Int).SetString(v, 10)
+		if !ok || min.Sign() < 0 {
+			return r, fmt.Errorf("filter rule %q: invalid min_value_wei %q", r.name, v)
+		}
+		r.minValue = min
+	}
+	if len(r.to)+len(r.from)+len(r.selectors)+len(r.logAddrs) == 0 && r.minValue == nil {
+		return r, fmt.Errorf("filter rule %q has no criteria", r.name)
+	}
+	return r, nil
+}
+
+func parseAddresses(values []string) (map[common.Address]struct{}, error) {
+	out := map[common.Address]struct{}{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !common.IsHexAddress(v) {
+			return nil, fmt.Errorf("invalid address %q", v)
+		}
+		out[common.HexToAddress(v)] = struct{}{}
+	}
+	return out, nil
+}
+
+// parseTopic takes either a 32-byte hex topic or an event signature.
+func parseTopic(s string) (common.Hash, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "(") {
+		return crypto.Keccak256Hash([]byte(strings.ReplaceAll(s, " ", ""))), nil
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("invalid topic %q", s)
+	}
+	return common.BytesToHash(b), nil
+}
+
+func contains(set map[common.Address]struct{}, addr string) bool {
+	if !common.IsHexAddress(addr) {
+		return false
+	}
+	_, ok := set[common.HexToAddress(addr)]
+	return ok
+}
+
+func union(a, b map[common.Address]struct{}) map[common.Address]struct{} {
+	out := make(map[common.Address]struct{}, len(a)+len(b))
+	for k := range a {
+		out[k] = struct{}{}
+	}
+	for k := range b {
+		out[k] = struct{}{}
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+const (
+	factory  = "0x07DFAEC8e182C5eF79844ADc70708C1c15aA60fb"
+	router   = "0x1111111111111111111111111111111111111111"
+	deployer = "0x2222222222222222222222222222222222222222"
+)
+
+func TestEngineMatchesRules(t *testing.T) {
+	cfg := config.Config{FactoryAddress: factory}
+	cfg.Ingestion.Mode = config.IngestionModeBlocks
+	cfg.Filter.Rules = []config.FilterRule{
+		{Name: "factory", To: []string{factory}},
+		{Name: "deployer", From: []string{deployer}, Selectors: []string{"createToken(string,string)"}, MinValueWei: "1000"},
+		{Name: "routed", LogAddresses: []string{factory}, LogTopics: []string{"PoolCreated(address,address,address)"}},
+	}
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.NeedsLogs() || len(e.LogAddresses()) != 1 {
+		t.Fatalf("unexpected log addresses %v", e.LogAddresses())
+	}
+
+	sel := common.Bytes2Hex(crypto.Keccak256([]byte("createToken(string,string)"))[:4])
+	direct := &queue.RawTx{To: factory, From: deployer, Input: "0x" + sel, ValueWei: "5000"}
+	if got := e.Match(direct, nil); !reflect.DeepEqual(got, []string{"factory", "deployer"}) {
+		t.Fatalf("direct tx matched %v", got)
+	}
+	cheap := &queue.RawTx{To: router, From: deployer, Input: "0x" + sel, ValueWei: "999"}
+	if got := e.Match(cheap, nil); got != nil {
+		t.Fatalf("tx below min value matched %v", got)
+	}
+
+	routed := &queue.RawTx{To: router, From: deployer, Input: "0xdeadbeef", ValueWei: "0"}
+	event := &types.Log{
+		Address: common.HexToAddress(factory),
+		Topics:  []common.Hash{crypto.Keccak256Hash([]byte("PoolCreated(address,address,address)"))},
+	}
+	if got := e.Match(routed, []*types.Log{event}); !reflect.DeepEqual(got, []string{"routed"}) {
+		t.Fatalf("routed tx matched %v", got)
+	}
+	other := &types.Log{Address: common.HexToAddress(factory), Topics: []common.Hash{{1}}}
+	if got := e.Match(routed, []*types.Log{other}); got != nil {
+		t.Fatalf("routed tx with other event matched %v", got)
+	}
+}
+
+func TestEngineLogsModeMatchesToThroughLogs(t *testing.T) {
+	cfg := config.Config{FactoryAddress: factory}
+	cfg.Ingestion.Mode = config.IngestionModeLogs
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routed := &queue.RawTx{To: router, Input: "0x"}
+	if got := e.Match(routed, []*types.Log{{Address: common.HexToAddress(factory)}}); !reflect.DeepEqual(got, []string{DefaultRule}) {
+		t.Fatalf("routed tx matched %v", got)
+	}
+
+	cfg.Filter.Rules = []config.FilterRule{{Name: "senders", From: []string{deployer}}}
+	if _, err := New(cfg); err == nil {
+		t.Fatal("rule without addresses should be rejected in logs mode")
+	}
+}
+
+func TestFingerprintIgnoresEmptyRules(t *testing.T) {
+	cfg := config.Config{ChainID: 8453, FactoryAddress: factory}
+	base := cfg.Fingerprint()
+	cfg.Filter.Rules = []config.FilterRule{{Name: "factory", To: []string{factory}}}
+	if cfg.Fingerprint() == base {
+		t.Fatal("rules should change the fingerprint")
+	}
+	cfg.Filter.Rules = nil
+	if cfg.Fingerprint() != base {
+		t.Fatal("fingerprint changed without rules")
+	}
+}
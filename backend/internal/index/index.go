@@ -0,0 +1,242 @@
+// Package index keeps launch records in an embedded SQLite database so the
+// API can answer queries by token, deployer, block and time. Records of txs
+// into launched pools are kept as well, for deployer profiles.
+//
+// The output file stays the source of truth. Launches are added as the
+// records are produced, and CatchUp reads the output files on start for
+// what was written while the index was not running. Adding a record twice
+// is harmless, and its reverted copy deletes it again.
+package index
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"pumppilot/internal/output"
+	"pumppilot/internal/queue"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS launches (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	token_address   TEXT    NOT NULL,
+	pool_address    TEXT    NOT NULL,
+	deployer        TEXT    NOT NULL,
+	tx_hash         TEXT    NOT NULL,
+	block_hash      TEXT    NOT NULL,
+	block_number    INTEGER NOT NULL,
+	block_timestamp INTEGER NOT NULL,
+	name            TEXT    NOT NULL,
+	symbol          TEXT    NOT NULL,
+	uri             TEXT    NOT NULL,
+	alpha           TEXT    NOT NULL,
+	record          TEXT    NOT NULL,
+	UNIQUE (tx_hash, block_hash, token_address)
+);
+CREATE INDEX IF NOT EXISTS launches_block ON launches (block_number, id);
+CREATE INDEX IF NOT EXISTS launches_time ON launches (block_timestamp);
+CREATE INDEX IF NOT EXISTS launches_token ON launches (token_address);
+CREATE INDEX IF NOT EXISTS launches_pool ON launches (pool_address);
+CREATE INDEX IF NOT EXISTS launches_deployer ON launches (deployer, block_number);
+
+CREATE TABLE IF NOT EXISTS pool_txs (
+	pool_address    TEXT    NOT NULL,
+	tx_hash         TEXT    NOT NULL,
+	block_hash      TEXT    NOT NULL,
+	block_number    INTEGER NOT NULL,
+	block_timestamp INTEGER NOT NULL,
+	trader          TEXT    NOT NULL,
+	side            TEXT    NOT NULL,
+	value_wei       TEXT    NOT NULL,
+	PRIMARY KEY (tx_hash, block_hash, pool_address)
+);
+CREATE INDEX IF NOT EXISTS pool_txs_pool ON pool_txs (pool_address, block_timestamp);
+
+CREATE TABLE IF NOT EXISTS state (
+	key   TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`
+
+// Index is safe for concurrent use.
+type Index struct {
+	logger *slog.Logger
+	db     *sql.DB
+	// margin is how far below the highest block CatchUp starts, so that
+	// reverted copies of recent launches are seen again.
+	margin uint64
+}
+
+func Open(logger *slog.Logger, path string, reorgWindow uint64) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Index{logger: logger, db: db, margin: reorgWindow}, nil
+}
+
+func (x *Index) Close() error {
+	return x.db.Close()
+}
+
+// Add indexes rec if it is a launch, one row per token it names, or if it
+// is a tx into the pool of an indexed launch. Other records are ignored.
+func (x *Index) Add(ctx context.Context, rec queue.EnrichedTx) error {
+	if rec.Marker != nil {
+		return nil
+	}
+	var pools []string
+	if !rec.IsLaunch() {
+		var err error
+		if pools, err = x.knownPools(ctx, rec); err != nil || len(pools) == 0 {
+			return err
+		}
+	}
+	tx, err := x.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if pools == nil {
+		err = addLaunch(ctx, tx, rec)
+	} else {
+		err = addPoolTx(ctx, tx, rec, pools)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO state (key, value) VALUES ('last_block', ?) ON CONFLICT (key) DO UPDATE SET value = MAX(value, excluded.value)`,
+		rec.BlockNumber,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addLaunch(ctx context.Context, tx *sql.Tx, rec queue.EnrichedTx) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM launches WHERE tx_hash = ? AND block_hash = ?`, rec.TxHash, rec.BlockHash); err != nil {
+		return err
+	}
+	if rec.Reverted {
+		return nil
+	}
+	record, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	var args map[string]interface{}
+	if rec.Method != nil {
+		args = rec.Method.Args
+	}
+	tokens := rec.TokenAddresses
+	if len(tokens) == 0 {
+		// A createToken call without an event mapping names no token.
+		tokens = []string{""}
+	}
+	for _, token := range tokens {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO launches (token_address, pool_address, deployer, tx_hash, block_hash, block_number, block_timestamp, name, symbol, uri, alpha, record)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			strings.ToLower(token), strings.ToLower(rec.PoolAddress), strings.ToLower(rec.From), rec.TxHash, rec.BlockHash, rec.BlockNumber, rec.BlockTimestamp,
+			arg(args, "_name"), arg(args, "_symbol"), arg(args, "_uri"), arg(args, "_alpha"), string(record),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func arg(args map[string]interface{}, name string) string {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// LastBlock is the highest block a launch was indexed from.
+func (x *Index) LastBlock(ctx context.Context) (uint64, error) {
+	var last uint64
+	err := x.db.QueryRowContext(ctx, `SELECT value FROM state WHERE key = 'last_block'`).Scan(&last)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return last, err
+}
+
+// CatchUp reads the output at path, segments included, from a reorg window
+// below the last indexed block.
+func (x *Index) CatchUp(ctx context.Context, path string) error {
+	last, err := x.LastBlock(ctx)
+	if err != nil {
+		return err
+	}
+	from := last - min(last, x.margin)
+	files, err := output.Files(path, from)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, file := range files {
+		n, err := x.catchUpFile(ctx, file, from)
+		if err != nil {
+			return fmt.Errorf("index %s: %w", file, err)
+		}
+		added += n
+	}
+	x.logger.Info("index caught up", "path", path, "from_block", from, "files", len(files), "records", added)
+	return nil
+}
+
+func (x *Index) catchUpFile(ctx context.Context, file string, from uint64) (int, error) {
+	r, err := output.Open(file)
+	for _, suffix := range []string{".gz", ".zst"} {
+		if os.IsNotExist(err) {
+			// Compressed since it was listed, or else pruned.
+			r, err = output.Open(file + suffix)
+		}
+	}
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	added := 0
+	for sc.Scan() {
+		if err := ctx.Err(); err != nil {
+			return added, err
+		}
+		var rec queue.EnrichedTx
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil || rec.BlockNumber <= from {
+			// Block markers have a string type and fail here too.
+			continue
+		}
+		if err := x.Add(ctx, rec); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, sc.Err()
+}
@@ -0,0 +1,166 @@
+package index
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pumppilot/internal/queue"
+)
+
+func launch(block uint64, tx, deployer, token, name string) queue.EnrichedTx {
+	return queue.EnrichedTx{
+		BlockNumber:    block,
+		BlockHash:      "0xb" + tx,
+		BlockTimestamp: 1000 + block,
+		TxHash:         tx,
+		From:           deployer,
+		Method:         &queue.DecodedMethod{Name: "createToken", Args: map[string]interface{}{"_name": name, "_symbol": "SYM", "_alpha": "42"}},
+		PoolAddress:    "0xP" + tx,
+		TokenAddresses: []string{token},
+	}
+}
+
+func TestLaunchQueries(t *testing.T) {
+	x, err := Open(slog.Default(), filepath.Join(t.TempDir(), "index.db"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	ctx := context.Background()
+	recs := []queue.EnrichedTx{
+		launch(1, "0x1", "0xAAA", "0xT1", "Moon Dog"),
+		launch(2, "0x2", "0xBBB", "0xT2", "Cat"),
+		launch(3, "0x3", "0xAAA", "0xT3", "Dog 2"),
+		{BlockNumber: 3, TxHash: "0x9", From: "0xAAA"}, // not a launch
+	}
+	for _, rec := range recs {
+		if err := x.Add(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := x.Launches(ctx, Query{Deployer: "0xaaa", Name: "dog", Limit: 1})
+	if err != nil || len(page.Launches) != 1 || page.Launches[0].TxHash != "0x3" || page.Next == "" {
+		t.Fatalf("first page %+v %v", page, err)
+	}
+	page, err = x.Launches(ctx, Query{Deployer: "0xaaa", Name: "dog", Limit: 1, Cursor: page.Next})
+	if err != nil || len(page.Launches) != 1 || page.Launches[0].TxHash != "0x1" || page.Next != "" {
+		t.Fatalf("second page %+v %v", page, err)
+	}
+	if page.Launches[0].Alpha != "42" || page.Launches[0].TokenAddress != "0xt1" {
+		t.Fatalf("launch %+v", page.Launches[0])
+	}
+	if page, _ := x.Launches(ctx, Query{Since: 1002, ToBlock: 2, Limit: 10}); len(page.Launches) != 1 || page.Launches[0].TxHash != "0x2" {
+		t.Fatalf("range %+v", page)
+	}
+
+	reverted := recs[1]
+	reverted.Reverted = true
+	if err := x.Add(ctx, reverted); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := x.Launch(ctx, "0xT2"); err != nil || l != nil {
+		t.Fatalf("reverted launch still indexed: %+v %v", l, err)
+	}
+	if last, _ := x.LastBlock(ctx); last != 3 {
+		t.Fatalf("last block %d", last)
+	}
+}
+
+func TestCatchUpReadsSegments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "output.jsonl")
+	write := func(name string, gz bool, recs ...queue.EnrichedTx) {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var enc *json.Encoder
+		if gz {
+			zw := gzip.NewWriter(f)
+			defer zw.Close()
+			enc = json.NewEncoder(zw)
+		} else {
+			enc = json.NewEncoder(f)
+		}
+		for _, rec := range recs {
+			enc.Encode(rec)
+		}
+	}
+	write("output-1-5.jsonl.gz", true, launch(2, "0x2", "0xA", "0xT2", "a"))
+	marker := queue.EnrichedTx{Marker: &queue.BlockComplete{Type: queue.TypeBlockComplete, BlockNumber: 6}}
+	gone := launch(6, "0x6", "0xA", "0xT6", "b")
+	gone.Reverted = true
+	write("output.jsonl", false, launch(6, "0x6", "0xA", "0xT6", "b"), marker, gone, launch(7, "0x7", "0xA", "0xT7", "c"))
+
+	x, err := Open(slog.Default(), filepath.Join(dir, "index.db"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	if err := x.CatchUp(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	page, err := x.Launches(context.Background(), Query{Limit: 10})
+	if err != nil || len(page.Launches) != 2 || page.Launches[0].TxHash != "0x7" || page.Launches[1].TxHash != "0x2" {
+		t.Fatalf("caught up %+v %v", page, err)
+	}
+}
+
+func TestDeployerProfile(t *testing.T) {
+	x, err := Open(slog.Default(), filepath.Join(t.TempDir(), "index.db"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	ctx := context.Background()
+	trade := func(block uint64, tx, trader, pool, input string) queue.EnrichedTx {
+		return queue.EnrichedTx{BlockNumber: block, BlockHash: "0xb" + tx, BlockTimestamp: 1000 + block, TxHash: tx, From: trader, To: pool, Input: input}
+	}
+	recs := []queue.EnrichedTx{
+		launch(10, "0x1", "0xAAA", "0xT1", "One"),
+		trade(11, "0x2", "0xCCC", "0xP0x1", "0xd6febde8"),
+		trade(15, "0x3", "0xAAA", "0xp0x1", "0xd3c9727c"),
+		launch(40, "0x4", "0xAAA", "0xT2", "Two"),
+		trade(41, "0x5", "0xAAA", "0xP0x4", "0xd3c9727c"),
+		launch(100, "0x6", "0xAAA", "0xT3", "Three"),
+		trade(101, "0x7", "0xCCC", "0xP0x6", "0xd6febde8"),
+		trade(102, "0x8", "0xCCC", "0xP0x99", "0xd6febde8"), // unknown pool
+	}
+	for _, rec := range recs {
+		if err := x.Add(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := x.Profile(ctx, "0xaaa", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Launches != 2 || p.FirstLaunchAt != 1010 || p.LastLaunchAt != 1040 || p.AvgSecondsBetweenLaunches != 30 {
+		t.Fatalf("launches %+v", p)
+	}
+	if p.WithLiquidity != 1 || p.WithTrades != 1 || p.DeployerSold != 2 || p.AvgSecondsToSell != 3 || *p.MinSecondsToSell != 1 {
+		t.Fatalf("activity %+v", p)
+	}
+
+	// The buy into the first pool is reorged out.
+	reverted := recs[1]
+	reverted.Reverted = true
+	if err := x.Add(ctx, reverted); err != nil {
+		t.Fatal(err)
+	}
+	p, err = x.Profile(ctx, "0xAAA", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Launches != 3 || *p.MinSecondsBetweenLaunches != 30 || p.WithLiquidity != 1 || p.WithTrades != 1 {
+		t.Fatalf("after revert %+v", p)
+	}
+}
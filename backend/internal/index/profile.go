@@ -0,0 +1,226 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"pumppilot/internal/queue"
+)
+
+// Selectors of the pair's buy and sell, as built by txbuilder.
+const (
+	selectorBuy  = "0xd6febde8"
+	selectorSell = "0xd3c9727c"
+)
+
+const (
+	sideBuy   = "buy"
+	sideSell  = "sell"
+	sideOther = "other"
+)
+
+// knownPools returns the launched pools rec sent to or that emitted one of
+// its logs.
+func (x *Index) knownPools(ctx context.Context, rec queue.EnrichedTx) ([]string, error) {
+	seen := map[string]bool{}
+	var candidates []interface{}
+	add := func(addr string) {
+		addr = strings.ToLower(addr)
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			candidates = append(candidates, addr)
+		}
+	}
+	add(rec.To)
+	for _, l := range rec.DecodedLogs {
+		add(l.Address)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	rows, err := x.db.QueryContext(ctx,
+		`SELECT DISTINCT pool_address FROM launches WHERE pool_address IN (?`+strings.Repeat(", ?", len(candidates)-1)+`)`,
+		candidates...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pools []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		pools = append(pools, p)
+	}
+	return pools, rows.Err()
+}
+
+func addPoolTx(ctx context.Context, tx *sql.Tx, rec queue.EnrichedTx, pools []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM pool_txs WHERE tx_hash = ? AND block_hash = ?`, rec.TxHash, rec.BlockHash); err != nil {
+		return err
+	}
+	if rec.Reverted || (rec.Receipt != nil && rec.Receipt.Status == 0) {
+		return nil
+	}
+	side := sideOf(rec)
+	for _, pool := range pools {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO pool_txs (pool_address, tx_hash, block_hash, block_number, block_timestamp, trader, side, value_wei) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			pool, rec.TxHash, rec.BlockHash, rec.BlockNumber, rec.BlockTimestamp, strings.ToLower(rec.From), side, rec.ValueWei,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sideOf(rec queue.EnrichedTx) string {
+	switch {
+	case strings.HasPrefix(strings.ToLower(rec.Input), selectorBuy):
+		return sideBuy
+	case strings.HasPrefix(strings.ToLower(rec.Input), selectorSell):
+		return sideSell
+	case rec.Method != nil && strings.EqualFold(rec.Method.Name, sideBuy):
+		return sideBuy
+	case rec.Method != nil && strings.EqualFold(rec.Method.Name, sideSell):
+		return sideSell
+	}
+	return sideOther
+}
+
+// Profile sums up the launches of deployer before block before, or all of
+// them when before is 0. A launch has liquidity once anyone bought into its
+// pool, and trades once someone other than the deployer bought or sold.
+func (x *Index) Profile(ctx context.Context, deployer string, before uint64) (*queue.DeployerProfile, error) {
+	deployer = strings.ToLower(deployer)
+	if before == 0 {
+		before = 1<<63 - 1
+	}
+	type launch struct {
+		at    uint64
+		pools []string
+	}
+	var order []string
+	launches := map[string]*launch{}
+	rows, err := x.db.QueryContext(ctx,
+		`SELECT tx_hash, pool_address, block_timestamp FROM launches WHERE deployer = ? AND block_number < ? ORDER BY block_number, id`,
+		deployer, before)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var hash, pool string
+		var at uint64
+		if err := rows.Scan(&hash, &pool, &at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		l, ok := launches[hash]
+		if !ok {
+			l = &launch{at: at}
+			launches[hash] = l
+			order = append(order, hash)
+		}
+		if pool != "" {
+			l.pools = append(l.pools, pool)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	type activity struct {
+		liquidity, traded bool
+		soldAt            uint64
+	}
+	pools := map[string]*activity{}
+	rows, err = x.db.QueryContext(ctx,
+		`SELECT pool_address, trader, side, block_timestamp FROM pool_txs
+		WHERE pool_address IN (SELECT pool_address FROM launches WHERE deployer = ? AND pool_address != '') AND block_number < ?
+		ORDER BY block_number`,
+		deployer, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pool, trader, side string
+		var at uint64
+		if err := rows.Scan(&pool, &trader, &side, &at); err != nil {
+			return nil, err
+		}
+		a := pools[pool]
+		if a == nil {
+			a = &activity{}
+			pools[pool] = a
+		}
+		if side == sideBuy {
+			a.liquidity = true
+		}
+		if trader != deployer && side != sideOther {
+			a.traded = true
+		}
+		if trader == deployer && side == sideSell && a.soldAt == 0 {
+			a.soldAt = at
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	p := &queue.DeployerProfile{Deployer: deployer, Launches: len(order)}
+	var gaps, sells uint64
+	for i, hash := range order {
+		l := launches[hash]
+		if i == 0 {
+			p.FirstLaunchAt = l.at
+		} else {
+			gap := l.at - min(l.at, p.LastLaunchAt)
+			gaps += gap
+			p.MinSecondsBetweenLaunches = minPtr(p.MinSecondsBetweenLaunches, gap)
+		}
+		p.LastLaunchAt = l.at
+		var liquidity, traded bool
+		var soldAt uint64
+		for _, pool := range l.pools {
+			a := pools[pool]
+			if a == nil {
+				continue
+			}
+			liquidity = liquidity || a.liquidity
+			traded = traded || a.traded
+			if a.soldAt > 0 && (soldAt == 0 || a.soldAt < soldAt) {
+				soldAt = a.soldAt
+			}
+		}
+		if liquidity {
+			p.WithLiquidity++
+		}
+		if traded {
+			p.WithTrades++
+		}
+		if soldAt > 0 {
+			p.DeployerSold++
+			took := soldAt - min(soldAt, l.at)
+			sells += took
+			p.MinSecondsToSell = minPtr(p.MinSecondsToSell, took)
+		}
+	}
+	if p.Launches > 1 {
+		p.AvgSecondsBetweenLaunches = float64(gaps) / float64(p.Launches-1)
+	}
+	if p.DeployerSold > 0 {
+		p.AvgSecondsToSell = float64(sells) / float64(p.DeployerSold)
+	}
+	return p, nil
+}
+
+func minPtr(cur *uint64, v uint64) *uint64 {
+	if cur == nil || v < *cur {
+		return &v
+	}
+	return cur
+}
@@ -0,0 +1,173 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Launch is one token launch. Record is the output record it came from.
+type Launch struct {
+	TokenAddress   string          `json:"token_address"`
+	PoolAddress    string          `json:"pool_address,omitempty"`
+	Deployer       string          `json:"deployer"`
+	TxHash         string          `json:"tx_hash"`
+	BlockHash      string          `json:"block_hash"`
+	BlockNumber    uint64          `json:"block_number"`
+	BlockTimestamp uint64          `json:"block_timestamp"`
+	Name           string          `json:"name,omitempty"`
+	Symbol         string          `json:"symbol,omitempty"`
+	URI            string          `json:"uri,omitempty"`
+	Alpha          string          `json:"alpha,omitempty"`
+	Record         json.RawMessage `json:"record"`
+}
+
+// Query selects launches, newest first. Zero fields do not filter.
+// Addresses match in any case; Name and Symbol match a case-insensitive
+// substring.
+type Query struct {
+	Token     string
+	Pool      string
+	Deployer  string
+	Name      string
+	Symbol    string
+	URI       string
+	Alpha     string
+	FromBlock uint64
+	ToBlock   uint64
+	Since     uint64 // unix seconds
+	Until     uint64
+	Limit     int
+	// Cursor is the Next of the previous page.
+	Cursor string
+}
+
+// Page is a page of launches. Next is empty on the last page.
+type Page struct {
+	Launches []Launch `json:"launches"`
+	Next     string   `json:"next_cursor,omitempty"`
+}
+
+// ErrBadCursor is returned for a cursor that no page handed out.
+var ErrBadCursor = errors.New("invalid cursor")
+
+func (x *Index) Launches(ctx context.Context, q Query) (Page, error) {
+	var where []string
+	var args []interface{}
+	eq := func(col, v string) {
+		if v != "" {
+			where = append(where, col+" = ?")
+			args = append(args, strings.ToLower(v))
+		}
+	}
+	eq("token_address", q.Token)
+	eq("pool_address", q.Pool)
+	eq("deployer", q.Deployer)
+	if q.Name != "" {
+		where = append(where, "name LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+likeEscape(q.Name)+"%")
+	}
+	if q.Symbol != "" {
+		where = append(where, "symbol LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+likeEscape(q.Symbol)+"%")
+	}
+	if q.URI != "" {
+		where = append(where, "uri = ?")
+		args = append(args, q.URI)
+	}
+	if q.Alpha != "" {
+		where = append(where, "alpha = ?")
+		args = append(args, q.Alpha)
+	}
+	bound := func(cond string, v uint64) {
+		if v > 0 {
+			where = append(where, cond)
+			args = append(args, v)
+		}
+	}
+	bound("block_number >= ?", q.FromBlock)
+	bound("block_number <= ?", q.ToBlock)
+	bound("block_timestamp >= ?", q.Since)
+	bound("block_timestamp <= ?", q.Until)
+	if q.Cursor != "" {
+		block, id, err := parseCursor(q.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		where = append(where, "(block_number < ? OR (block_number = ? AND id < ?))")
+		args = append(args, block, block, id)
+	}
+
+	sqlText := `SELECT id, token_address, pool_address, deployer, tx_hash, block_hash, block_number, block_timestamp, name, symbol, uri, alpha, record FROM launches`
+	if len(where) > 0 {
+		sqlText += " WHERE " + strings.Join(where, " AND ")
+	}
+	// One extra row tells whether there is a next page.
+	sqlText += " ORDER BY block_number DESC, id DESC LIMIT ?"
+	args = append(args, q.Limit+1)
+	rows, err := x.db.QueryContext(ctx, sqlText, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	page := Page{Launches: make([]Launch, 0, q.Limit)}
+	var lastID int64
+	for rows.Next() {
+		if len(page.Launches) == q.Limit {
+			last := page.Launches[len(page.Launches)-1]
+			page.Next = fmt.Sprintf("%d-%d", last.BlockNumber, lastID)
+			break
+		}
+		l, id, err := scanLaunch(rows)
+		if err != nil {
+			return Page{}, err
+		}
+		page.Launches = append(page.Launches, l)
+		lastID = id
+	}
+	return page, rows.Err()
+}
+
+// Launch returns the latest launch of token, or nil.
+func (x *Index) Launch(ctx context.Context, token string) (*Launch, error) {
+	page, err := x.Launches(ctx, Query{Token: token, Limit: 1})
+	if err != nil || len(page.Launches) == 0 {
+		return nil, err
+	}
+	return &page.Launches[0], nil
+}
+
+func scanLaunch(rows *sql.Rows) (Launch, int64, error) {
+	var l Launch
+	var id int64
+	var record string
+	err := rows.Scan(&id, &l.TokenAddress, &l.PoolAddress, &l.Deployer, &l.TxHash, &l.BlockHash, &l.BlockNumber, &l.BlockTimestamp,
+		&l.Name, &l.Symbol, &l.URI, &l.Alpha, &record)
+	l.Record = json.RawMessage(record)
+	return l, id, err
+}
+
+func parseCursor(c string) (uint64, int64, error) {
+	block, id, ok := strings.Cut(c, "-")
+	if !ok {
+		return 0, 0, ErrBadCursor
+	}
+	b, err := strconv.ParseUint(block, 10, 64)
+	if err != nil {
+		return 0, 0, ErrBadCursor
+	}
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, 0, ErrBadCursor
+	}
+	return b, i, nil
+}
+
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
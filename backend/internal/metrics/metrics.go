@@ -0,0 +1,314 @@
+// Package metrics keeps counters, gauges and histograms in memory and
+// exposes them in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets suit request latencies in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type kind string
+
+const (
+	kindCounter   kind = "counter"
+	kindGauge     kind = "gauge"
+	kindHistogram kind = "histogram"
+)
+
+// Registry holds metric families. Most code uses the package level
+// functions, which register with Default.
+type Registry struct {
+	mu         sync.Mutex
+	families   map[string]*family
+	collectors []func()
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+
+	mu     sync.Mutex
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type CounterVec struct{ f *family }
+type GaugeVec struct{ f *family }
+type HistogramVec struct{ f *family }
+
+type Counter struct{ s *series }
+type Gauge struct{ s *series }
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, kindCounter, labels, nil)}
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, kindGauge, labels, nil)}
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{r.register(name, help, kindHistogram, labels, b)}
+}
+
+// OnScrape registers fn to run before every exposition, for gauges that are
+// cheaper to read on demand than to keep up to date.
+func (r *Registry) OnScrape(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, fn)
+}
+
+// register returns the existing family when the same metric is registered
+// twice, so that package level metrics survive being set up more than once.
+func (r *Registry) register(name, help string, k kind, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.kind != k || len(f.labels) != len(labels) {
+			panic(fmt.Sprintf("metrics: %s registered twice with different shapes", name))
+		}
+		return f
+	}
+	f := &family{name: name, help: help, kind: k, labels: labels, buckets: buckets, series: map[string]*series{}}
+	r.families[name] = f
+	return f
+}
+
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounter(name, help, labels...)
+}
+
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGauge(name, help, labels...)
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+func OnScrape(fn func()) {
+	Default.OnScrape(fn)
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (v *CounterVec) With(values ...string) Counter { return Counter{v.f.with(values)} }
+func (v *GaugeVec) With(values ...string) Gauge     { return Gauge{v.f.with(values)} }
+func (v *HistogramVec) With(values ...string) Histogram {
+	return Histogram{s: v.f.with(values), buckets: v.f.buckets}
+}
+
+// Reset drops all series, for gauges whose label sets come and go.
+func (v *GaugeVec) Reset() {
+	v.f.mu.Lock()
+	defer v.f.mu.Unlock()
+	v.f.series = map[string]*series{}
+}
+
+func (c Counter) Inc() { c.Add(1) }
+
+func (c Counter) Add(d float64) {
+	if d < 0 {
+		return
+	}
+	c.s.mu.Lock()
+	c.s.value += d
+	c.s.mu.Unlock()
+}
+
+func (g Gauge) Set(v float64) {
+	g.s.mu.Lock()
+	g.s.value = v
+	g.s.mu.Unlock()
+}
+
+func (h Histogram) Observe(v float64) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.s.counts[i]++
+		}
+	}
+	h.s.sum += v
+	h.s.count++
+}
+
+func (h Histogram) Since(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// WriteText writes every family in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]func(){}, r.collectors...)
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	for _, fn := range collectors {
+		fn()
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	list := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		list = append(list, s)
+	}
+	f.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Join(list[i].labels, "\xff") < strings.Join(list[j].labels, "\xff")
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	for _, s := range list {
+		s.mu.Lock()
+		labels := f.labelPairs(s.labels)
+		if f.kind != kindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, braces(labels), formatFloat(s.value))
+			s.mu.Unlock()
+			continue
+		}
+		for i, b := range f.buckets {
+			le := append(labels[:len(labels):len(labels)], `le="`+formatFloat(b)+`"`)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, braces(le), s.counts[i])
+		}
+		inf := append(labels[:len(labels):len(labels)], `le="+Inf"`)
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, braces(inf), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, braces(labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, braces(labels), s.count)
+		s.mu.Unlock()
+	}
+}
+
+func (f *family) labelPairs(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = f.labels[i] + `="` + escapeLabel(v) + `"`
+	}
+	return out
+}
+
+func braces(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+// Handler serves the registry at any path.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Serve exposes Default on addr under /metrics until ctx is done.
+func Serve(ctx context.Context, logger *slog.Logger, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		ctxTimeout, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctxTimeout)
+	}()
+	logger.Info("metrics listening", "listen", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return context.Canceled
+}
@@ -0,0 +1,371 @@
+// Package output writes pipeline records to a JSONL file exactly once.
+//
+// Records are held until their block is complete and then appended a block at
+// a time. After each append the file offset is saved with the block in a
+// checkpoint stream. On start the file is cut back to the saved offset, the
+// pipeline resumes after the saved block, and replayed records of blocks the
+// file already covers are skipped.
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"pumppilot/internal/checkpoint"
+	"pumppilot/internal/config"
+	"pumppilot/internal/metrics"
+	"pumppilot/internal/queue"
+)
+
+var (
+	recordsWritten = metrics.NewCounter("pumppilot_records_written_total", "Records written per output file.", "output")
+	recordsSkipped = metrics.NewCounter("pumppilot_records_skipped_total", "Replayed records already in an output file.", "output")
+)
+
+// Progress reports the last block whose records have all been sent to the
+// writer.
+type Progress interface {
+	Last() uint64
+}
+
+// Writer appends the values of T, which are queue.EnrichedTx or
+// queue.ConfirmedRef records, to one file.
+type Writer[T any] struct {
+	logger   *slog.Logger
+	path     string
+	fsync    string
+	interval time.Duration
+	stream   *checkpoint.Stream
+	progress Progress
+	written  func(T)
+	rot      *rotator
+
+	file *os.File
+	pos  checkpoint.Position
+	held map[uint64][]T
+	// committed is the last block whose records are all in the file, and
+	// high the highest block ever committed. Records up to skip were written
+	// by an earlier run and are dropped when replayed.
+	committed uint64
+	high      uint64
+	skip      uint64
+	dirty     bool
+	synced    time.Time
+}
+
+// NewWriter returns a writer for cfg.Output that keeps its cursor in stream
+// and commits blocks as progress passes them. written, if set, is called for
+// every record once it is in the file.
+func NewWriter[T any](logger *slog.Logger, cfg *config.Config, stream *checkpoint.Stream, progress Progress, written func(T)) *Writer[T] {
+	w := &Writer[T]{
+		logger:   logger,
+		path:     cfg.Output.JSONLPath,
+		fsync:    cfg.Output.Fsync,
+		interval: cfg.Output.FsyncInterval.Duration,
+		stream:   stream,
+		progress: progress,
+		written:  written,
+		held:     map[uint64][]T{},
+	}
+	if cfg.OutputRotates() {
+		w.rot = newRotator(logger, cfg)
+	}
+	return w
+}
+
+func (w *Writer[T]) Run(ctx context.Context, in <-chan T) error {
+	if err := w.open(); err != nil {
+		return err
+	}
+	defer w.close()
+	if w.rot != nil {
+		go w.rot.compressLoop(ctx)
+	}
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case v := <-in:
+			if err := w.handle(v); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			// Records are sent before progress moves past their block, so
+			// after reading it everything it covers is either held already
+			// or still buffered in the channel.
+			last := w.progress.Last()
+			for drained := false; !drained; {
+				select {
+				case v := <-in:
+					if err := w.handle(v); err != nil {
+						return err
+					}
+				default:
+					drained = true
+				}
+			}
+			if err := w.commit(last); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// open cuts the file back to the saved offset. Without a saved position the
+// file is taken as it is and the writer starts at the current progress.
+func (w *Writer[T]) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return err
+	}
+	if w.rot != nil {
+		if err := w.rot.load(); err != nil {
+			return fmt.Errorf("output manifest: %w", err)
+		}
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	size := info.Size()
+	pos, ok := w.stream.Position()
+	switch {
+	case !ok:
+		pos = checkpoint.Position{Offset: size}
+		w.committed = w.progress.Last()
+	case size > pos.Offset:
+		if err := f.Truncate(pos.Offset); err != nil {
+			f.Close()
+			return fmt.Errorf("output truncate: %w", err)
+		}
+		w.logger.Warn("output truncated to checkpoint", "path", w.path, "offset", pos.Offset, "removed_bytes", size-pos.Offset)
+		w.committed = w.stream.Last()
+	case size < pos.Offset:
+		// The file was rotated after the cursor was saved for the last
+		// time; the closed segment holds everything the cursor covers.
+		if w.rot == nil || !w.rot.rotatedAt(w.stream.Last()) {
+			w.logger.Warn("output shorter than checkpoint offset", "path", w.path, "offset", pos.Offset, "size", size)
+		}
+		pos.Offset = size
+		w.committed = w.stream.Last()
+	default:
+		w.committed = w.stream.Last()
+	}
+	if _, err := f.Seek(pos.Offset, 0); err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.pos = pos
+	w.high = w.committed
+	w.skip = w.committed
+	w.synced = time.Now()
+	if w.rot != nil {
+		if err := w.rot.start(w.committed, pos.Offset); err != nil {
+			return fmt.Errorf("output manifest: %w", err)
+		}
+	}
+	w.logger.Info("output opened", "path", w.path, "block", w.committed, "offset", pos.Offset, "records", pos.Records)
+	return nil
+}
+
+func (w *Writer[T]) close() {
+	if err := w.file.Sync(); err != nil {
+		w.logger.Error("output sync failed", "path", w.path, "error", err)
+	}
+	w.file.Close()
+}
+
+func (w *Writer[T]) handle(v T) error {
+	e := entryOf(v)
+	if e.reverted {
+		w.retract(e)
+		if e.block <= w.skip {
+			w.skip = e.block - 1
+		}
+		if e.block > w.high {
+			// The record it retracts was never written; drop both.
+			return nil
+		}
+		if err := w.write([]T{v}); err != nil {
+			return err
+		}
+		if e.block <= w.committed {
+			// The blocks from here on are being replaced, so the cursor
+			// must not cover them any more.
+			w.committed = e.block - 1
+			return w.save(true)
+		}
+		return nil
+	}
+	switch {
+	case e.block <= w.skip:
+		recordsSkipped.With(w.path).Inc()
+		return nil
+	case e.block <= w.committed:
+		return w.write([]T{v})
+	}
+	w.held[e.block] = append(w.held[e.block], v)
+	return nil
+}
+
+func (w *Writer[T]) retract(e entry) {
+	held := w.held[e.block]
+	kept := held[:0]
+	for _, v := range held {
+		h := entryOf(v)
+		if h.blockHash == e.blockHash && (h.txHash == e.txHash || h.marker) {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	if len(kept) == 0 {
+		delete(w.held, e.block)
+	} else {
+		w.held[e.block] = kept
+	}
+}
+
+// commit writes the held records of every block up to target in block order
+// and saves the cursor as the fsync policy allows.
+func (w *Writer[T]) commit(target uint64) error {
+	if target > w.committed {
+		blocks := make([]uint64, 0)
+		for n := range w.held {
+			if n <= target {
+				blocks = append(blocks, n)
+			}
+		}
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+		records := make([]T, 0)
+		for _, n := range blocks {
+			records = append(records, w.held[n]...)
+			delete(w.held, n)
+		}
+		if err := w.write(records); err != nil {
+			return err
+		}
+		w.committed = target
+		w.high = max(w.high, target)
+		w.dirty = true
+	}
+	if w.rot != nil && w.rot.due(w.pos.Offset, w.committed) {
+		return w.rotate()
+	}
+	if !w.dirty {
+		return nil
+	}
+	switch w.fsync {
+	case config.FsyncBlock:
+		return w.save(true)
+	case config.FsyncInterval:
+		if time.Since(w.synced) < w.interval {
+			return nil
+		}
+		return w.save(true)
+	default:
+		return w.save(false)
+	}
+}
+
+// rotate moves the file aside once the cursor covers all of it.
+func (w *Writer[T]) rotate() error {
+	if err := w.save(true); err != nil || w.dirty {
+		return err
+	}
+	f, err := w.rot.rotate(w.file, w.pos.Offset, w.committed)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.pos.Offset = 0
+	return w.save(false)
+}
+
+// write appends records in a single write. A failed write leaves the file
+// past the saved offset, so it stops the writer and the next start cuts the
+// file back.
+func (w *Writer[T]) write(records []T) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	count := 0
+	first, last := uint64(math.MaxUint64), uint64(0)
+	for _, v := range records {
+		if err := enc.Encode(v); err != nil {
+			w.logger.Error("output encode failed", "path", w.path, "error", err)
+			continue
+		}
+		count++
+		e := entryOf(v)
+		first, last = min(first, e.block), max(last, e.block)
+	}
+	n, err := w.file.Write(buf.Bytes())
+	w.pos.Offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("output write: %w", err)
+	}
+	w.pos.Records += uint64(count)
+	w.dirty = true
+	if w.rot != nil && count > 0 {
+		w.rot.wrote(first, last, count)
+	}
+	recordsWritten.With(w.path).Add(float64(count))
+	if w.written != nil {
+		for _, v := range records {
+			w.written(v)
+		}
+	}
+	return nil
+}
+
+func (w *Writer[T]) save(sync bool) error {
+	if sync {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("output sync: %w", err)
+		}
+		w.synced = time.Now()
+	}
+	if err := w.stream.SaveAt(checkpoint.BlockRef{Number: w.committed}, w.pos); err != nil {
+		w.logger.Error("output checkpoint save failed", "block", w.committed, "error", err)
+		return nil
+	}
+	w.dirty = false
+	return nil
+}
+
+type entry struct {
+	block     uint64
+	blockHash string
+	txHash    string
+	reverted  bool
+	marker    bool
+}
+
+func entryOf(v any) entry {
+	switch r := v.(type) {
+	case queue.EnrichedTx:
+		return entry{block: r.BlockNumber, blockHash: r.BlockHash, txHash: r.TxHash, reverted: r.Reverted, marker: r.Marker != nil}
+	case queue.ConfirmedRef:
+		return entry{block: r.BlockNumber, blockHash: r.BlockHash, txHash: r.TxHash}
+	}
+	panic(fmt.Sprintf("output: unsupported record type %T", v))
+}
@@ -0,0 +1,150 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pumppilot/internal/checkpoint"
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+type fixedProgress uint64
+
+func (p fixedProgress) Last() uint64 { return uint64(p) }
+
+func TestWriterResumesAtSavedOffset(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Output.JSONLPath = filepath.Join(dir, "output.jsonl")
+	cfg.Output.Fsync = config.FsyncBlock
+	cp := checkpoint.New(filepath.Join(dir, "checkpoint.json"))
+	if _, err := cp.Load(); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	w := NewWriter[queue.EnrichedTx](logger, cfg, cp.Stream("output"), fixedProgress(10), nil)
+	if err := w.open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []queue.EnrichedTx{
+		{BlockNumber: 11, BlockHash: "0xb", TxHash: "0x2"},
+		{BlockNumber: 12, BlockHash: "0xc", TxHash: "0x3"},
+		{BlockNumber: 11, BlockHash: "0xb", TxHash: "0x1"},
+	} {
+		if err := w.handle(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.commit(11); err != nil {
+		t.Fatal(err)
+	}
+	// Block 12 is written past the saved offset, as if the process died
+	// before its cursor was saved.
+	if err := w.write(w.held[12]); err != nil {
+		t.Fatal(err)
+	}
+	w.file.Close()
+
+	w = NewWriter[queue.EnrichedTx](logger, cfg, cp.Stream("output"), fixedProgress(12), nil)
+	if err := w.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	if w.committed != 11 {
+		t.Fatalf("resumed at %d, want 11", w.committed)
+	}
+	for _, rec := range []queue.EnrichedTx{
+		{BlockNumber: 11, BlockHash: "0xb", TxHash: "0x1"},
+		{BlockNumber: 12, BlockHash: "0xc", TxHash: "0x3"},
+	} {
+		if err := w.handle(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.commit(12); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(cfg.Output.JSONLPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var rec queue.EnrichedTx
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec.TxHash)
+	}
+	if strings.Join(got, ",") != "0x2,0x1,0x3" {
+		t.Fatalf("output holds %v", got)
+	}
+	if pos, _ := cp.Stream("output").Position(); pos.Records != 3 || pos.Offset != int64(len(b)) {
+		t.Fatalf("saved position %+v, file size %d", pos, len(b))
+	}
+}
+
+func TestWriterRotatesAtBlockBoundaries(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Output.JSONLPath = filepath.Join(dir, "output.jsonl")
+	cfg.Output.Fsync = config.FsyncNone
+	cfg.Output.Rotate.Blocks = 2
+	cfg.Output.Rotate.Compression = config.CompressionGzip
+	cfg.Output.Rotate.Retain = 2
+	cp := checkpoint.New(filepath.Join(dir, "checkpoint.json"))
+	if _, err := cp.Load(); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter[queue.EnrichedTx](slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, cp.Stream("output"), fixedProgress(0), nil)
+	if err := w.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	for block := uint64(1); block <= 7; block++ {
+		if err := w.handle(queue.EnrichedTx{BlockNumber: block, BlockHash: "0x1", TxHash: "0x1"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.commit(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for len(w.rot.jobs) > 0 {
+		if err := w.rot.compress(<-w.rot.jobs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "output.manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, seg := range m.Segments {
+		files = append(files, seg.File)
+		if _, err := os.Stat(filepath.Join(dir, seg.File)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(files, ",") != "output-3-4.jsonl.gz,output-5-6.jsonl.gz" {
+		t.Fatalf("segments %v", files)
+	}
+	if m.Active.FirstBlock != 7 {
+		t.Fatalf("active segment starts at %d, want 7", m.Active.FirstBlock)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "output-1-2.jsonl")); !os.IsNotExist(err) {
+		t.Fatalf("segment beyond retention kept: %v", err)
+	}
+}
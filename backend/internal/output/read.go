@@ -0,0 +1,100 @@
+package output
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Files lists the files holding the output at path, oldest first: the
+// rotated segments that reach past block after, then the active file. It
+// only reads the directory, so it is safe while a writer runs.
+func Files(path string, after uint64) ([]string, error) {
+	dir := filepath.Dir(path)
+	ext := filepath.Ext(path)
+	pattern := segmentPattern(strings.TrimSuffix(filepath.Base(path), ext), ext)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+	type seg struct {
+		name        string
+		first, last uint64
+	}
+	var segs []seg
+	for _, e := range entries {
+		m := pattern.FindStringSubmatch(e.Name())
+		if m == nil || (m[3] == "" && (names[e.Name()+".gz"] || names[e.Name()+".zst"])) {
+			continue
+		}
+		first, _ := strconv.ParseUint(m[1], 10, 64)
+		last, _ := strconv.ParseUint(m[2], 10, 64)
+		if last > after {
+			segs = append(segs, seg{e.Name(), first, last})
+		}
+	}
+	sort.Slice(segs, func(i, j int) bool {
+		if segs[i].first != segs[j].first {
+			return segs[i].first < segs[j].first
+		}
+		return segs[i].last < segs[j].last
+	})
+	files := make([]string, 0, len(segs)+1)
+	for _, s := range segs {
+		files = append(files, filepath.Join(dir, s.name))
+	}
+	if names[filepath.Base(path)] {
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// Open opens an output file or segment for reading and decompresses .gz
+// and .zst segments.
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(path) {
+	case ".gz":
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &decompressed{Reader: zr, close: func() { zr.Close() }, file: f}, nil
+	case ".zst":
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &decompressed{Reader: zr, close: zr.Close, file: f}, nil
+	}
+	return f, nil
+}
+
+type decompressed struct {
+	io.Reader
+	close func()
+	file  *os.File
+}
+
+func (d *decompressed) Close() error {
+	d.close()
+	return d.file.Close()
+}
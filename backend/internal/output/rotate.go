@@ -0,0 +1,394 @@
+package output
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"pumppilot/internal/config"
+)
+
+// Segment is a closed output file. The block ranges of two segments only
+// overlap when a reorg rewrote blocks that had already been rotated out.
+type Segment struct {
+	File        string     `json:"file"`
+	FirstBlock  uint64     `json:"first_block"`
+	LastBlock   uint64     `json:"last_block"`
+	Records     uint64     `json:"records,omitempty"`
+	Bytes       int64      `json:"bytes"`
+	Compression string     `json:"compression,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+}
+
+// Active is the file currently written to. A first block of 0 means the
+// file predates rotation and starts at an unknown block.
+type Active struct {
+	File       string    `json:"file"`
+	FirstBlock uint64    `json:"first_block"`
+	OpenedAt   time.Time `json:"opened_at"`
+}
+
+// Manifest lists the segments of an output, oldest first. It is kept next
+// to the output as <name>.manifest.json.
+type Manifest struct {
+	Active   Active    `json:"active"`
+	Segments []Segment `json:"segments"`
+}
+
+// rotator moves the output file aside at block boundaries, compresses the
+// closed segments and keeps the manifest. The segment files are the source
+// of truth: their names carry the block range, and the manifest is rebuilt
+// from them on start.
+type rotator struct {
+	logger      *slog.Logger
+	path        string
+	dir         string
+	base        string
+	ext         string
+	pattern     *regexp.Regexp
+	maxBytes    int64
+	interval    time.Duration
+	blocks      uint64
+	compression string
+	retain      int
+	jobs        chan string
+
+	mu        sync.Mutex
+	manifest  Manifest
+	lastBlock uint64
+	records   uint64
+}
+
+func newRotator(logger *slog.Logger, cfg *config.Config) *rotator {
+	path := cfg.Output.JSONLPath
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	r := cfg.Output.Rotate
+	return &rotator{
+		logger:      logger,
+		path:        path,
+		dir:         filepath.Dir(path),
+		base:        base,
+		ext:         ext,
+		pattern:     segmentPattern(base, ext),
+		maxBytes:    r.MaxBytes,
+		interval:    r.Interval.Duration,
+		blocks:      r.Blocks,
+		compression: r.Compression,
+		retain:      r.Retain,
+		jobs:        make(chan string, 64),
+	}
+}
+
+// segmentPattern matches <base>-<first>-<last><ext>, compressed or not.
+func segmentPattern(base, ext string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `-(\d+)-(\d+)` + regexp.QuoteMeta(ext) + `(\.gz|\.zst)?$`)
+}
+
+func (r *rotator) manifestPath() string {
+	return filepath.Join(r.dir, r.base+".manifest.json")
+}
+
+// load rebuilds the segment list from the files on disk, keeping what the
+// previous manifest knew about them.
+func (r *rotator) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var prev Manifest
+	if b, err := os.ReadFile(r.manifestPath()); err == nil {
+		if err := json.Unmarshal(b, &prev); err != nil {
+			r.logger.Warn("output manifest unreadable, rebuilding", "path", r.manifestPath(), "error", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	known := map[string]Segment{}
+	for _, seg := range prev.Segments {
+		known[seg.File] = seg
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+	segments := make([]Segment, 0)
+	for _, e := range entries {
+		m := r.pattern.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		if m[3] == "" && (names[e.Name()+".gz"] || names[e.Name()+".zst"]) {
+			// Compressed before the plain file could be removed.
+			if err := os.Remove(filepath.Join(r.dir, e.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		seg, ok := known[e.Name()]
+		if !ok {
+			first, _ := strconv.ParseUint(m[1], 10, 64)
+			last, _ := strconv.ParseUint(m[2], 10, 64)
+			seg = Segment{File: e.Name(), FirstBlock: first, LastBlock: last, Compression: compressionOf(m[3])}
+			if info, err := e.Info(); err == nil {
+				seg.Bytes = info.Size()
+			}
+		}
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].FirstBlock != segments[j].FirstBlock {
+			return segments[i].FirstBlock < segments[j].FirstBlock
+		}
+		return segments[i].LastBlock < segments[j].LastBlock
+	})
+	r.manifest = Manifest{Active: prev.Active, Segments: segments}
+	return nil
+}
+
+// rotatedAt reports whether the last closed segment ends at block.
+func (r *rotator) rotatedAt(block uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(r.manifest.Segments)
+	return n > 0 && r.manifest.Segments[n-1].LastBlock == block
+}
+
+// start records the active file after open. An empty file starts after the
+// committed block.
+func (r *rotator) start(committed uint64, size int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size == 0 || r.manifest.Active.File == "" {
+		r.manifest.Active = Active{File: filepath.Base(r.path), OpenedAt: time.Now().UTC()}
+		if size == 0 {
+			r.manifest.Active.FirstBlock = committed + 1
+		}
+	}
+	for _, seg := range r.manifest.Segments {
+		if seg.Compression == "" && r.compression != config.CompressionNone {
+			r.enqueue(seg.File)
+		}
+	}
+	return r.writeManifest()
+}
+
+// wrote accounts records of blocks first to last written to the active file.
+func (r *rotator) wrote(first, last uint64, records int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.manifest.Active.FirstBlock = min(r.manifest.Active.FirstBlock, first)
+	r.lastBlock = max(r.lastBlock, last)
+	r.records += uint64(records)
+}
+
+func (r *rotator) due(size int64, committed uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	active := r.manifest.Active
+	switch {
+	case r.maxBytes > 0 && size >= r.maxBytes:
+		return true
+	case r.interval > 0 && time.Since(active.OpenedAt) >= r.interval:
+		return true
+	case r.blocks > 0 && active.FirstBlock > 0 && committed+1 >= active.FirstBlock+r.blocks:
+		return true
+	}
+	return false
+}
+
+// rotate closes f, which holds everything up to committed, moves it to a
+// segment named after its block range and returns a new empty active file.
+// An empty file is kept and only starts a new range.
+func (r *rotator) rotate(f *os.File, size int64, committed uint64) (*os.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	if size == 0 {
+		r.manifest.Active.FirstBlock = committed + 1
+		r.manifest.Active.OpenedAt = now
+		return f, r.writeManifest()
+	}
+	seg := Segment{
+		FirstBlock: r.manifest.Active.FirstBlock,
+		LastBlock:  max(r.lastBlock, committed),
+		Records:    r.records,
+		Bytes:      size,
+		ClosedAt:   &now,
+	}
+	seg.File = fmt.Sprintf("%s-%d-%d%s", r.base, seg.FirstBlock, seg.LastBlock, r.ext)
+	target := filepath.Join(r.dir, seg.File)
+	if _, err := os.Stat(target); err == nil {
+		return nil, fmt.Errorf("output segment %s already exists", seg.File)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(r.path, target); err != nil {
+		return nil, fmt.Errorf("output rotate: %w", err)
+	}
+	syncDir(r.dir)
+	next, err := os.OpenFile(r.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	r.logger.Info("output rotated", "segment", seg.File, "records", seg.Records, "bytes", seg.Bytes)
+
+	r.manifest.Segments = append(r.manifest.Segments, seg)
+	r.manifest.Active = Active{File: filepath.Base(r.path), FirstBlock: committed + 1, OpenedAt: now}
+	r.lastBlock = 0
+	r.records = 0
+	r.prune()
+	if r.compression != config.CompressionNone {
+		r.enqueue(seg.File)
+	}
+	return next, r.writeManifest()
+}
+
+// prune deletes the oldest segments beyond the retention limit.
+func (r *rotator) prune() {
+	if r.retain == 0 || len(r.manifest.Segments) <= r.retain {
+		return
+	}
+	drop := r.manifest.Segments[:len(r.manifest.Segments)-r.retain]
+	for _, seg := range drop {
+		if err := os.Remove(filepath.Join(r.dir, seg.File)); err != nil && !os.IsNotExist(err) {
+			r.logger.Warn("output segment delete failed", "segment", seg.File, "error", err)
+			continue
+		}
+		r.logger.Info("output segment deleted", "segment", seg.File)
+	}
+	r.manifest.Segments = append([]Segment(nil), r.manifest.Segments[len(drop):]...)
+}
+
+func (r *rotator) enqueue(name string) {
+	select {
+	case r.jobs <- name:
+	default:
+		r.logger.Warn("output compression queue full, segment left for next start", "segment", name)
+	}
+}
+
+func (r *rotator) compressLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case name := <-r.jobs:
+			if err := r.compress(name); err != nil {
+				r.logger.Error("output segment compression failed", "segment", name, "error", err)
+			}
+		}
+	}
+}
+
+func (r *rotator) compress(name string) error {
+	suffix := ".gz"
+	if r.compression == config.CompressionZstd {
+		suffix = ".zst"
+	}
+	src, err := os.Open(filepath.Join(r.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+	dst := filepath.Join(r.dir, name+suffix)
+	tmp := dst + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	var zw io.WriteCloser
+	if r.compression == config.CompressionZstd {
+		if zw, err = zstd.NewWriter(f); err != nil {
+			f.Close()
+			return err
+		}
+	} else {
+		zw = gzip.NewWriter(f)
+	}
+	_, err = io.Copy(zw, src)
+	err = errors.Join(err, zw.Close(), f.Sync())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	syncDir(r.dir)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, seg := range r.manifest.Segments {
+		if seg.File != name {
+			continue
+		}
+		r.manifest.Segments[i].File = name + suffix
+		r.manifest.Segments[i].Compression = r.compression
+		r.manifest.Segments[i].Bytes = info.Size()
+		if err := os.Remove(filepath.Join(r.dir, name)); err != nil {
+			return err
+		}
+		return r.writeManifest()
+	}
+	// Pruned while it was being compressed.
+	return os.Remove(dst)
+}
+
+func (r *rotator) writeManifest() error {
+	b, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := r.manifestPath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func compressionOf(suffix string) string {
+	switch suffix {
+	case ".gz":
+		return config.CompressionGzip
+	case ".zst":
+		return config.CompressionZstd
+	}
+	return ""
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
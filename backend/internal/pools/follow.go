@@ -0,0 +1,255 @@
+package pools
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"pumppilot/internal/util"
+)
+
+const (
+	// maxRange and maxAddresses bound a single eth_getLogs call.
+	maxRange     = 2000
+	maxAddresses = 500
+)
+
+// Run loads the snapshot and follows the pools until ctx is done, saving
+// the snapshot on the way and on return.
+func (t *Tracker) Run(ctx context.Context) error {
+	if err := t.load(); err != nil {
+		return err
+	}
+	poll := time.NewTicker(t.cfg.Pools.PollInterval.Duration)
+	defer poll.Stop()
+	snapshot := time.NewTicker(t.cfg.Pools.SnapshotInterval.Duration)
+	defer snapshot.Stop()
+	defer t.saveLogged()
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case <-snapshot.C:
+			t.saveLogged()
+		case <-poll.C:
+			if err := t.poll(ctx); err != nil && ctx.Err() == nil {
+				t.logger.Warn("pool poll failed", "error", err)
+			}
+		}
+	}
+}
+
+func (t *Tracker) poll(ctx context.Context) error {
+	head, err := t.client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	target := head - min(head, t.cfg.Pools.Confirmations)
+
+	// One set of pools per poll. Pools added while it runs wait in pending
+	// for the next one, and pools discovered behind the tracker are first
+	// read on their own up to where it is.
+	t.mu.Lock()
+	if t.block == 0 {
+		t.block = target
+	}
+	last := t.block
+	var behind []*pool
+	for _, p := range t.pending {
+		if p.CreatedBlock <= last {
+			behind = append(behind, p)
+		}
+	}
+	t.pending = nil
+	current := make([]*pool, 0, len(t.pools))
+	for _, p := range t.pools {
+		if !slices.Contains(behind, p) {
+			current = append(current, p)
+		}
+	}
+	t.mu.Unlock()
+
+	for i, p := range behind {
+		logs, err := t.fetch(ctx, p.CreatedBlock, last, addresses([]*pool{p}))
+		if err != nil {
+			t.mu.Lock()
+			t.pending = append(t.pending, behind[i:]...)
+			t.mu.Unlock()
+			return err
+		}
+		t.mu.Lock()
+		t.applyAll(logs)
+		t.mu.Unlock()
+		current = append(current, p)
+	}
+
+	addrs := addresses(current)
+	for from := last + 1; from <= target; from += maxRange {
+		to := min(target, from+maxRange-1)
+		logs, err := t.fetch(ctx, from, to, addrs)
+		if err != nil {
+			return err
+		}
+		t.mu.Lock()
+		t.applyAll(logs)
+		t.block = to
+		t.mu.Unlock()
+	}
+	if err := t.refresh(ctx); err != nil {
+		return err
+	}
+	t.prune()
+	return nil
+}
+
+// addresses lists the pools and tokens of ps.
+func addresses(ps []*pool) []common.Address {
+	var out []common.Address
+	for _, p := range ps {
+		out = append(out, p.address)
+		if p.Token != "" {
+			out = append(out, p.token)
+		}
+	}
+	return out
+}
+
+// fetch returns the logs of addrs from block from to block to. Nothing is
+// applied until all of them are in, so a failed request can be repeated.
+func (t *Tracker) fetch(ctx context.Context, from, to uint64, addrs []common.Address) ([]types.Log, error) {
+	var out []types.Log
+	for ; from <= to; from += maxRange {
+		end := min(to, from+maxRange-1)
+		for rest := addrs; len(rest) > 0; {
+			n := min(len(rest), maxAddresses)
+			var logs []types.Log
+			err := util.Retry(ctx, t.cfg.Performance.RetryMax, t.cfg.Performance.RetryBackoff.Duration, func() error {
+				cctx, cancel := t.timeout(ctx)
+				defer cancel()
+				var ferr error
+				logs, ferr = t.client.FilterLogs(cctx, ethereum.FilterQuery{
+					FromBlock: new(big.Int).SetUint64(from),
+					ToBlock:   new(big.Int).SetUint64(end),
+					Addresses: rest[:n],
+				})
+				return ferr
+			})
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, logs...)
+			rest = rest[n:]
+		}
+		if end == to {
+			break
+		}
+	}
+	// Apply in chain order, whichever request a log came from.
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].BlockNumber != out[j].BlockNumber {
+			return out[i].BlockNumber < out[j].BlockNumber
+		}
+		return out[i].Index < out[j].Index
+	})
+	return out, nil
+}
+
+// applyAll applies logs. Callers hold mu.
+func (t *Tracker) applyAll(logs []types.Log) {
+	for _, l := range logs {
+		if !l.Removed {
+			t.apply(l)
+		}
+	}
+}
+
+// refresh reads the reserves of the pools that had logs, and the token
+// supply the first time.
+func (t *Tracker) refresh(ctx context.Context) error {
+	t.mu.Lock()
+	block := t.block
+	var dirty []*pool
+	for _, p := range t.pools {
+		if p.dirty && p.CreatedBlock <= block {
+			dirty = append(dirty, p)
+		}
+	}
+	t.mu.Unlock()
+	at := hexutil.EncodeUint64(block)
+	for _, p := range dirty {
+		var supply *big.Int
+		if p.Token != "" && p.supply == nil {
+			out, err := t.call(ctx, p.token, selectorSupply, at)
+			if err != nil {
+				return err
+			}
+			if len(out) >= 32 {
+				supply = new(big.Int).SetBytes(out[:32])
+			}
+		}
+		out, err := t.call(ctx, p.address, t.reserves, at)
+		if err != nil {
+			return err
+		}
+		t.mu.Lock()
+		if supply != nil {
+			p.supply = supply
+			p.TotalSupplyWei = supply.String()
+		}
+		if len(out) >= 64 {
+			p.setReserves(new(big.Int).SetBytes(out[:32]), new(big.Int).SetBytes(out[32:64]))
+		}
+		p.Block = max(p.Block, block)
+		p.dirty = false
+		t.mu.Unlock()
+	}
+	return nil
+}
+
+func (t *Tracker) call(ctx context.Context, to common.Address, data []byte, block string) ([]byte, error) {
+	cctx, cancel := t.timeout(ctx)
+	defer cancel()
+	call := map[string]string{
+		"to":   to.Hex(),
+		"data": hexutil.Encode(data),
+	}
+	var out hexutil.Bytes
+	err := t.rpc.CallContext(cctx, &out, "eth_call", call, block)
+	var rerr rpc.Error
+	if errors.As(err, &rerr) {
+		// A revert, for example a pair without reserves_call, leaves the
+		// values unknown rather than holding up the other pools.
+		t.logger.Debug("pool call failed", "to", to.Hex(), "error", err)
+		return nil, nil
+	}
+	return out, err
+}
+
+// prune stops following pools without logs for pools.idle_after.
+func (t *Tracker) prune() {
+	cutoff := t.now().Add(-t.cfg.Pools.IdleAfter.Duration)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.pools {
+		if p.lastActive.Before(cutoff) {
+			t.remove(p)
+			t.logger.Info("pool idle, no longer tracked", "pool", p.Address, "trades", p.Trades)
+		}
+	}
+}
+
+func (t *Tracker) timeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d := t.cfg.Performance.RequestTimeout.Duration; d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return ctx, func() {}
+}
@@ -0,0 +1,295 @@
+// Package pools follows the bonding-curve pairs of new launches. Every pool
+// an event mapping discovers is read from its logs and its token's Transfer
+// logs: trades, reserves, price, market cap and holders. The state is kept
+// in memory and saved to a snapshot file from time to time.
+//
+// The tracker stays pools.confirmations behind the head and does not undo
+// reorgs deeper than that.
+package pools
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/metrics"
+	"pumppilot/internal/queue"
+	"pumppilot/internal/util"
+)
+
+var (
+	tracked  = metrics.NewGauge("pumppilot_pools_tracked", "Pools the tracker follows.")
+	poolLogs = metrics.NewCounter("pumppilot_pool_logs_total", "Pool and token logs applied by kind.", "kind")
+)
+
+var (
+	transferTopic  = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	selectorSupply = common.FromHex("0x18160ddd") // totalSupply()
+)
+
+// Pool is the state of one pair as of Block. Amounts are decimal wei.
+// PriceETH is ETH per whole token, taking both sides to have 18 decimals.
+type Pool struct {
+	Address         string  `json:"address"`
+	Token           string  `json:"token,omitempty"`
+	Deployer        string  `json:"deployer,omitempty"`
+	TxHash          string  `json:"tx_hash"`
+	CreatedBlock    uint64  `json:"created_block"`
+	CreatedAt       uint64  `json:"created_at"`
+	Block           uint64  `json:"block"`
+	Trades          int     `json:"trades"`
+	LastTradeBlock  uint64  `json:"last_trade_block,omitempty"`
+	ReserveETHWei   string  `json:"reserve_eth_wei,omitempty"`
+	ReserveTokenWei string  `json:"reserve_token_wei,omitempty"`
+	PriceETH        float64 `json:"price_eth,omitempty"`
+	TotalSupplyWei  string  `json:"total_supply_wei,omitempty"`
+	MarketCapWei    string  `json:"market_cap_wei,omitempty"`
+	Holders         int     `json:"holders"`
+}
+
+type pool struct {
+	Pool
+	address    common.Address
+	token      common.Address
+	balances   map[common.Address]*big.Int
+	supply     *big.Int
+	lastActive time.Time
+	// dirty is set by logs that may have moved the reserves.
+	dirty bool
+}
+
+// Tracker is safe for concurrent use. Add and the readers may be called
+// while Run is going.
+type Tracker struct {
+	logger      *slog.Logger
+	cfg         *config.Config
+	rpc         *rpc.Client
+	client      *ethclient.Client
+	reserves    []byte
+	tradeTopics map[common.Hash]bool
+	now         func() time.Time
+
+	mu     sync.Mutex
+	block  uint64 // last block read
+	pools  map[common.Address]*pool
+	tokens map[common.Address]*pool
+	// pending are pools added since the last poll. Those created at or
+	// before block are read from their first block on their own.
+	pending []*pool
+}
+
+func NewTracker(logger *slog.Logger, cfg *config.Config, rpcClient *rpc.Client, client *ethclient.Client) (*Tracker, error) {
+	reserves, err := util.Selector(cfg.Pools.ReservesCall)
+	if err != nil {
+		return nil, fmt.Errorf("pools.reserves_call: %w", err)
+	}
+	topics := map[common.Hash]bool{}
+	for _, s := range cfg.Pools.TradeTopics {
+		topic, err := parseTopic(s)
+		if err != nil {
+			return nil, fmt.Errorf("pools.trade_topics: %w", err)
+		}
+		topics[topic] = true
+	}
+	return &Tracker{
+		logger:      logger,
+		cfg:         cfg,
+		rpc:         rpcClient,
+		client:      client,
+		reserves:    reserves[:],
+		tradeTopics: topics,
+		now:         time.Now,
+		pools:       map[common.Address]*pool{},
+		tokens:      map[common.Address]*pool{},
+	}, nil
+}
+
+// Add starts following the pool of a launch record. The reverted copy of
+// the launch stops it again. Other records are ignored.
+func (t *Tracker) Add(rec queue.EnrichedTx) {
+	if rec.Marker != nil || !common.IsHexAddress(rec.PoolAddress) {
+		return
+	}
+	addr := common.HexToAddress(rec.PoolAddress)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.pools[addr]; ok {
+		if rec.Reverted && p.TxHash == rec.TxHash {
+			t.remove(p)
+		}
+		return
+	}
+	if rec.Reverted {
+		return
+	}
+	p := &pool{
+		Pool: Pool{
+			Address:      strings.ToLower(addr.Hex()),
+			Deployer:     strings.ToLower(rec.From),
+			TxHash:       rec.TxHash,
+			CreatedBlock: rec.BlockNumber,
+			CreatedAt:    rec.BlockTimestamp,
+		},
+		address:    addr,
+		balances:   map[common.Address]*big.Int{},
+		lastActive: t.now(),
+		dirty:      true,
+	}
+	for _, token := range rec.TokenAddresses {
+		if common.IsHexAddress(token) {
+			p.token = common.HexToAddress(token)
+			p.Token = strings.ToLower(p.token.Hex())
+			break
+		}
+	}
+	t.add(p)
+	t.pending = append(t.pending, p)
+	t.logger.Info("pool tracked", "pool", p.Address, "token", p.Token, "block", p.CreatedBlock)
+}
+
+func (t *Tracker) add(p *pool) {
+	t.pools[p.address] = p
+	if p.Token != "" {
+		t.tokens[p.token] = p
+	}
+	tracked.With().Set(float64(len(t.pools)))
+}
+
+func (t *Tracker) remove(p *pool) {
+	delete(t.pools, p.address)
+	if t.tokens[p.token] == p {
+		delete(t.tokens, p.token)
+	}
+	tracked.With().Set(float64(len(t.pools)))
+}
+
+// Pools returns the tracked pools, newest first.
+func (t *Tracker) Pools() []Pool {
+	t.mu.Lock()
+	out := make([]Pool, 0, len(t.pools))
+	for _, p := range t.pools {
+		out = append(out, p.Pool)
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedBlock != out[j].CreatedBlock {
+			return out[i].CreatedBlock > out[j].CreatedBlock
+		}
+		return out[i].Address < out[j].Address
+	})
+	return out
+}
+
+// Pool looks a pool up by its own or its token's address.
+func (t *Tracker) Pool(addr common.Address) (Pool, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.pools[addr]; ok {
+		return p.Pool, true
+	}
+	if p, ok := t.tokens[addr]; ok {
+		return p.Pool, true
+	}
+	return Pool{}, false
+}
+
+// apply takes one log of a pool or its token. Callers hold mu.
+func (t *Tracker) apply(l types.Log) {
+	if p, ok := t.pools[l.Address]; ok {
+		p.lastActive = t.now()
+		p.dirty = true
+		if len(t.tradeTopics) == 0 || (len(l.Topics) > 0 && t.tradeTopics[l.Topics[0]]) {
+			p.Trades++
+			p.LastTradeBlock = l.BlockNumber
+			poolLogs.With("trade").Inc()
+		} else {
+			poolLogs.With("other").Inc()
+		}
+		p.Block = max(p.Block, l.BlockNumber)
+		return
+	}
+	p, ok := t.tokens[l.Address]
+	if !ok || len(l.Topics) != 3 || l.Topics[0] != transferTopic || len(l.Data) < 32 {
+		return
+	}
+	poolLogs.With("transfer").Inc()
+	from := common.BytesToAddress(l.Topics[1].Bytes())
+	to := common.BytesToAddress(l.Topics[2].Bytes())
+	value := new(big.Int).SetBytes(l.Data[:32])
+	p.credit(from, new(big.Int).Neg(value))
+	p.credit(to, value)
+	if from == p.address || to == p.address {
+		p.dirty = true
+	}
+	p.lastActive = t.now()
+	p.Block = max(p.Block, l.BlockNumber)
+	p.Holders = p.holders()
+}
+
+func (p *pool) credit(addr common.Address, delta *big.Int) {
+	if addr == (common.Address{}) {
+		return
+	}
+	b := p.balances[addr]
+	if b == nil {
+		b = new(big.Int)
+	}
+	b.Add(b, delta)
+	if b.Sign() == 0 {
+		delete(p.balances, addr)
+		return
+	}
+	p.balances[addr] = b
+}
+
+// holders counts the accounts with a balance, not the pool itself.
+func (p *pool) holders() int {
+	n := 0
+	for addr, b := range p.balances {
+		if addr != p.address && b.Sign() > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// setReserves derives price and market cap from the pair's reserves.
+func (p *pool) setReserves(eth, token *big.Int) {
+	p.ReserveETHWei = eth.String()
+	p.ReserveTokenWei = token.String()
+	p.PriceETH = 0
+	p.MarketCapWei = ""
+	if token.Sign() == 0 {
+		return
+	}
+	p.PriceETH, _ = new(big.Rat).SetFrac(eth, token).Float64()
+	if p.supply != nil {
+		mc := new(big.Int).Mul(p.supply, eth)
+		p.MarketCapWei = mc.Quo(mc, token).String()
+	}
+}
+
+// parseTopic takes either a 32-byte hex topic or an event signature.
+func parseTopic(s string) (common.Hash, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "(") {
+		return crypto.Keccak256Hash([]byte(strings.ReplaceAll(s, " ", ""))), nil
+	}
+	b := common.FromHex(s)
+	if len(b) != common.HashLength {
+		return common.Hash{}, errors.New("invalid topic " + s)
+	}
+	return common.BytesToHash(b), nil
+}
@@ -0,0 +1,69 @@
+package pools
+
+import (
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/queue"
+)
+
+func transfer(token, from, to common.Address, value int64, block uint64) types.Log {
+	return types.Log{
+		Address:     token,
+		Topics:      []common.Hash{transferTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())},
+		Data:        common.BigToHash(big.NewInt(value)).Bytes(),
+		BlockNumber: block,
+	}
+}
+
+func TestTrackerAppliesLogs(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Pools.ReservesCall = "getReserves()"
+	cfg.Pools.TradeTopics = []string{"Trade(address,bool,uint256,uint256)"}
+	tr, err := NewTracker(slog.Default(), cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	alice := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	launch := queue.EnrichedTx{BlockNumber: 10, TxHash: "0x1", PoolAddress: pair.Hex(), TokenAddresses: []string{token.Hex()}}
+	tr.Add(launch)
+
+	tradeTopic, _ := parseTopic("Trade(address,bool,uint256,uint256)")
+	tr.mu.Lock()
+	tr.apply(transfer(token, common.Address{}, pair, 1000, 10)) // mint into the pool
+	tr.apply(transfer(token, pair, alice, 300, 11))
+	tr.apply(types.Log{Address: pair, Topics: []common.Hash{tradeTopic}, BlockNumber: 11})
+	tr.apply(types.Log{Address: pair, Topics: []common.Hash{common.HexToHash("0x01")}, BlockNumber: 11})
+	tr.apply(transfer(token, alice, bob, 100, 12))
+	tr.apply(transfer(token, alice, pair, 200, 13))
+	tr.mu.Unlock()
+
+	p, ok := tr.Pool(token)
+	if !ok || p.Trades != 1 || p.LastTradeBlock != 11 || p.Holders != 1 || p.Block != 13 {
+		t.Fatalf("pool %+v", p)
+	}
+
+	tr.mu.Lock()
+	pl := tr.pools[pair]
+	pl.supply = big.NewInt(1000)
+	pl.setReserves(big.NewInt(50), big.NewInt(200))
+	tr.mu.Unlock()
+	p, _ = tr.Pool(pair)
+	if p.PriceETH != 0.25 || p.MarketCapWei != "250" || p.ReserveTokenWei != "200" {
+		t.Fatalf("reserves %+v", p)
+	}
+
+	launch.Reverted = true
+	tr.Add(launch)
+	if _, ok := tr.Pool(pair); ok || len(tr.Pools()) != 0 {
+		t.Fatal("reverted launch still tracked")
+	}
+}
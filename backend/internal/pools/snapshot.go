@@ -0,0 +1,100 @@
+package pools
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type snapshot struct {
+	Block uint64      `json:"block"`
+	Pools []savedPool `json:"pools"`
+}
+
+type savedPool struct {
+	Pool
+	LastActive int64             `json:"last_active"`
+	Supply     string            `json:"supply,omitempty"`
+	Balances   map[string]string `json:"balances,omitempty"`
+}
+
+func (t *Tracker) load() error {
+	b, err := os.ReadFile(t.cfg.Pools.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.block = s.Block
+	for _, sp := range s.Pools {
+		p := &pool{
+			Pool:       sp.Pool,
+			address:    common.HexToAddress(sp.Address),
+			token:      common.HexToAddress(sp.Token),
+			balances:   map[common.Address]*big.Int{},
+			lastActive: time.Unix(sp.LastActive, 0),
+		}
+		if v, ok := new(big.Int).SetString(sp.Supply, 10); ok {
+			p.supply = v
+		}
+		for addr, bal := range sp.Balances {
+			if v, ok := new(big.Int).SetString(bal, 10); ok {
+				p.balances[common.HexToAddress(addr)] = v
+			}
+		}
+		if _, ok := t.pools[p.address]; !ok {
+			t.add(p)
+		}
+	}
+	t.logger.Info("pools loaded", "path", t.cfg.Pools.Path, "block", s.Block, "pools", len(s.Pools))
+	return nil
+}
+
+func (t *Tracker) save() error {
+	t.mu.Lock()
+	s := snapshot{Block: t.block, Pools: make([]savedPool, 0, len(t.pools))}
+	for _, p := range t.pools {
+		sp := savedPool{Pool: p.Pool, LastActive: p.lastActive.Unix(), Balances: make(map[string]string, len(p.balances))}
+		if p.supply != nil {
+			sp.Supply = p.supply.String()
+		}
+		for addr, bal := range p.balances {
+			sp.Balances[addr.Hex()] = bal.String()
+		}
+		s.Pools = append(s.Pools, sp)
+	}
+	t.mu.Unlock()
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.cfg.Pools.Path), 0o755); err != nil {
+		return err
+	}
+	tmp := t.cfg.Pools.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, t.cfg.Pools.Path); err != nil {
+		return errors.Join(err, os.Remove(tmp))
+	}
+	return nil
+}
+
+func (t *Tracker) saveLogged() {
+	if err := t.save(); err != nil {
+		t.logger.Error("pool snapshot failed", "path", t.cfg.Pools.Path, "error", err)
+	}
+}
@@ -1,28 +1,67 @@
 package queue
 
-import "github.com/ethereum/go-ethereum/common"
+import (
+	"encoding/json"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Generation, on the items of a block, is the number of reorg rewinds
+// before the block was linked into the chain window. Items of a block above
+// the fork of a later rewind are stale.
 type TxItem struct {
 	BlockNumber uint64
 	BlockHash   common.Hash
 	Timestamp   uint64
+	Generation  uint64
 	Tx          *RawTx
+	Logs        []*types.Log
 	End         bool
 }
 
 type FilteredTx struct {
-	BlockNumber uint64
-	BlockHash   common.Hash
-	Timestamp   uint64
-	Tx          *RawTx
+	BlockNumber  uint64
+	BlockHash    common.Hash
+	Timestamp    uint64
+	Generation   uint64
+	Tx           *RawTx
+	MatchedRules []string
 }
 
 type BlockFiltered struct {
 	BlockNumber   uint64
+	BlockHash     common.Hash
+	Timestamp     uint64
+	Generation    uint64
 	FilteredCount int
 }
 
+// Rewind moves the pipeline back to Fork after a reorg. It starts
+// Generation.
+type Rewind struct {
+	Fork       uint64
+	Generation uint64
+}
+
+// BlockDone reports a block whose records have all been enriched, in block
+// order.
+type BlockDone struct {
+	Number    uint64
+	Hash      common.Hash
+	Timestamp uint64
+	TxCount   int
+}
+
+type BlockRef struct {
+	Number     uint64
+	Hash       common.Hash
+	Generation uint64
+}
+
 type EnrichedTx struct {
+	Tier            string            `json:"tier,omitempty"`
 	Chain           string            `json:"chain"`
 	ChainID         uint64            `json:"chain_id"`
 	BlockNumber     uint64            `json:"block_number"`
@@ -45,7 +84,57 @@ type EnrichedTx struct {
 	PoolAddress     string            `json:"pool_address,omitempty"`
 	TokenAddresses  []string          `json:"token_addresses,omitempty"`
 	Errors          []string          `json:"errors,omitempty"`
+	Reverted        bool              `json:"reverted,omitempty"`
+	MatchedRules    []string          `json:"matched_rules,omitempty"`
 	Meta            map[string]string `json:"meta,omitempty"`
+	DeployerProfile *DeployerProfile  `json:"deployer_profile,omitempty"`
+
+	// Marker turns the record into a block complete line.
+	Marker *BlockComplete `json:"-"`
+}
+
+func (e EnrichedTx) MarshalJSON() ([]byte, error) {
+	if e.Marker != nil {
+		m := *e.Marker
+		m.Tier = e.Tier
+		return json.Marshal(m)
+	}
+	type plain EnrichedTx
+	return json.Marshal(plain(e))
+}
+
+// IsLaunch reports whether the record created a token: an event mapping
+// found its token or pool, or the tx called createToken.
+func (e EnrichedTx) IsLaunch() bool {
+	if e.Marker != nil {
+		return false
+	}
+	return len(e.TokenAddresses) > 0 || e.PoolAddress != "" || (e.Method != nil && e.Method.Name == "createToken")
+}
+
+const TypeBlockComplete = "block_complete"
+
+// BlockComplete follows the last record of a block in ordered output.
+type BlockComplete struct {
+	Type           string `json:"type"`
+	Tier           string `json:"tier,omitempty"`
+	Chain          string `json:"chain"`
+	ChainID        uint64 `json:"chain_id"`
+	BlockNumber    uint64 `json:"block_number"`
+	BlockHash      string `json:"block_hash"`
+	BlockTimestamp uint64 `json:"block_timestamp"`
+	TxCount        int    `json:"tx_count"`
+}
+
+// ConfirmedRef confirms a head tier record by reference instead of
+// repeating it.
+type ConfirmedRef struct {
+	Tier        string `json:"tier"`
+	Chain       string `json:"chain"`
+	ChainID     uint64 `json:"chain_id"`
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash"`
+	TxHash      string `json:"tx_hash"`
 }
 
 type RawTx struct {
@@ -63,6 +152,26 @@ type RawTx struct {
 	ParseErrors       []string `json:"parse_errors,omitempty"`
 }
 
+// DeployerProfile sums up the earlier launches of a deployer and what
+// happened in their pools. Times are unix seconds.
+type DeployerProfile struct {
+	Deployer      string `json:"deployer"`
+	Launches      int    `json:"launches"`
+	FirstLaunchAt uint64 `json:"first_launch_at,omitempty"`
+	LastLaunchAt  uint64 `json:"last_launch_at,omitempty"`
+	// Gaps between consecutive launches.
+	AvgSecondsBetweenLaunches float64 `json:"avg_seconds_between_launches,omitempty"`
+	MinSecondsBetweenLaunches *uint64 `json:"min_seconds_between_launches,omitempty"`
+	// Launches whose pool was bought into, traded by someone other than the
+	// deployer, and sold into by the deployer.
+	WithLiquidity int `json:"with_liquidity"`
+	WithTrades    int `json:"with_trades"`
+	DeployerSold  int `json:"deployer_sold"`
+	// Time from launch to the deployer's first sell.
+	AvgSecondsToSell float64 `json:"avg_seconds_to_sell,omitempty"`
+	MinSecondsToSell *uint64 `json:"min_seconds_to_sell,omitempty"`
+}
+
 type DecodedMethod struct {
 	Name string                 `json:"name"`
 	Args map[string]interface{} `json:"args"`
@@ -85,3 +194,30 @@ type ReceiptInfo struct {
 	TxIndex           uint   `json:"transaction_index"`
 	LogsCount         int    `json:"logs_count"`
 }
+
+// PendingTx is a mempool record. A tx is written once with status "pending"
+// when first seen, and again with "confirmed" or "dropped" once resolved.
+type PendingTx struct {
+	Status            string         `json:"status"`
+	Chain             string         `json:"chain"`
+	ChainID           uint64         `json:"chain_id"`
+	TxHash            string         `json:"tx_hash"`
+	From              string         `json:"from"`
+	To                string         `json:"to"`
+	Nonce             uint64         `json:"nonce"`
+	ValueWei          string         `json:"value_wei"`
+	Gas               uint64         `json:"gas"`
+	GasPriceWei       string         `json:"gas_price_wei,omitempty"`
+	MaxFeePerGasWei   string         `json:"max_fee_per_gas_wei,omitempty"`
+	MaxPriorityFeeWei string         `json:"max_priority_fee_wei,omitempty"`
+	Type              uint64         `json:"type"`
+	Input             string         `json:"input"`
+	Method            *DecodedMethod `json:"method,omitempty"`
+	MatchedRules      []string       `json:"matched_rules,omitempty"`
+	SeenAt            time.Time      `json:"seen_at"`
+	ResolvedAt        *time.Time     `json:"resolved_at,omitempty"`
+	BlockNumber       uint64         `json:"block_number,omitempty"`
+	BlockHash         string         `json:"block_hash,omitempty"`
+	Failed            bool           `json:"failed,omitempty"`
+	Errors            []string       `json:"errors,omitempty"`
+}
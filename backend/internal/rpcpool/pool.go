@@ -0,0 +1,458 @@
+package rpcpool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/metrics"
+)
+
+const (
+	KindHTTP = "http"
+	KindWS   = "ws"
+
+	// ewmaAlpha weighs the latest sample in the latency and error averages.
+	ewmaAlpha = 0.2
+	// minSamples is the number of requests before the error rate can eject.
+	minSamples = 10
+	// maxEjectShift caps the exponential ejection backoff at 16x eject_for.
+	maxEjectShift = 4
+)
+
+var ErrNoEndpoints = errors.New("rpcpool: no endpoints configured")
+
+var (
+	requestDuration = metrics.NewHistogram("pumppilot_rpc_request_duration_seconds", "HTTP JSON-RPC latency per method and endpoint.", nil, "method", "endpoint")
+	requestErrors   = metrics.NewCounter("pumppilot_rpc_errors_total", "Failed HTTP JSON-RPC requests per method and endpoint.", "method", "endpoint")
+)
+
+type endpoint struct {
+	kind   string
+	url    string
+	weight float64
+
+	latency      float64 // EWMA, milliseconds
+	errRate      float64 // EWMA, 0..1
+	failStreak   int
+	ejections    int
+	ejectedUntil time.Time
+	requests     uint64
+	errors       uint64
+
+	client *rpc.Client // direct client used for broadcasts
+}
+
+type EndpointStats struct {
+	Kind       string  `json:"kind"`
+	URL        string  `json:"url"`
+	Weight     float64 `json:"weight"`
+	LatencyMs  float64 `json:"latency_ms"`
+	ErrorRate  float64 `json:"error_rate"`
+	Healthy    bool    `json:"healthy"`
+	Requests   uint64  `json:"requests"`
+	Errors     uint64  `json:"errors"`
+	EjectedFor string  `json:"ejected_for,omitempty"`
+}
+
+// Pool spreads JSON-RPC traffic over several endpoints. It scores each one
+// by latency, error rate and configured weight, ejects endpoints that keep
+// failing, and fails requests over to the next best endpoint.
+type Pool struct {
+	logger         *slog.Logger
+	timeout        time.Duration
+	ejectAfter     int
+	ejectFor       time.Duration
+	maxErrorRate   float64
+	broadcastCount int
+	userAgent      string
+
+	transport http.RoundTripper
+
+	mu   sync.Mutex
+	http []*endpoint
+	ws   []*endpoint
+}
+
+func New(cfg *config.Config, logger *slog.Logger) (*Pool, error) {
+	if len(cfg.RPC.HTTPEndpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	p := &Pool{
+		logger:         logger,
+		timeout:        cfg.Performance.RequestTimeout.Duration,
+		ejectAfter:     cfg.RPC.EjectAfter,
+		ejectFor:       cfg.RPC.EjectFor.Duration,
+		maxErrorRate:   cfg.RPC.MaxErrorRate,
+		broadcastCount: cfg.RPC.BroadcastCount,
+		userAgent:      "pumppilot",
+		transport:      http.DefaultTransport,
+	}
+	for _, e := range cfg.RPC.HTTPEndpoints {
+		p.http = append(p.http, &endpoint{kind: KindHTTP, url: e.URL, weight: e.Weight})
+	}
+	for _, e := range cfg.RPC.WSEndpoints {
+		p.ws = append(p.ws, &endpoint{kind: KindWS, url: e.URL, weight: e.Weight})
+	}
+	return p, nil
+}
+
+// SetUserAgent sets the User-Agent of clients created after the call.
+func (p *Pool) SetUserAgent(ua string) {
+	p.userAgent = ua
+}
+
+// Dial returns an rpc.Client whose requests are routed through the pool.
+// RoundTrip picks the real URL; the client only gets a redacted one, which
+// the http package puts in its errors.
+func (p *Pool) Dial() (*rpc.Client, *ethclient.Client, error) {
+	httpClient := &http.Client{Transport: p, Timeout: p.timeout}
+	rpcClient, err := rpc.DialHTTPWithClient(Redact(p.http[0].url), httpClient)
+	if err != nil {
+		return nil, nil, err
+	}
+	rpcClient.SetHeader("User-Agent", p.userAgent)
+	return rpcClient, ethclient.NewClient(rpcClient), nil
+}
+
+// Close releases the direct per-endpoint clients used for broadcasts.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.http {
+		if e.client != nil {
+			e.client.Close()
+			e.client = nil
+		}
+	}
+}
+
+// RoundTrip sends the request to the best endpoint and fails over to the
+// next one on transport errors, 429s and 5xx responses.
+func (p *Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	method := rpcMethod(body)
+	var lastErr error
+	for _, e := range p.ranked(p.http) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		target, err := url.Parse(e.url)
+		if err != nil {
+			p.record(e, 0, err)
+			lastErr = err
+			continue
+		}
+		out := req.Clone(req.Context())
+		out.URL = target
+		out.Host = target.Host
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.ContentLength = int64(len(body))
+		out.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+
+		start := time.Now()
+		resp, err := p.transport.RoundTrip(out)
+		elapsed := time.Since(start)
+		requestDuration.With(method, Redact(e.url)).Observe(elapsed.Seconds())
+		if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			err = fmt.Errorf("%s: %s", Redact(e.url), resp.Status)
+		}
+		if err != nil {
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			p.record(e, elapsed, err)
+			requestErrors.With(method, Redact(e.url)).Inc()
+			lastErr = err
+			continue
+		}
+		p.record(e, elapsed, nil)
+		return resp, nil
+	}
+	if lastErr == nil {
+		lastErr = ErrNoEndpoints
+	}
+	return nil, lastErr
+}
+
+// rpcMethod names the JSON-RPC method of a request body for metrics. Batches
+// of a single method keep its name, mixed batches are reported as "batch".
+func rpcMethod(body []byte) string {
+	var call struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(body, &call) == nil && call.Method != "" {
+		return call.Method
+	}
+	var batch []struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(body, &batch) != nil || len(batch) == 0 {
+		return "unknown"
+	}
+	for _, c := range batch[1:] {
+		if c.Method != batch[0].Method {
+			return "batch"
+		}
+	}
+	return batch[0].Method
+}
+
+// SendTransaction broadcasts tx to the broadcast_count best endpoints at once
+// and succeeds as soon as one of them accepts it.
+func (p *Pool) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	_, err := p.Broadcast(ctx, tx)
+	return err
+}
+
+// Broadcast sends eth_sendRawTransaction to several endpoints concurrently.
+// It returns the tx hash once any endpoint accepts the tx, or the first
+// error if all of them reject it.
+func (p *Pool) Broadcast(ctx context.Context, tx *types.Transaction) (common.Hash, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	targets := p.ranked(p.http)
+	if n := p.broadcastCount; n > 0 && len(targets) > n {
+		targets = targets[:n]
+	}
+
+	results := make(chan error, len(targets))
+	for _, e := range targets {
+		e := e
+		go func() {
+			client, err := p.directClient(e)
+			if err != nil {
+				results <- err
+				return
+			}
+			start := time.Now()
+			err = client.CallContext(ctx, nil, "eth_sendRawTransaction", hexutil.Encode(raw))
+			if err != nil && isAlreadyKnown(err) {
+				err = nil
+			}
+			p.record(e, time.Since(start), transportErr(err))
+			results <- err
+		}()
+	}
+
+	var firstErr error
+	for range targets {
+		err := <-results
+		if err == nil {
+			return tx.Hash(), nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return common.Hash{}, firstErr
+}
+
+// WSURLs returns the websocket endpoints, best first.
+func (p *Pool) WSURLs() []string {
+	ranked := p.ranked(p.ws)
+	out := make([]string, len(ranked))
+	for i, e := range ranked {
+		out[i] = e.url
+	}
+	return out
+}
+
+// ReportWS records the outcome of a websocket dial or subscription.
+func (p *Pool) ReportWS(wsURL string, err error) {
+	p.mu.Lock()
+	var target *endpoint
+	for _, e := range p.ws {
+		if e.url == wsURL {
+			target = e
+			break
+		}
+	}
+	p.mu.Unlock()
+	if target != nil {
+		p.record(target, 0, err)
+	}
+}
+
+// Failover ejects the HTTP endpoint currently preferred for reads so that
+// traffic moves to the next one. It does nothing when no other healthy
+// endpoint is left, and reports whether a switch happened.
+func (p *Pool) Failover(reason error) bool {
+	ranked := p.ranked(p.http)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	healthy := 0
+	for _, e := range ranked {
+		if !now.Before(e.ejectedUntil) {
+			healthy++
+		}
+	}
+	if healthy < 2 {
+		return false
+	}
+	p.eject(ranked[0], reason)
+	return true
+}
+
+func (p *Pool) Stats() []EndpointStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	out := make([]EndpointStats, 0, len(p.http)+len(p.ws))
+	for _, e := range append(append([]*endpoint{}, p.http...), p.ws...) {
+		st := EndpointStats{
+			Kind:      e.kind,
+			URL:       Redact(e.url),
+			Weight:    e.weight,
+			LatencyMs: e.latency,
+			ErrorRate: e.errRate,
+			Healthy:   !now.Before(e.ejectedUntil),
+			Requests:  e.requests,
+			Errors:    e.errors,
+		}
+		if !st.Healthy {
+			st.EjectedFor = e.ejectedUntil.Sub(now).Round(time.Second).String()
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// ranked orders endpoints healthy first, then by score. Ejected endpoints
+// stay at the end so that a request can still go out when all are ejected.
+func (p *Pool) ranked(list []*endpoint) []*endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	out := append([]*endpoint(nil), list...)
+	sort.SliceStable(out, func(i, j int) bool {
+		hi, hj := !now.Before(out[i].ejectedUntil), !now.Before(out[j].ejectedUntil)
+		if hi != hj {
+			return hi
+		}
+		if !hi {
+			return out[i].ejectedUntil.Before(out[j].ejectedUntil)
+		}
+		return score(out[i]) < score(out[j])
+	})
+	return out
+}
+
+func score(e *endpoint) float64 {
+	weight := e.weight
+	if weight <= 0 {
+		weight = 1
+	}
+	return (e.latency + 1) * (1 + 4*e.errRate) / weight
+}
+
+func (p *Pool) record(e *endpoint, elapsed time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.requests++
+	if err == nil {
+		ms := float64(elapsed) / float64(time.Millisecond)
+		if e.latency == 0 {
+			e.latency = ms
+		} else if ms > 0 {
+			e.latency = ewmaAlpha*ms + (1-ewmaAlpha)*e.latency
+		}
+		e.errRate = (1 - ewmaAlpha) * e.errRate
+		e.failStreak = 0
+		if e.ejections > 0 && !time.Now().Before(e.ejectedUntil) {
+			e.ejections = 0
+		}
+		return
+	}
+	e.errors++
+	e.errRate = ewmaAlpha + (1-ewmaAlpha)*e.errRate
+	e.failStreak++
+	if e.failStreak >= p.ejectAfter || (e.requests >= minSamples && e.errRate > p.maxErrorRate) {
+		p.eject(e, err)
+	}
+}
+
+func (p *Pool) eject(e *endpoint, err error) {
+	shift := e.ejections
+	if shift > maxEjectShift {
+		shift = maxEjectShift
+	}
+	d := p.ejectFor * time.Duration(1<<shift)
+	e.ejectedUntil = time.Now().Add(d)
+	e.ejections++
+	e.failStreak = 0
+	p.logger.Warn("rpc endpoint ejected", "kind", e.kind, "url", Redact(e.url), "for", d.String(), "error_rate", e.errRate, "error", err)
+}
+
+func (p *Pool) directClient(e *endpoint) (*rpc.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e.client != nil {
+		return e.client, nil
+	}
+	c, err := rpc.DialHTTPWithClient(e.url, &http.Client{Timeout: p.timeout})
+	if err != nil {
+		return nil, err
+	}
+	c.SetHeader("User-Agent", p.userAgent)
+	e.client = c
+	return c, nil
+}
+
+// transportErr drops JSON-RPC errors, which say nothing about the health of
+// the endpoint that returned them.
+func transportErr(err error) error {
+	var rpcErr rpc.Error
+	if err != nil && errors.As(err, &rpcErr) {
+		return nil
+	}
+	return err
+}
+
+func isAlreadyKnown(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+// Redact strips the path and query from an endpoint URL, where providers
+// usually put the API key.
+func Redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "invalid-url"
+	}
+	return u.Scheme + "://" + u.Host
+}
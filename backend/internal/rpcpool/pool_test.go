@@ -0,0 +1,98 @@
+package rpcpool
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pumppilot/internal/config"
+)
+
+func TestPoolFailsOverAndEjects(t *testing.T) {
+	var badHits, goodHits atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badHits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		goodHits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":"0x10"}`)
+	}))
+	defer good.Close()
+
+	// Providers put the API key in the path.
+	badURL := bad.URL + "/v2/secret-key"
+	cfg := &config.Config{}
+	// The bad endpoint gets the higher weight so it is tried first.
+	cfg.RPC.HTTPEndpoints = []config.Endpoint{{URL: badURL, Weight: 10}, {URL: good.URL, Weight: 1}}
+	cfg.RPC.EjectAfter = 2
+	cfg.RPC.EjectFor = config.Duration{Duration: time.Minute}
+	cfg.RPC.MaxErrorRate = 0.5
+	cfg.Performance.RequestTimeout = config.Duration{Duration: 5 * time.Second}
+
+	var logs bytes.Buffer
+	pool, err := New(cfg, slog.New(slog.NewTextHandler(&logs, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	client, _, err := pool.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 4; i++ {
+		var out string
+		if err := client.CallContext(context.Background(), &out, "eth_blockNumber"); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if out != "0x10" {
+			t.Fatalf("unexpected result %q", out)
+		}
+	}
+	if badHits.Load() != 2 {
+		t.Fatalf("bad endpoint should be ejected after 2 failures, got %d hits", badHits.Load())
+	}
+	if goodHits.Load() != 4 {
+		t.Fatalf("good endpoint hits = %d, want 4", goodHits.Load())
+	}
+	for _, st := range pool.Stats() {
+		if st.URL == Redact(bad.URL) && st.Healthy {
+			t.Fatalf("bad endpoint still healthy: %+v", st)
+		}
+	}
+	if strings.Contains(logs.String(), "secret-key") {
+		t.Fatalf("endpoint path logged: %s", logs.String())
+	}
+
+	// With nothing to fail over to, the error reaches the caller.
+	cfg.RPC.HTTPEndpoints = []config.Endpoint{{URL: badURL, Weight: 1}}
+	only, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer only.Close()
+	onlyClient, _, err := only.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer onlyClient.Close()
+	var out string
+	err = onlyClient.CallContext(context.Background(), &out, "eth_blockNumber")
+	if err == nil {
+		t.Fatal("call to a failing endpoint succeeded")
+	}
+	if strings.Contains(err.Error(), "secret-key") {
+		t.Fatalf("error contains the endpoint path: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package trade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/txbuilder"
+	"pumppilot/internal/util"
+)
+
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+
+	// SourceReserves quotes from the reserves the pair reports, SourceCurve
+	// from a fresh curve built from the launch's _alpha.
+	SourceReserves = "reserves"
+	SourceCurve    = "curve"
+)
+
+// errNoReserves means the pair has no code yet, which is the only case a
+// quote falls back to a fresh curve for.
+var errNoReserves = errors.New("pair returned no reserves")
+
+// QuoteConfig describes the pair's curve. The pair is taken to be a
+// constant-product curve between an ETH and a token reserve that charges
+// FeeBps of the ETH side of each trade.
+type QuoteConfig struct {
+	ReservesCall []byte // selector of the view returning the ETH and token reserves
+	FeeBps       int64
+	// CurveTokenSupply is the token reserve of a fresh curve, whose ETH
+	// reserve is the _alpha of createToken.
+	CurveTokenSupply *big.Int
+	// DefaultSlippageBps applies to buys and sells with neither a minimum
+	// nor slippage_bps. 0 leaves the minimum required.
+	DefaultSlippageBps int64
+	MaxSlippageBps     int64
+}
+
+func NewQuoteConfig(cfg *config.Config) (QuoteConfig, error) {
+	sel, err := util.Selector(cfg.Pools.ReservesCall)
+	if err != nil {
+		return QuoteConfig{}, fmt.Errorf("pools.reserves_call: %w", err)
+	}
+	supply, ok := new(big.Int).SetString(cfg.Tx.CurveTokenSupply, 10)
+	if !ok {
+		return QuoteConfig{}, errors.New("tx.curve_token_supply must be an integer")
+	}
+	return QuoteConfig{
+		ReservesCall:       sel[:],
+		FeeBps:             cfg.Tx.PairFeeBps,
+		CurveTokenSupply:   supply,
+		DefaultSlippageBps: cfg.Tx.DefaultSlippageBps,
+		MaxSlippageBps:     cfg.Tx.MaxSlippageBps,
+	}, nil
+}
+
+// SetQuoteConfig sets the curve Quote assumes.
+func (s *Service) SetQuoteConfig(qc QuoteConfig) {
+	s.quote = qc
+}
+
+// Quote works out what a buy or sell would get at the pair's current
+// reserves. A pair without code yet, as when sniping its launch from the
+// mempool, is quoted from a fresh curve if the request has the alpha; any
+// other failure to read the reserves fails the quote.
+func (s *Service) Quote(ctx context.Context, req QuoteRequest) (*Quote, error) {
+	pair, err := parseAddress(req.Pair)
+	if err != nil {
+		return nil, err
+	}
+	var in *big.Int
+	switch req.Side {
+	case SideBuy:
+		in, err = parseEthAmount(req.EthIn, req.EthInWei)
+	case SideSell:
+		decimals := uint8(18)
+		if req.TokenAmountInWei == "" {
+			if decimals, err = s.resolveDecimals(ctx, req.Token, req.TokenDecimals); err != nil {
+				return nil, err
+			}
+		}
+		in, err = parseTokenAmount(req.TokenAmountIn, req.TokenAmountInWei, decimals)
+	default:
+		return nil, fmt.Errorf("side must be %q or %q", SideBuy, SideSell)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if in.Sign() <= 0 {
+		return nil, errors.New("amount in must be positive")
+	}
+
+	source := SourceReserves
+	reserveETH, reserveToken, err := s.reserves(ctx, pair)
+	if err != nil {
+		if !errors.Is(err, errNoReserves) || req.Alpha == "" {
+			return nil, fmt.Errorf("read reserves: %w", err)
+		}
+		alpha, aerr := parseBigInt(req.Alpha)
+		if aerr != nil {
+			return nil, fmt.Errorf("alpha: %w", aerr)
+		}
+		if s.quote.CurveTokenSupply == nil {
+			return nil, errors.New("curve token supply is not configured")
+		}
+		source = SourceCurve
+		reserveETH, reserveToken = alpha, s.quote.CurveTokenSupply
+	}
+	out, fee, impact, err := quoteAmount(req.Side, in, reserveETH, reserveToken, s.quote.FeeBps)
+	if err != nil {
+		return nil, err
+	}
+	q := &Quote{
+		Side:            req.Side,
+		Source:          source,
+		AmountInWei:     in.String(),
+		ExpectedOutWei:  out.String(),
+		ReserveETHWei:   reserveETH.String(),
+		ReserveTokenWei: reserveToken.String(),
+		PriceImpactBps:  impact,
+		Fees:            QuoteFees{PairFeeWei: fee.String()},
+	}
+	if req.From != "" {
+		s.quoteGas(ctx, req, pair, in, &q.Fees)
+	}
+	return q, nil
+}
+
+// quotedMin quotes req and takes slippageBps, or the default, off the
+// expected amount.
+func (s *Service) quotedMin(ctx context.Context, req QuoteRequest, slippageBps *int64) (*big.Int, *Quote, error) {
+	bps := s.quote.DefaultSlippageBps
+	if slippageBps != nil {
+		bps = *slippageBps
+	}
+	if bps < 0 || bps > s.quote.MaxSlippageBps {
+		return nil, nil, fmt.Errorf("slippage_bps must be between 0 and %d", s.quote.MaxSlippageBps)
+	}
+	q, err := s.Quote(ctx, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("quote: %w", err)
+	}
+	expected, _ := new(big.Int).SetString(q.ExpectedOutWei, 10)
+	return slippageMin(expected, bps), q, nil
+}
+
+func slippageMin(expected *big.Int, bps int64) *big.Int {
+	out := new(big.Int).Mul(expected, big.NewInt(10000-bps))
+	return out.Quo(out, big.NewInt(10000))
+}
+
+// wantsQuote tells whether a buy or sell without a minimum is priced from a
+// quote.
+func (s *Service) wantsQuote(slippageBps *int64) bool {
+	return slippageBps != nil || s.quote.DefaultSlippageBps > 0
+}
+
+func (s *Service) reserves(ctx context.Context, pair common.Address) (*big.Int, *big.Int, error) {
+	if s.rpcClient == nil {
+		return nil, nil, errors.New("rpc client is nil")
+	}
+	if len(s.quote.ReservesCall) == 0 {
+		return nil, nil, errors.New("reserves call is not configured")
+	}
+	call := map[string]string{
+		"to":   pair.Hex(),
+		"data": hexutil.Encode(s.quote.ReservesCall),
+	}
+	var out hexutil.Bytes
+	if err := s.rpcClient.CallContext(ctx, &out, "eth_call", call, "latest"); err != nil {
+		return nil, nil, err
+	}
+	if len(out) < 64 {
+		// Calls to an address without code return nothing.
+		return nil, nil, errNoReserves
+	}
+	return new(big.Int).SetBytes(out[:32]), new(big.Int).SetBytes(out[32:64]), nil
+}
+
+// quoteGas adds the network fee of the trade from req.From. A failed
+// estimate, as for a sell without balance or approval, is reported in the
+// fees rather than failing the quote.
+func (s *Service) quoteGas(ctx context.Context, req QuoteRequest, pair common.Address, in *big.Int, fees *QuoteFees) {
+	if s.auto == nil {
+		fees.GasError = "auto builder not configured"
+		return
+	}
+	from, err := parseAddress(req.From)
+	if err != nil {
+		fees.GasError = err.Error()
+		return
+	}
+	var gas uint64
+	var fp txbuilder.FeeParams
+	if req.Side == SideBuy {
+		gas, fp, err = s.auto.EstimateBuy(ctx, from, pair, in)
+	} else {
+		gas, fp, err = s.auto.EstimateSell(ctx, from, pair, in)
+	}
+	if err != nil {
+		fees.GasError = err.Error()
+		return
+	}
+	fees.GasLimit = gas
+	if fp.MaxFeePerGas != nil {
+		fees.MaxFeePerGasWei = fp.MaxFeePerGas.String()
+		fees.MaxNetworkFeeWei = new(big.Int).Mul(fp.MaxFeePerGas, new(big.Int).SetUint64(gas)).String()
+	}
+}
+
+// quoteAmount prices in on a constant-product curve. For a buy in is ETH
+// and the fee comes off it before the swap; for a sell in is tokens and the
+// fee comes off the ETH out. impactBps compares out with what the spot
+// price would give, both after the fee.
+func quoteAmount(side string, in, reserveETH, reserveToken *big.Int, feeBps int64) (out, fee *big.Int, impactBps int64, err error) {
+	if reserveETH.Sign() <= 0 || reserveToken.Sign() <= 0 {
+		return nil, nil, 0, errors.New("pair has no liquidity")
+	}
+	bps := big.NewInt(10000)
+	var spot *big.Int
+	if side == SideBuy {
+		fee = new(big.Int).Mul(in, big.NewInt(feeBps))
+		fee.Quo(fee, bps)
+		net := new(big.Int).Sub(in, fee)
+		out = new(big.Int).Mul(reserveToken, net)
+		out.Quo(out, new(big.Int).Add(reserveETH, net))
+		spot = new(big.Int).Mul(net, reserveToken)
+		spot.Quo(spot, reserveETH)
+	} else {
+		gross := new(big.Int).Mul(reserveETH, in)
+		gross.Quo(gross, new(big.Int).Add(reserveToken, in))
+		fee = new(big.Int).Mul(gross, big.NewInt(feeBps))
+		fee.Quo(fee, bps)
+		out = new(big.Int).Sub(gross, fee)
+		spot = new(big.Int).Mul(in, reserveETH)
+		spot.Quo(spot, reserveToken)
+		spot.Sub(spot, new(big.Int).Quo(new(big.Int).Mul(spot, big.NewInt(feeBps)), bps))
+	}
+	if spot.Sign() > 0 {
+		diff := new(big.Int).Sub(spot, out)
+		impactBps = diff.Mul(diff, bps).Quo(diff, spot).Int64()
+	}
+	return out, fee, impactBps, nil
+}
@@ -0,0 +1,45 @@
+package trade
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestQuoteAmount(t *testing.T) {
+	cases := []struct {
+		side           string
+		in, rETH, rTok int64
+		feeBps         int64
+		out, fee       int64
+		impactBps      int64
+	}{
+		{SideBuy, 100, 1000, 1000, 100, 90, 1, 909},
+		{SideSell, 100, 1000, 1000, 100, 90, 0, 909},
+		{SideSell, 1000, 500, 2000, 0, 166, 0, 3360},
+	}
+	for _, c := range cases {
+		out, fee, impact, err := quoteAmount(c.side, big.NewInt(c.in), big.NewInt(c.rETH), big.NewInt(c.rTok), c.feeBps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Int64() != c.out || fee.Int64() != c.fee || impact != c.impactBps {
+			t.Errorf("%s %d: out %s fee %s impact %d", c.side, c.in, out, fee, impact)
+		}
+	}
+	if _, _, _, err := quoteAmount(SideBuy, big.NewInt(1), big.NewInt(0), big.NewInt(1), 0); err == nil {
+		t.Error("quote against empty reserves")
+	}
+}
+
+func TestSlippageMin(t *testing.T) {
+	for _, c := range []struct{ expected, bps, min int64 }{
+		{10000, 0, 10000},
+		{10000, 250, 9750},
+		{999, 1000, 899},
+		{10000, 10000, 0},
+	} {
+		if got := slippageMin(big.NewInt(c.expected), c.bps); got.Int64() != c.min {
+			t.Errorf("%d less %d bps: %s, want %d", c.expected, c.bps, got, c.min)
+		}
+	}
+}
@@ -17,15 +17,49 @@ import (
 	"pumppilot/internal/txbuilder"
 )
 
+const (
+	KindBuy      = "buy"
+	KindSell     = "sell"
+	KindApprove  = "approve"
+	KindTransfer = "transfer"
+)
+
+// Recorder is told of every tx the service sends, with the kind and
+// request it was built for.
+type Recorder interface {
+	Track(tx *types.Transaction, from common.Address, kind string, request interface{})
+}
+
+// Broadcaster submits signed transactions. *ethclient.Client sends to a
+// single endpoint; *rpcpool.Pool fans out to several.
+type Broadcaster interface {
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
 type Service struct {
-	auto      *txbuilder.AutoBuilder
-	client    *ethclient.Client
-	rpcClient *rpc.Client
-	keys      *keys.Manager
+	auto        *txbuilder.AutoBuilder
+	client      *ethclient.Client
+	rpcClient   *rpc.Client
+	keys        *keys.Manager
+	broadcaster Broadcaster
+	quote       QuoteConfig
+	recorder    Recorder
 }
 
 func NewService(auto *txbuilder.AutoBuilder, client *ethclient.Client, rpcClient *rpc.Client, keys *keys.Manager) *Service {
-	return &Service{auto: auto, client: client, rpcClient: rpcClient, keys: keys}
+	return &Service{auto: auto, client: client, rpcClient: rpcClient, keys: keys, broadcaster: client}
+}
+
+// SetBroadcaster replaces the client used to submit signed transactions.
+func (s *Service) SetBroadcaster(b Broadcaster) {
+	if b != nil {
+		s.broadcaster = b
+	}
+}
+
+// SetRecorder has r track the txs the service sends.
+func (s *Service) SetRecorder(r Recorder) {
+	s.recorder = r
 }
 
 func (s *Service) Buy(ctx context.Context, req BuyRequest) (*TxResult, error) {
@@ -45,7 +79,13 @@ func (s *Service) Buy(ctx context.Context, req BuyRequest) (*TxResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	minOut, err := parseTokenAmount(req.MinTokensOut, req.MinTokensOutWei, decimals)
+	var minOut *big.Int
+	var quote *Quote
+	if req.MinTokensOut == "" && req.MinTokensOutWei == "" && s.wantsQuote(req.SlippageBps) {
+		minOut, quote, err = s.quotedMin(ctx, QuoteRequest{Side: SideBuy, Pair: req.Pair, Token: req.Token, EthInWei: ethValue.String()}, req.SlippageBps)
+	} else {
+		minOut, err = parseTokenAmount(req.MinTokensOut, req.MinTokensOutWei, decimals)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +93,12 @@ func (s *Service) Buy(ctx context.Context, req BuyRequest) (*TxResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	return s.signAndSend(ctx, from, tx, req.Simulate)
+	res, err := s.signAndSend(ctx, from, tx, KindBuy, req, req.Simulate)
+	if err != nil {
+		return nil, err
+	}
+	res.MinOutWei, res.Quote = minOut.String(), quote
+	return res, nil
 }
 
 func (s *Service) Sell(ctx context.Context, req SellRequest) (*TxResult, error) {
@@ -73,7 +118,13 @@ func (s *Service) Sell(ctx context.Context, req SellRequest) (*TxResult, error)
 	if err != nil {
 		return nil, err
 	}
-	minRefund, err := parseEthAmount(req.MinRefundEth, req.MinRefundWei)
+	var minRefund *big.Int
+	var quote *Quote
+	if req.MinRefundEth == "" && req.MinRefundWei == "" && s.wantsQuote(req.SlippageBps) {
+		minRefund, quote, err = s.quotedMin(ctx, QuoteRequest{Side: SideSell, Pair: req.Pair, Token: req.Token, TokenAmountInWei: tokenIn.String()}, req.SlippageBps)
+	} else {
+		minRefund, err = parseEthAmount(req.MinRefundEth, req.MinRefundWei)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +132,12 @@ func (s *Service) Sell(ctx context.Context, req SellRequest) (*TxResult, error)
 	if err != nil {
 		return nil, err
 	}
-	return s.signAndSend(ctx, from, tx, req.Simulate)
+	res, err := s.signAndSend(ctx, from, tx, KindSell, req, req.Simulate)
+	if err != nil {
+		return nil, err
+	}
+	res.MinOutWei, res.Quote = minRefund.String(), quote
+	return res, nil
 }
 
 func (s *Service) Approve(ctx context.Context, req ApproveRequest) (*TxResult, error) {
@@ -113,7 +169,7 @@ func (s *Service) Approve(ctx context.Context, req ApproveRequest) (*TxResult, e
 	if err != nil {
 		return nil, err
 	}
-	return s.signAndSend(ctx, from, tx, req.Simulate)
+	return s.signAndSend(ctx, from, tx, KindApprove, req, req.Simulate)
 }
 
 func (s *Service) Transfer(ctx context.Context, req TransferRequest) (*TxResult, error) {
@@ -133,10 +189,10 @@ func (s *Service) Transfer(ctx context.Context, req TransferRequest) (*TxResult,
 	if err != nil {
 		return nil, err
 	}
-	return s.signAndSend(ctx, from, tx, false)
+	return s.signAndSend(ctx, from, tx, KindTransfer, req, false)
 }
 
-func (s *Service) signAndSend(ctx context.Context, from common.Address, tx *types.Transaction, simulate bool) (*TxResult, error) {
+func (s *Service) signAndSend(ctx context.Context, from common.Address, tx *types.Transaction, kind string, req interface{}, simulate bool) (*TxResult, error) {
 	if tx == nil {
 		return nil, errors.New("transaction is nil")
 	}
@@ -157,13 +213,43 @@ func (s *Service) signAndSend(ctx context.Context, from common.Address, tx *type
 		s.auto.ResetNonce(from)
 		return nil, err
 	}
-	if err := s.client.SendTransaction(ctx, signed); err != nil {
+	if err := s.broadcaster.SendTransaction(ctx, signed); err != nil {
 		s.auto.ResetNonce(from)
 		return nil, err
 	}
+	if s.recorder != nil {
+		s.recorder.Track(signed, from, kind, req)
+	}
 	return &TxResult{Tx: TxSummary(signed), TxHash: signed.Hash().Hex()}, nil
 }
 
+// Fees returns the fees new txs are built with.
+func (s *Service) Fees(ctx context.Context) (txbuilder.FeeParams, error) {
+	if s.auto == nil {
+		return txbuilder.FeeParams{}, errors.New("auto builder not configured")
+	}
+	return s.auto.Fees(ctx)
+}
+
+// Resend signs and sends tx, which takes the nonce of a pending tx of from.
+// Unlike the other txs of the service it is not passed to the recorder.
+func (s *Service) Resend(ctx context.Context, from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+	if s.auto == nil {
+		return nil, errors.New("auto builder not configured")
+	}
+	if s.keys == nil {
+		return nil, errors.New("keystore not configured")
+	}
+	signed, err := s.keys.SignTransaction(from, tx, s.auto.ChainID())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.broadcaster.SendTransaction(ctx, signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
 func (s *Service) resolveDecimals(ctx context.Context, token string, override *uint8) (uint8, error) {
 	if override != nil {
 		return *override, nil
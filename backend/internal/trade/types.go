@@ -9,6 +9,7 @@ type BuyRequest struct {
 	EthInWei        string `json:"eth_in_wei,omitempty"`
 	MinTokensOut    string `json:"min_tokens_out,omitempty"`
 	MinTokensOutWei string `json:"min_tokens_out_wei,omitempty"`
+	SlippageBps     *int64 `json:"slippage_bps,omitempty"`
 	Simulate        bool   `json:"simulate,omitempty"`
 }
 
@@ -21,6 +22,7 @@ type SellRequest struct {
 	TokenAmountInWei string `json:"token_amount_in_wei,omitempty"`
 	MinRefundEth     string `json:"min_refund_eth,omitempty"`
 	MinRefundWei     string `json:"min_refund_wei,omitempty"`
+	SlippageBps      *int64 `json:"slippage_bps,omitempty"`
 	Simulate         bool   `json:"simulate,omitempty"`
 }
 
@@ -42,8 +44,49 @@ type TransferRequest struct {
 	EthWei string `json:"eth_wei,omitempty"`
 }
 
+// QuoteRequest asks what a buy of EthIn or a sell of TokenAmountIn would get.
+// With From, the quote includes the network fee. Alpha, the createToken arg
+// of the launch, lets a pair that cannot be read yet be quoted.
+type QuoteRequest struct {
+	From             string `json:"from,omitempty"`
+	Pair             string `json:"pair"`
+	Token            string `json:"token,omitempty"`
+	TokenDecimals    *uint8 `json:"token_decimals,omitempty"`
+	Side             string `json:"side"`
+	EthIn            string `json:"eth_in,omitempty"`
+	EthInWei         string `json:"eth_in_wei,omitempty"`
+	TokenAmountIn    string `json:"token_amount_in,omitempty"`
+	TokenAmountInWei string `json:"token_amount_in_wei,omitempty"`
+	Alpha            string `json:"alpha,omitempty"`
+}
+
+// Quote is the expected result of a trade. ExpectedOutWei is tokens for a
+// buy and ETH for a sell, after the pair fee.
+type Quote struct {
+	Side            string    `json:"side"`
+	Source          string    `json:"source"`
+	AmountInWei     string    `json:"amount_in_wei"`
+	ExpectedOutWei  string    `json:"expected_out_wei"`
+	ReserveETHWei   string    `json:"reserve_eth_wei"`
+	ReserveTokenWei string    `json:"reserve_token_wei"`
+	PriceImpactBps  int64     `json:"price_impact_bps"`
+	Fees            QuoteFees `json:"fees"`
+}
+
+type QuoteFees struct {
+	PairFeeWei       string `json:"pair_fee_wei"`
+	GasLimit         uint64 `json:"gas_limit,omitempty"`
+	MaxFeePerGasWei  string `json:"max_fee_per_gas_wei,omitempty"`
+	MaxNetworkFeeWei string `json:"max_network_fee_wei,omitempty"`
+	GasError         string `json:"gas_error,omitempty"`
+}
+
+// TxResult of a buy or sell has the minimum out it was sent with and, when
+// that came from slippage, the quote.
 type TxResult struct {
 	Tx              interface{} `json:"tx,omitempty"`
 	TxHash          string      `json:"tx_hash,omitempty"`
 	SimulationError string      `json:"simulation_error,omitempty"`
+	MinOutWei       string      `json:"min_out_wei,omitempty"`
+	Quote           *Quote      `json:"quote,omitempty"`
 }
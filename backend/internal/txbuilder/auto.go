@@ -77,7 +77,7 @@ func (a *AutoBuilder) BuildTransferTx(ctx context.Context, from common.Address,
 	if value == nil || value.Sign() <= 0 {
 		return nil, errors.New("value must be positive")
 	}
-	fees, err := a.fees(ctx)
+	fees, err := a.Fees(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -107,7 +107,7 @@ func (a *AutoBuilder) BuildApproveTx(ctx context.Context, from common.Address, t
 }
 
 func (a *AutoBuilder) buildTx(ctx context.Context, from common.Address, to common.Address, value *big.Int, data []byte) (*types.Transaction, error) {
-	fees, err := a.fees(ctx)
+	fees, err := a.Fees(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -147,7 +147,8 @@ func (a *AutoBuilder) ChainID() *big.Int {
 	return new(big.Int).Set(a.builder.ChainID)
 }
 
-func (a *AutoBuilder) fees(ctx context.Context) (FeeParams, error) {
+// Fees returns the fees new txs are built with.
+func (a *AutoBuilder) Fees(ctx context.Context) (FeeParams, error) {
 	if a.oracle == nil {
 		return FeeParams{}, errors.New("fee oracle is not configured")
 	}
@@ -200,3 +201,34 @@ func GweiToWei(gwei float64) (*big.Int, error) {
 func ParseHexBig(hexValue string) (*big.Int, error) {
 	return decodeHexBig(hexValue)
 }
+
+// EstimateBuy returns the gas limit and fees a buy would be built with. It
+// does not take a nonce.
+func (a *AutoBuilder) EstimateBuy(ctx context.Context, from common.Address, pair common.Address, ethInWei *big.Int) (uint64, FeeParams, error) {
+	data, err := buildBuyData(big.NewInt(0), a.builder.nextDeadline())
+	if err != nil {
+		return 0, FeeParams{}, err
+	}
+	return a.estimate(ctx, from, pair, ethInWei, data)
+}
+
+// EstimateSell is EstimateBuy for a sell.
+func (a *AutoBuilder) EstimateSell(ctx context.Context, from common.Address, pair common.Address, tokenAmountIn *big.Int) (uint64, FeeParams, error) {
+	data, err := buildSellData(tokenAmountIn, big.NewInt(0), a.builder.nextDeadline())
+	if err != nil {
+		return 0, FeeParams{}, err
+	}
+	return a.estimate(ctx, from, pair, big.NewInt(0), data)
+}
+
+func (a *AutoBuilder) estimate(ctx context.Context, from common.Address, to common.Address, value *big.Int, data []byte) (uint64, FeeParams, error) {
+	if a.builder == nil || a.client == nil {
+		return 0, FeeParams{}, errors.New("builder and client are required")
+	}
+	fees, err := a.Fees(ctx)
+	if err != nil {
+		return 0, FeeParams{}, err
+	}
+	gas, err := a.estimateGas(ctx, from, to, value, data, fees)
+	return gas, fees, err
+}
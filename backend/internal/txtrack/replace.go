@@ -0,0 +1,202 @@
+package txtrack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"pumppilot/internal/txbuilder"
+)
+
+// KindCancel is the kind of a zero-value transfer to self that takes the
+// nonce of a pending tx.
+const KindCancel = "cancel"
+
+var (
+	ErrNotTracked = errors.New("tx not tracked")
+	ErrNotPending = errors.New("tx is not pending")
+	// ErrFeeCeiling means the bumped fees would be above txtrack.max_fee_gwei.
+	ErrFeeCeiling = errors.New("replacement fees above txtrack.max_fee_gwei")
+)
+
+// Sender signs and sends replacements. *trade.Service is one.
+type Sender interface {
+	// Fees returns the fees a new tx would pay now.
+	Fees(ctx context.Context) (txbuilder.FeeParams, error)
+	// Resend signs tx, which reuses a nonce, as from and sends it.
+	Resend(ctx context.Context, from common.Address, tx *types.Transaction) (*types.Transaction, error)
+}
+
+// SetSender lets the tracker replace pending txs, on request and, with
+// txtrack.speedup_after, on its own.
+func (t *Tracker) SetSender(s Sender) {
+	t.sender = s
+}
+
+// SpeedUp re-sends the pending tx with hash, or its latest replacement, with
+// higher fees.
+func (t *Tracker) SpeedUp(ctx context.Context, hash common.Hash) (Tx, error) {
+	return t.replace(ctx, hash, false)
+}
+
+// Cancel takes the nonce of the pending tx with hash by sending nothing to
+// the sender itself, with higher fees.
+func (t *Tracker) Cancel(ctx context.Context, hash common.Hash) (Tx, error) {
+	return t.replace(ctx, hash, true)
+}
+
+func (t *Tracker) replace(ctx context.Context, hash common.Hash, cancel bool) (Tx, error) {
+	if t.sender == nil {
+		return Tx{}, errors.New("tx replacement is not configured")
+	}
+	t.replaceMu.Lock()
+	defer t.replaceMu.Unlock()
+	latest, err := t.latest(hash)
+	if err != nil {
+		return Tx{}, err
+	}
+	var old types.Transaction
+	raw, err := hexutil.Decode(latest.RawTx)
+	if err == nil {
+		err = old.UnmarshalBinary(raw)
+	}
+	if err != nil {
+		return Tx{}, fmt.Errorf("decode %s: %w", latest.Hash, err)
+	}
+	current, err := t.sender.Fees(ctx)
+	if err != nil {
+		return Tx{}, err
+	}
+	maxFee, err := txbuilder.GweiToWei(t.cfg.TxTrack.MaxFeeGwei)
+	if err != nil {
+		return Tx{}, err
+	}
+	tip, feeCap, err := bumpFees(old.GasTipCap(), old.GasFeeCap(), current, t.cfg.TxTrack.BumpPercent, maxFee)
+	if err != nil {
+		return Tx{}, err
+	}
+
+	from := common.HexToAddress(latest.From)
+	next := &types.DynamicFeeTx{
+		ChainID:    old.ChainId(),
+		Nonce:      old.Nonce(),
+		GasTipCap:  tip,
+		GasFeeCap:  feeCap,
+		Gas:        old.Gas(),
+		To:         old.To(),
+		Value:      old.Value(),
+		Data:       old.Data(),
+		AccessList: old.AccessList(),
+	}
+	kind, req, action := latest.Kind, latest.Request, "speedup"
+	if cancel {
+		next.Gas, next.To, next.Value, next.Data, next.AccessList = 21000, &from, new(big.Int), nil, nil
+		kind, req, action = KindCancel, nil, "cancel"
+	}
+	signed, err := t.sender.Resend(ctx, from, types.NewTx(next))
+	if err != nil {
+		return Tx{}, err
+	}
+	rec, err := t.track(signed, from, kind, req, latest.Hash)
+	if err != nil {
+		return Tx{}, err
+	}
+	replaced.With(action).Inc()
+	t.logger.Info("tx replaced", "action", action, "tx", latest.Hash, "replacement", rec.Hash, "nonce", rec.Nonce, "max_fee_wei", feeCap.String(), "priority_fee_wei", tip.String())
+	return rec, nil
+}
+
+// latest returns the newest tx at the nonce of the pending tx with hash,
+// which is the one a replacement has to outbid.
+func (t *Tracker) latest(hash common.Hash) (Tx, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rec, ok := t.txs[hash]
+	if !ok {
+		return Tx{}, ErrNotTracked
+	}
+	if rec.Final || rec.Status != StatusPending {
+		return Tx{}, ErrNotPending
+	}
+	latest := rec
+	for _, other := range t.txs {
+		if other.Nonce != rec.Nonce || !strings.EqualFold(other.From, rec.From) {
+			continue
+		}
+		if other.BlockNumber > 0 {
+			return Tx{}, fmt.Errorf("%w: nonce %d was used by %s", ErrNotPending, rec.Nonce, other.Hash)
+		}
+		if !other.Final && other.SubmittedAt.After(latest.SubmittedAt) {
+			latest = other
+		}
+	}
+	return *latest, nil
+}
+
+// speedUpStuck speeds up the txs pending for longer than
+// txtrack.speedup_after, counting from their latest replacement.
+func (t *Tracker) speedUpStuck(ctx context.Context) {
+	cutoff := t.now().Add(-t.cfg.TxTrack.SpeedUpAfter.Duration)
+	t.mu.Lock()
+	var stuck []common.Hash
+	for hash, rec := range t.txs {
+		if rec.Status == StatusPending && !rec.Final && rec.SubmittedAt.Before(cutoff) && !t.replacedLive(rec) {
+			stuck = append(stuck, hash)
+		}
+	}
+	t.mu.Unlock()
+	for _, hash := range stuck {
+		_, err := t.SpeedUp(ctx, hash)
+		switch {
+		case err == nil || ctx.Err() != nil:
+		case errors.Is(err, ErrFeeCeiling) || errors.Is(err, ErrNotPending):
+			t.logger.Debug("tx speed-up skipped", "tx", hash.Hex(), "error", err)
+		default:
+			t.logger.Warn("tx speed-up failed", "tx", hash.Hex(), "error", err)
+		}
+	}
+}
+
+// bumpFees returns the fees of a replacement for a tx paying oldTip and
+// oldFeeCap: at least bumpPercent more on both, as nodes require, or the
+// current fees if they are higher. The fee cap may not exceed maxFee.
+func bumpFees(oldTip, oldFeeCap *big.Int, current txbuilder.FeeParams, bumpPercent int64, maxFee *big.Int) (*big.Int, *big.Int, error) {
+	minTip := bumpBy(oldTip, bumpPercent)
+	minFeeCap := bumpBy(oldFeeCap, bumpPercent)
+	tip := maxBig(minTip, current.MaxPriorityFeePerGas)
+	feeCap := maxBig(minFeeCap, current.MaxFeePerGas)
+	feeCap = maxBig(feeCap, tip)
+	if maxFee != nil && feeCap.Cmp(maxFee) > 0 {
+		feeCap = new(big.Int).Set(maxFee)
+		if feeCap.Cmp(minFeeCap) < 0 {
+			return nil, nil, ErrFeeCeiling
+		}
+		if tip.Cmp(feeCap) > 0 {
+			tip = new(big.Int).Set(feeCap)
+		}
+		if tip.Cmp(minTip) < 0 {
+			return nil, nil, ErrFeeCeiling
+		}
+	}
+	return tip, feeCap, nil
+}
+
+// bumpBy adds percent to v, rounding up.
+func bumpBy(v *big.Int, percent int64) *big.Int {
+	out := new(big.Int).Mul(v, big.NewInt(100+percent))
+	out.Add(out, big.NewInt(99))
+	return out.Quo(out, big.NewInt(100))
+}
+
+func maxBig(a, b *big.Int) *big.Int {
+	if b != nil && b.Cmp(a) > 0 {
+		return new(big.Int).Set(b)
+	}
+	return new(big.Int).Set(a)
+}
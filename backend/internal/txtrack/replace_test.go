@@ -0,0 +1,176 @@
+package txtrack
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"pumppilot/internal/txbuilder"
+)
+
+func TestBumpFees(t *testing.T) {
+	gwei := func(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e9)) }
+	cases := []struct {
+		name            string
+		tip, feeCap     *big.Int
+		current         txbuilder.FeeParams
+		percent         int64
+		maxFee          *big.Int
+		wantTip, wantFC *big.Int
+		err             error
+	}{
+		{
+			name: "bump", tip: gwei(2), feeCap: gwei(40), percent: 10,
+			current: txbuilder.FeeParams{MaxPriorityFeePerGas: gwei(1), MaxFeePerGas: gwei(30)},
+			maxFee:  gwei(200), wantTip: big.NewInt(2.2e9), wantFC: gwei(44),
+		},
+		{
+			name: "current fees higher", tip: gwei(2), feeCap: gwei(40), percent: 10,
+			current: txbuilder.FeeParams{MaxPriorityFeePerGas: gwei(5), MaxFeePerGas: gwei(90)},
+			maxFee:  gwei(200), wantTip: gwei(5), wantFC: gwei(90),
+		},
+		{
+			name: "capped", tip: gwei(2), feeCap: gwei(40), percent: 10,
+			current: txbuilder.FeeParams{MaxPriorityFeePerGas: gwei(5), MaxFeePerGas: gwei(90)},
+			maxFee:  gwei(60), wantTip: gwei(5), wantFC: gwei(60),
+		},
+		{
+			name: "ceiling", tip: gwei(2), feeCap: gwei(190), percent: 10,
+			maxFee: gwei(200), err: ErrFeeCeiling,
+		},
+		{
+			name: "rounds up", tip: big.NewInt(1), feeCap: big.NewInt(15), percent: 12,
+			maxFee: gwei(200), wantTip: big.NewInt(2), wantFC: big.NewInt(17),
+		},
+	}
+	for _, c := range cases {
+		tip, feeCap, err := bumpFees(c.tip, c.feeCap, c.current, c.percent, c.maxFee)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("%s: err %v, want %v", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if tip.Cmp(c.wantTip) != 0 || feeCap.Cmp(c.wantFC) != 0 {
+			t.Errorf("%s: got tip %s fee cap %s, want %s %s", c.name, tip, feeCap, c.wantTip, c.wantFC)
+		}
+	}
+}
+
+// fakeSender records the replacements it is asked to send.
+type fakeSender struct {
+	sent []*types.Transaction
+}
+
+func (s *fakeSender) Fees(ctx context.Context) (txbuilder.FeeParams, error) {
+	return txbuilder.FeeParams{MaxPriorityFeePerGas: gwei(1), MaxFeePerGas: gwei(30)}, nil
+}
+
+func (s *fakeSender) Resend(ctx context.Context, from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+	s.sent = append(s.sent, tx)
+	return tx, nil
+}
+
+func TestCancelSendsSelfTransfer(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	now := testStart
+	tr := newTestTracker(t, newFakeClient(), &now)
+	sender := &fakeSender{}
+	tr.SetSender(sender)
+
+	tx := signedTx(t, key, 7)
+	tr.Track(tx, from, "buy", nil)
+	rec, err := tr.Cancel(context.Background(), tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("sent %d txs, want 1", len(sender.sent))
+	}
+	c := sender.sent[0]
+	if c.Nonce() != 7 || c.Gas() != 21000 || c.To() == nil || *c.To() != from || c.Value().Sign() != 0 || len(c.Data()) != 0 {
+		t.Fatalf("cancel is not a 21000-gas self-transfer at nonce 7: nonce=%d gas=%d to=%v value=%s data=%x", c.Nonce(), c.Gas(), c.To(), c.Value(), c.Data())
+	}
+	if c.GasTipCap().Cmp(tx.GasTipCap()) <= 0 || c.GasFeeCap().Cmp(tx.GasFeeCap()) <= 0 {
+		t.Fatalf("cancel fees %s/%s not above %s/%s", c.GasTipCap(), c.GasFeeCap(), tx.GasTipCap(), tx.GasFeeCap())
+	}
+	if rec.Kind != KindCancel || rec.Replaces != tx.Hash().Hex() || rec.Status != StatusPending {
+		t.Fatalf("unexpected cancel record: %+v", rec)
+	}
+}
+
+func TestLatestReplacement(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	now := testStart
+	tr := newTestTracker(t, newFakeClient(), &now)
+	tr.SetSender(&fakeSender{})
+
+	tx := signedTx(t, key, 7)
+	tr.Track(tx, from, "buy", nil)
+	now = now.Add(time.Second)
+	first, err := tr.SpeedUp(context.Background(), tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+	// Asking for the original again outbids its newest replacement.
+	second, err := tr.SpeedUp(context.Background(), tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Replaces != first.Hash {
+		t.Fatalf("second replacement replaces %s, want %s", second.Replaces, first.Hash)
+	}
+	if latest, err := tr.latest(tx.Hash()); err != nil || latest.Hash != second.Hash {
+		t.Fatalf("latest = %s, %v; want %s", latest.Hash, err, second.Hash)
+	}
+
+	// Once another tx at the nonce is mined there is nothing to replace.
+	tr.update(common.HexToHash(first.Hash), func(cur *Tx) { cur.Status, cur.BlockNumber = StatusIncluded, 10 })
+	if _, err := tr.latest(tx.Hash()); !errors.Is(err, ErrNotPending) {
+		t.Fatalf("latest after the nonce was mined: %v, want ErrNotPending", err)
+	}
+	if _, err := tr.latest(common.HexToHash("0x01")); !errors.Is(err, ErrNotTracked) {
+		t.Fatalf("latest of an unknown tx: %v, want ErrNotTracked", err)
+	}
+}
+
+func TestSpeedUpStuckSkipsReplacedTxs(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	now := testStart
+	tr := newTestTracker(t, newFakeClient(), &now)
+	sender := &fakeSender{}
+	tr.SetSender(sender)
+
+	tx := signedTx(t, key, 7)
+	tr.Track(tx, from, "buy", nil)
+	now = now.Add(time.Second)
+	replacement, err := tr.SpeedUp(context.Background(), tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both are past txtrack.speedup_after, but only the replacement is live.
+	now = now.Add(10 * time.Minute)
+	tr.speedUpStuck(context.Background())
+	if len(sender.sent) != 2 {
+		t.Fatalf("sent %d txs, want 2", len(sender.sent))
+	}
+	next := sender.sent[1]
+	rec, ok := tr.Get(next.Hash())
+	if !ok || rec.Replaces != replacement.Hash {
+		t.Fatalf("speed-up replaced %q, want %s", rec.Replaces, replacement.Hash)
+	}
+}
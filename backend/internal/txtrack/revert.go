@@ -0,0 +1,43 @@
+package txtrack
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	selectorError = []byte{0x08, 0xc3, 0x79, 0xa0} // Error(string)
+	selectorPanic = []byte{0x4e, 0x48, 0x7b, 0x71} // Panic(uint256)
+)
+
+// decodeRevert reads the revert data of a call: the message of
+// Error(string), the code of Panic(uint256), or else the selector of a
+// custom error. It returns "" for empty data.
+func decodeRevert(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	sel, args := data[:4], data[4:]
+	switch {
+	case bytes.Equal(sel, selectorError) && len(args) >= 64:
+		// The words are set by the contract, so compare them against what is
+		// left rather than adding to them.
+		n := uint64(len(args))
+		offset := new(big.Int).SetBytes(args[:32])
+		if !offset.IsUint64() || offset.Uint64() > n-32 {
+			break
+		}
+		start := offset.Uint64()
+		size := new(big.Int).SetBytes(args[start : start+32])
+		if !size.IsUint64() || size.Uint64() > n-start-32 {
+			break
+		}
+		return string(args[start+32 : start+32+size.Uint64()])
+	case bytes.Equal(sel, selectorPanic) && len(args) >= 32:
+		return fmt.Sprintf("panic 0x%x", new(big.Int).SetBytes(args[:32]))
+	}
+	return "custom error " + hexutil.Encode(sel)
+}
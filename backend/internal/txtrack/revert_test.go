@@ -0,0 +1,39 @@
+package txtrack
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestDecodeRevert(t *testing.T) {
+	// Error("slippage")
+	errorData := hexutil.MustDecode("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000008" +
+		"736c697070616765000000000000000000000000000000000000000000000000")
+	hugeOffset := append([]byte{0x08, 0xc3, 0x79, 0xa0}, common.LeftPadBytes(common.FromHex("fffffffffffffff0"), 32)...)
+	hugeOffset = append(hugeOffset, make([]byte, 32)...)
+	hugeSize := append([]byte{0x08, 0xc3, 0x79, 0xa0}, common.LeftPadBytes([]byte{0x20}, 32)...)
+	hugeSize = append(hugeSize, common.LeftPadBytes(common.FromHex("fffffffffffffff0"), 32)...)
+	panicData := append([]byte{0x4e, 0x48, 0x7b, 0x71}, common.LeftPadBytes([]byte{0x11}, 32)...)
+	cases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, ""},
+		{"error", errorData, "slippage"},
+		{"panic", panicData, "panic 0x11"},
+		{"custom", hexutil.MustDecode("0x12345678"), "custom error 0x12345678"},
+		{"truncated error", errorData[:40], "custom error 0x08c379a0"},
+		{"huge offset", hugeOffset, "custom error 0x08c379a0"},
+		{"huge size", hugeSize, "custom error 0x08c379a0"},
+	}
+	for _, c := range cases {
+		if got := decodeRevert(c.data); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package txtrack follows the txs the API submits until their outcome is
+// final: included, reverted, replaced by another tx at the same nonce, or
+// dropped. The txs are saved to a file on every change, so a restart picks
+// up where it left off.
+package txtrack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"pumppilot/internal/config"
+	"pumppilot/internal/metrics"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusIncluded = "included"
+	StatusReverted = "reverted"
+	StatusReplaced = "replaced"
+	StatusDropped  = "dropped"
+)
+
+var (
+	pendingTxs = metrics.NewGauge("pumppilot_txs_pending", "Submitted txs without a final outcome.")
+	outcomes   = metrics.NewCounter("pumppilot_tx_outcomes_total", "Final outcomes of submitted txs.", "status")
+	replaced   = metrics.NewCounter("pumppilot_tx_replacements_total", "Pending txs re-sent with higher fees.", "action")
+)
+
+// subscriberBuffer is how many updates a subscriber may fall behind before
+// it is dropped.
+const subscriberBuffer = 64
+
+// Tx is a submitted tx. Final is set once Status no longer changes.
+type Tx struct {
+	Hash              string          `json:"hash"`
+	From              string          `json:"from"`
+	To                string          `json:"to,omitempty"`
+	Nonce             uint64          `json:"nonce"`
+	Kind              string          `json:"kind"`
+	Request           json.RawMessage `json:"request,omitempty"`
+	RawTx             string          `json:"raw_tx"`
+	SubmittedAt       time.Time       `json:"submitted_at"`
+	Status            string          `json:"status"`
+	Final             bool            `json:"final"`
+	BlockNumber       uint64          `json:"block_number,omitempty"`
+	BlockHash         string          `json:"block_hash,omitempty"`
+	GasUsed           uint64          `json:"gas_used,omitempty"`
+	EffectiveGasPrice string          `json:"effective_gas_price,omitempty"`
+	RevertReason      string          `json:"revert_reason,omitempty"`
+	ReplacedBy        string          `json:"replaced_by,omitempty"`
+	Replaces          string          `json:"replaces,omitempty"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+	// seenAt is when the node last knew the pending tx.
+	seenAt time.Time
+}
+
+// Client is the part of *ethclient.Client the tracker uses.
+type Client interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+	NonceAt(ctx context.Context, account common.Address, block *big.Int) (uint64, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error)
+}
+
+// Tracker is safe for concurrent use.
+type Tracker struct {
+	logger *slog.Logger
+	cfg    *config.Config
+	client Client
+	now    func() time.Time
+
+	sender Sender
+	// replaceMu keeps two replacements of one nonce from racing.
+	replaceMu sync.Mutex
+
+	mu   sync.Mutex
+	txs  map[common.Hash]*Tx
+	subs map[chan Tx]struct{}
+	// dirty is set by changes not saved yet.
+	dirty bool
+	// saveMu keeps saves in the order their copies were taken.
+	saveMu sync.Mutex
+}
+
+func New(logger *slog.Logger, cfg *config.Config, client Client) *Tracker {
+	return &Tracker{
+		logger: logger,
+		cfg:    cfg,
+		client: client,
+		now:    time.Now,
+		txs:    map[common.Hash]*Tx{},
+		subs:   map[chan Tx]struct{}{},
+	}
+}
+
+// Track records tx, signed and sent by from, with the request it was built
+// for.
+func (t *Tracker) Track(tx *types.Transaction, from common.Address, kind string, request interface{}) {
+	req, _ := json.Marshal(request)
+	if _, err := t.track(tx, from, kind, req, ""); err != nil {
+		t.logger.Warn("tx track failed", "tx", tx.Hash().Hex(), "error", err)
+	}
+}
+
+func (t *Tracker) track(tx *types.Transaction, from common.Address, kind string, req json.RawMessage, replaces string) (Tx, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return Tx{}, err
+	}
+	now := t.now()
+	rec := &Tx{
+		Hash:        tx.Hash().Hex(),
+		From:        from.Hex(),
+		Nonce:       tx.Nonce(),
+		Kind:        kind,
+		Request:     req,
+		RawTx:       hexutil.Encode(raw),
+		Replaces:    replaces,
+		SubmittedAt: now,
+		Status:      StatusPending,
+		UpdatedAt:   now,
+		seenAt:      now,
+	}
+	if to := tx.To(); to != nil {
+		rec.To = to.Hex()
+	}
+	t.mu.Lock()
+	t.txs[tx.Hash()] = rec
+	t.changed(rec)
+	out := *rec
+	t.mu.Unlock()
+	t.save()
+	return out, nil
+}
+
+// Get returns a copy of the tracked tx with hash.
+func (t *Tracker) Get(hash common.Hash) (Tx, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rec, ok := t.txs[hash]
+	if !ok {
+		return Tx{}, false
+	}
+	return *rec, true
+}
+
+// List returns the tracked txs of from, or of everyone when from is empty,
+// newest first.
+func (t *Tracker) List(from string) []Tx {
+	t.mu.Lock()
+	out := make([]Tx, 0, len(t.txs))
+	for _, rec := range t.txs {
+		if from == "" || strings.EqualFold(rec.From, from) {
+			out = append(out, *rec)
+		}
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].SubmittedAt.After(out[j].SubmittedAt) })
+	return out
+}
+
+// Subscribe returns a channel of every change to a tracked tx. It is closed
+// by cancel, or when the subscriber falls behind.
+func (t *Tracker) Subscribe() (<-chan Tx, func()) {
+	ch := make(chan Tx, subscriberBuffer)
+	t.mu.Lock()
+	t.subs[ch] = struct{}{}
+	t.mu.Unlock()
+	return ch, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := t.subs[ch]; ok {
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// changed publishes rec and marks the txs for saving. Callers hold mu and
+// call save once they let go of it.
+func (t *Tracker) changed(rec *Tx) {
+	rec.UpdatedAt = t.now()
+	for ch := range t.subs {
+		select {
+		case ch <- *rec:
+		default:
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+	if rec.Final {
+		outcomes.With(rec.Status).Inc()
+	}
+	n := 0
+	for _, r := range t.txs {
+		if !r.Final {
+			n++
+		}
+	}
+	pendingTxs.With().Set(float64(n))
+	t.dirty = true
+}
+
+// Load reads the txs saved by an earlier run.
+func (t *Tracker) Load() error {
+	b, err := os.ReadFile(t.cfg.TxTrack.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []*Tx
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for _, rec := range list {
+		rec.seenAt = now
+		t.txs[common.HexToHash(rec.Hash)] = rec
+	}
+	t.logger.Info("tracked txs loaded", "path", t.cfg.TxTrack.Path, "txs", len(list))
+	return nil
+}
+
+// save writes the txs if they changed, leaving out final ones older than
+// txtrack.retain. The txs are copied under mu and written without it.
+func (t *Tracker) save() {
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return
+	}
+	t.dirty = false
+	cutoff := t.now().Add(-t.cfg.TxTrack.Retain.Duration)
+	list := make([]Tx, 0, len(t.txs))
+	for hash, rec := range t.txs {
+		if rec.Final && rec.UpdatedAt.Before(cutoff) {
+			delete(t.txs, hash)
+			continue
+		}
+		list = append(list, *rec)
+	}
+	t.mu.Unlock()
+	if err := t.write(list); err != nil {
+		t.mu.Lock()
+		t.dirty = true
+		t.mu.Unlock()
+		t.logger.Error("tx state save failed", "path", t.cfg.TxTrack.Path, "error", err)
+	}
+}
+
+func (t *Tracker) write(list []Tx) error {
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.cfg.TxTrack.Path), 0o755); err != nil {
+		return err
+	}
+	tmp := t.cfg.TxTrack.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, t.cfg.TxTrack.Path); err != nil {
+		return errors.Join(err, os.Remove(tmp))
+	}
+	return nil
+}
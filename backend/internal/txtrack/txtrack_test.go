@@ -0,0 +1,182 @@
+package txtrack
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"pumppilot/internal/config"
+)
+
+// fakeClient answers the tracker's lookups from maps.
+type fakeClient struct {
+	mu         sync.Mutex
+	receipts   map[common.Hash]*types.Receipt
+	receiptErr map[common.Hash]error
+	known      map[common.Hash]bool
+	nonce      uint64
+	callErr    error
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		receipts:   map[common.Hash]*types.Receipt{},
+		receiptErr: map[common.Hash]error{},
+		known:      map[common.Hash]bool{},
+	}
+}
+
+func (c *fakeClient) BlockNumber(ctx context.Context) (uint64, error) { return 0, nil }
+
+func (c *fakeClient) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.receiptErr[hash]; err != nil {
+		return nil, err
+	}
+	if r := c.receipts[hash]; r != nil {
+		return r, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (c *fakeClient) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.known[hash] {
+		return nil, true, nil
+	}
+	return nil, false, ethereum.NotFound
+}
+
+func (c *fakeClient) NonceAt(ctx context.Context, account common.Address, block *big.Int) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nonce, nil
+}
+
+func (c *fakeClient) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	return nil, c.callErr
+}
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestTracker returns a tracker on client whose clock is *now.
+func newTestTracker(t *testing.T, client Client, now *time.Time) *Tracker {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.TxTrack.Path = filepath.Join(t.TempDir(), "txs.json")
+	cfg.TxTrack.Confirmations = 2
+	cfg.TxTrack.DropAfter = config.Duration{Duration: 10 * time.Minute}
+	cfg.TxTrack.Retain = config.Duration{Duration: 24 * time.Hour}
+	cfg.TxTrack.SpeedUpAfter = config.Duration{Duration: time.Minute}
+	cfg.TxTrack.BumpPercent = 12
+	cfg.TxTrack.MaxFeeGwei = 200
+	tr := New(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, client)
+	tr.now = func() time.Time { return *now }
+	return tr
+}
+
+func gwei(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e9)) }
+
+// signedTx signs a 2/40 gwei transfer at nonce.
+func signedTx(t *testing.T, key *ecdsa.PrivateKey, nonce uint64) *types.Transaction {
+	t.Helper()
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(1)), &types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		Nonce:     nonce,
+		GasTipCap: gwei(2),
+		GasFeeCap: gwei(40),
+		Gas:       100000,
+		To:        &to,
+		Value:     big.NewInt(1),
+		Data:      []byte{0x01},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestTrackerSaveAndLoad(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	now := testStart
+	tr := newTestTracker(t, newFakeClient(), &now)
+
+	old := signedTx(t, key, 1)
+	tr.Track(old, from, "buy", map[string]string{"pair": "0x01"})
+	tr.update(old.Hash(), func(cur *Tx) { cur.Status, cur.Final = StatusIncluded, true })
+	// Final txs older than txtrack.retain are left out of the next save.
+	now = now.Add(25 * time.Hour)
+	tx := signedTx(t, key, 2)
+	tr.Track(tx, from, "sell", map[string]string{"pair": "0x02"})
+
+	reloaded := newTestTracker(t, newFakeClient(), &now)
+	reloaded.cfg.TxTrack.Path = tr.cfg.TxTrack.Path
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Get(old.Hash()); ok {
+		t.Fatal("expired final tx was saved")
+	}
+	got, ok := reloaded.Get(tx.Hash())
+	want, _ := tr.Get(tx.Hash())
+	if !ok {
+		t.Fatal("tracked tx not saved")
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Fatalf("reloaded %s, want %s", gotJSON, wantJSON)
+	}
+	if got.Status != StatusPending || got.Kind != "sell" || got.From != from.Hex() || got.Nonce != 2 {
+		t.Fatalf("unexpected reloaded tx: %+v", got)
+	}
+}
+
+func TestTrackerSubscribe(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	now := testStart
+	tr := newTestTracker(t, newFakeClient(), &now)
+	ch, cancel := tr.Subscribe()
+
+	tx := signedTx(t, key, 1)
+	tr.Track(tx, crypto.PubkeyToAddress(key.PublicKey), "buy", nil)
+	tr.update(tx.Hash(), func(cur *Tx) { cur.Status = StatusIncluded })
+	// An update that changes nothing is not published.
+	tr.update(tx.Hash(), func(cur *Tx) { cur.Status = StatusIncluded })
+	for _, want := range []string{StatusPending, StatusIncluded} {
+		select {
+		case got := <-ch:
+			if got.Hash != tx.Hash().Hex() || got.Status != want {
+				t.Fatalf("got %s %s, want %s", got.Hash, got.Status, want)
+			}
+		default:
+			t.Fatalf("no %s update", want)
+		}
+	}
+	select {
+	case got := <-ch:
+		t.Fatalf("unexpected update: %+v", got)
+	default:
+	}
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatal("channel open after cancel")
+	}
+	cancel()
+}
@@ -0,0 +1,242 @@
+package txtrack
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Run follows the txs that are not final yet, once per new head, until ctx
+// is done.
+func (t *Tracker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.cfg.TxTrack.PollInterval.Duration)
+	defer ticker.Stop()
+	var last uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case <-ticker.C:
+			head, err := t.client.BlockNumber(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					t.logger.Warn("tx tracker head failed", "error", err)
+				}
+				continue
+			}
+			if head == last {
+				continue
+			}
+			// Txs that could not be looked up are tried again on the next
+			// tick, without waiting for a new head.
+			if t.check(ctx, head) {
+				last = head
+			}
+			if t.cfg.TxTrack.SpeedUpAfter.Duration > 0 && t.sender != nil {
+				t.speedUpStuck(ctx)
+			}
+		}
+	}
+}
+
+// check looks at every tx that is not final as of head. A tx that cannot be
+// looked up is logged and skipped; check reports whether there were none.
+func (t *Tracker) check(ctx context.Context, head uint64) bool {
+	t.mu.Lock()
+	var open []Tx
+	for _, rec := range t.txs {
+		if !rec.Final {
+			open = append(open, *rec)
+		}
+	}
+	t.mu.Unlock()
+	// Receipts come first, so that a tx replaced by another tracked one
+	// finds the replacement in its block.
+	ok := true
+	var missing []Tx
+	for _, rec := range open {
+		receipt, err := t.client.TransactionReceipt(ctx, common.HexToHash(rec.Hash))
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			ok = false
+			if ctx.Err() == nil {
+				t.logger.Warn("tx receipt failed", "tx", rec.Hash, "error", err)
+			}
+			continue
+		}
+		if receipt == nil {
+			missing = append(missing, rec)
+			continue
+		}
+		t.included(ctx, head, rec, receipt)
+	}
+	for _, rec := range missing {
+		if err := t.checkMissing(ctx, head, rec); err != nil {
+			ok = false
+			if ctx.Err() == nil {
+				t.logger.Warn("tx check failed", "tx", rec.Hash, "error", err)
+			}
+		}
+	}
+	return ok
+}
+
+// checkMissing follows a tx without a receipt.
+func (t *Tracker) checkMissing(ctx context.Context, head uint64, rec Tx) error {
+	hash := common.HexToHash(rec.Hash)
+	// A tx whose nonce was used by another, deep enough not to be reorged,
+	// is gone for good.
+	safe := head - min(head, t.cfg.TxTrack.Confirmations)
+	nonce, err := t.client.NonceAt(ctx, common.HexToAddress(rec.From), new(big.Int).SetUint64(safe))
+	if err != nil {
+		return err
+	}
+	if nonce > rec.Nonce {
+		t.update(hash, func(cur *Tx) {
+			cur.Final = true
+			cur.Status, cur.ReplacedBy = StatusDropped, ""
+			cur.BlockNumber, cur.BlockHash = 0, ""
+			if other := t.sibling(cur); other != nil {
+				cur.Status, cur.ReplacedBy = StatusReplaced, other.Hash
+			}
+		})
+		return nil
+	}
+
+	_, _, err = t.client.TransactionByHash(ctx, hash)
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return err
+	}
+	known := err == nil
+	t.update(hash, func(cur *Tx) {
+		if cur.Status != StatusPending {
+			// Its block was reorged out.
+			cur.Status, cur.BlockNumber, cur.BlockHash, cur.GasUsed, cur.EffectiveGasPrice, cur.RevertReason = StatusPending, 0, "", 0, "", ""
+		}
+		if known {
+			cur.seenAt = t.now()
+		} else if t.now().Sub(cur.seenAt) > t.cfg.TxTrack.DropAfter.Duration && !t.replacedLive(cur) {
+			cur.Status, cur.Final = StatusDropped, true
+		}
+	})
+	return nil
+}
+
+func (t *Tracker) included(ctx context.Context, head uint64, rec Tx, receipt *types.Receipt) {
+	status := StatusIncluded
+	reason := rec.RevertReason
+	if receipt.Status == types.ReceiptStatusFailed {
+		status = StatusReverted
+		if reason == "" || rec.BlockHash != receipt.BlockHash.Hex() {
+			reason = t.revertReason(ctx, rec, receipt.BlockNumber)
+		}
+	}
+	block := receipt.BlockNumber.Uint64()
+	t.update(common.HexToHash(rec.Hash), func(cur *Tx) {
+		cur.Status = status
+		cur.BlockNumber = block
+		cur.BlockHash = receipt.BlockHash.Hex()
+		cur.GasUsed = receipt.GasUsed
+		if receipt.EffectiveGasPrice != nil {
+			cur.EffectiveGasPrice = receipt.EffectiveGasPrice.String()
+		}
+		cur.RevertReason = reason
+		cur.ReplacedBy = ""
+		cur.Final = head >= block+t.cfg.TxTrack.Confirmations
+	})
+}
+
+// revertReason replays the tx on the state before its block.
+func (t *Tracker) revertReason(ctx context.Context, rec Tx, block *big.Int) string {
+	var tx types.Transaction
+	raw, err := hexutil.Decode(rec.RawTx)
+	if err == nil {
+		err = tx.UnmarshalBinary(raw)
+	}
+	if err != nil {
+		return ""
+	}
+	msg := ethereum.CallMsg{
+		From:  common.HexToAddress(rec.From),
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+	_, err = t.client.CallContract(ctx, msg, new(big.Int).Sub(block, big.NewInt(1)))
+	if err == nil {
+		// The revert depended on txs before it in the block.
+		return ""
+	}
+	var de rpc.DataError
+	if errors.As(err, &de) {
+		if s, ok := de.ErrorData().(string); ok {
+			if b, derr := hexutil.Decode(s); derr == nil {
+				if reason := decodeRevert(b); reason != "" {
+					return reason
+				}
+			}
+		}
+	}
+	return strings.TrimPrefix(err.Error(), "execution reverted: ")
+}
+
+// sibling returns another tracked tx of the same sender and nonce that made
+// it into a block. Callers hold mu.
+func (t *Tracker) sibling(rec *Tx) *Tx {
+	for _, other := range t.txs {
+		if other != rec && other.Nonce == rec.Nonce && strings.EqualFold(other.From, rec.From) && other.BlockNumber > 0 {
+			return other
+		}
+	}
+	return nil
+}
+
+// replacedLive tells whether a later tx at the nonce of rec is still open,
+// in which case rec waits for the nonce to be used. Callers hold mu.
+func (t *Tracker) replacedLive(rec *Tx) bool {
+	for _, other := range t.txs {
+		if other != rec && other.Nonce == rec.Nonce && strings.EqualFold(other.From, rec.From) &&
+			!other.Final && other.SubmittedAt.After(rec.SubmittedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// update applies fn to the tracked tx and publishes it if that changed
+// anything but when it was last seen.
+func (t *Tracker) update(hash common.Hash, fn func(*Tx)) {
+	t.mu.Lock()
+	cur, ok := t.txs[hash]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	before := *cur
+	fn(cur)
+	after := *cur
+	before.seenAt, after.seenAt = time.Time{}, time.Time{}
+	if sameTx(before, after) {
+		t.mu.Unlock()
+		return
+	}
+	if cur.Final {
+		t.logger.Info("tx final", "tx", cur.Hash, "status", cur.Status, "block", cur.BlockNumber, "revert_reason", cur.RevertReason)
+	}
+	t.changed(cur)
+	t.mu.Unlock()
+	t.save()
+}
+
+func sameTx(a, b Tx) bool {
+	return a.Status == b.Status && a.Final == b.Final && a.BlockHash == b.BlockHash &&
+		a.RevertReason == b.RevertReason && a.ReplacedBy == b.ReplacedBy
+}
@@ -0,0 +1,136 @@
+package txtrack
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestTrackerCheck(t *testing.T) {
+	blockHash := common.HexToHash("0xb10")
+	receipt := func(status uint64) *types.Receipt {
+		return &types.Receipt{Status: status, BlockNumber: big.NewInt(10), BlockHash: blockHash, GasUsed: 21000, EffectiveGasPrice: gwei(1)}
+	}
+	cases := []struct {
+		name    string
+		receipt *types.Receipt
+		known   bool
+		nonce   uint64
+		callErr error
+		// sibling tracks another tx at the same nonce, included in block 10.
+		sibling bool
+		// prior is the state before the pass.
+		prior   func(*Tx)
+		elapsed time.Duration
+		head    uint64
+		want    Tx
+	}{
+		{
+			name: "included", receipt: receipt(1), head: 11,
+			want: Tx{Status: StatusIncluded, BlockNumber: 10, BlockHash: blockHash.Hex()},
+		},
+		{
+			name: "included and confirmed", receipt: receipt(1), head: 12,
+			want: Tx{Status: StatusIncluded, Final: true, BlockNumber: 10, BlockHash: blockHash.Hex()},
+		},
+		{
+			name: "reverted", receipt: receipt(0), callErr: errors.New("execution reverted: too late"), head: 12,
+			want: Tx{Status: StatusReverted, Final: true, BlockNumber: 10, BlockHash: blockHash.Hex(), RevertReason: "too late"},
+		},
+		{
+			name: "pending", known: true, elapsed: time.Hour, head: 12,
+			want: Tx{Status: StatusPending},
+		},
+		{
+			name: "unknown but not for long", elapsed: 5 * time.Minute, head: 12,
+			want: Tx{Status: StatusPending},
+		},
+		{
+			name: "dropped", elapsed: 11 * time.Minute, head: 12,
+			want: Tx{Status: StatusDropped, Final: true},
+		},
+		{
+			name: "nonce used by an untracked tx", nonce: 2, head: 12,
+			want: Tx{Status: StatusDropped, Final: true},
+		},
+		{
+			name: "nonce used by a tracked tx", nonce: 2, sibling: true, head: 12,
+			want: Tx{Status: StatusReplaced, Final: true},
+		},
+		{
+			name: "receipt reorged out", known: true, head: 12,
+			prior: func(cur *Tx) {
+				cur.Status, cur.BlockNumber, cur.BlockHash, cur.GasUsed = StatusIncluded, 10, blockHash.Hex(), 21000
+			},
+			want: Tx{Status: StatusPending},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, _ := crypto.GenerateKey()
+			from := crypto.PubkeyToAddress(key.PublicKey)
+			client := newFakeClient()
+			client.nonce, client.callErr = tc.nonce, tc.callErr
+			now := testStart
+			tr := newTestTracker(t, client, &now)
+
+			tx := signedTx(t, key, 1)
+			tr.Track(tx, from, "buy", nil)
+			if tc.receipt != nil {
+				client.receipts[tx.Hash()] = tc.receipt
+			}
+			client.known[tx.Hash()] = tc.known
+			if tc.prior != nil {
+				tr.update(tx.Hash(), tc.prior)
+			}
+			if tc.sibling {
+				now = now.Add(time.Second)
+				sibling := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1), Nonce: 1, GasTipCap: gwei(3), GasFeeCap: gwei(45), Gas: 21000, To: &from, Value: new(big.Int)})
+				tr.Track(sibling, from, KindCancel, nil)
+				client.receipts[sibling.Hash()] = receipt(1)
+				tc.want.ReplacedBy = sibling.Hash().Hex()
+			}
+			now = now.Add(tc.elapsed)
+
+			if !tr.check(context.Background(), tc.head) {
+				t.Fatal("check reported failed lookups")
+			}
+			got, _ := tr.Get(tx.Hash())
+			if got.Status != tc.want.Status || got.Final != tc.want.Final || got.BlockNumber != tc.want.BlockNumber ||
+				got.BlockHash != tc.want.BlockHash || got.RevertReason != tc.want.RevertReason || got.ReplacedBy != tc.want.ReplacedBy {
+				t.Fatalf("got %s final=%v block=%d %q reason=%q replaced_by=%q, want %+v",
+					got.Status, got.Final, got.BlockNumber, got.BlockHash, got.RevertReason, got.ReplacedBy, tc.want)
+			}
+		})
+	}
+}
+
+func TestTrackerCheckSkipsFailedLookup(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	client := newFakeClient()
+	now := testStart
+	tr := newTestTracker(t, client, &now)
+
+	failing, ok := signedTx(t, key, 1), signedTx(t, key, 2)
+	tr.Track(failing, from, "buy", nil)
+	tr.Track(ok, from, "buy", nil)
+	client.receiptErr[failing.Hash()] = errors.New("502 Bad Gateway")
+	client.receipts[ok.Hash()] = &types.Receipt{Status: 1, BlockNumber: big.NewInt(10), BlockHash: common.HexToHash("0xb10")}
+
+	if tr.check(context.Background(), 12) {
+		t.Fatal("check did not report the failed lookup")
+	}
+	if got, _ := tr.Get(ok.Hash()); got.Status != StatusIncluded || !got.Final {
+		t.Fatalf("other tx did not advance: %+v", got)
+	}
+	if got, _ := tr.Get(failing.Hash()); got.Status != StatusPending {
+		t.Fatalf("failed lookup changed the tx: %+v", got)
+	}
+}
@@ -0,0 +1,26 @@
+package util
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Selector takes either a 4-byte hex selector or a method signature such as
+// "transfer(address,uint256)".
+func Selector(s string) ([4]byte, error) {
+	var sel [4]byte
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "(") {
+		copy(sel[:], crypto.Keccak256([]byte(strings.ReplaceAll(s, " ", "")))[:4])
+		return sel, nil
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != 4 {
+		return sel, fmt.Errorf("invalid selector %q", s)
+	}
+	copy(sel[:], b)
+	return sel, nil
+}
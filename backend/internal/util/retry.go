@@ -3,6 +3,13 @@ package util
 import (
 	"context"
 	"time"
+
+	"pumppilot/internal/metrics"
+)
+
+var (
+	retries   = metrics.NewCounter("pumppilot_retries_total", "Attempts repeated by util.Retry.")
+	exhausted = metrics.NewCounter("pumppilot_retry_exhausted_total", "util.Retry calls that gave up.")
 )
 
 func Retry(ctx context.Context, max int, backoff time.Duration, fn func() error) error {
@@ -16,8 +23,10 @@ func Retry(ctx context.Context, max int, backoff time.Duration, fn func() error)
 			return nil
 		}
 		if attempt == max {
+			exhausted.With().Inc()
 			break
 		}
+		retries.With().Inc()
 		wait := backoff * time.Duration(1<<attempt)
 		select {
 		case <-ctx.Done():
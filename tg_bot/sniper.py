@@ -29,6 +29,8 @@ load_dotenv()
 BACKEND_API = os.getenv("BACKEND_API", "http://localhost:8080")
 BACKEND_AUTH_TOKEN = os.getenv("BACKEND_AUTH_TOKEN", "")
 OUTPUT_JSONL_PATH = os.getenv("OUTPUT_JSONL_PATH", "../backend/data/output.jsonl")
+# Highest slippage in percent; keep it at the backend's tx.max_slippage_bps / 100
+MAX_SLIPPAGE = float(os.getenv("MAX_SLIPPAGE", "50"))
 RPC_URL = os.getenv(
     "RPC_URL",
     "https://weathered-tiniest-sunset.base-mainnet.quiknode.pro/eef4e16be8050f49227e10af6d447be5175e638b/",
@@ -107,13 +109,17 @@ def get_token_balance(wallet_address: str, token: str) -> str:
     return resp.json().get("balance_wei", "0")
 
 
-def execute_buy(wallet_address: str, pair: str, token: str, eth_in: str) -> dict:
+def execute_buy(
+    wallet_address: str, pair: str, token: str, eth_in: str, slippage: float
+) -> dict:
+    # The backend quotes the pair and takes the slippage off the expected
+    # tokens for the minimum.
     payload = {
         "from": wallet_address,
         "pair": pair,
         "token": token,
         "eth_in": eth_in,
-        "min_tokens_out": "0",
+        "slippage_bps": int(round(min(max(slippage, 0.0), MAX_SLIPPAGE) * 100)),
     }
     resp = requests.post(f"{BACKEND_API}/trade/buy", headers=_headers(), json=payload)
     resp.raise_for_status()
@@ -379,7 +385,7 @@ async def button_handler(update: Update, context: ContextTypes.DEFAULT_TYPE):
         val = data[5:]
         if val == "custom":
             await query.edit_message_text(
-                "Enter custom slippage percentage:",
+                f"Enter custom slippage percentage (max {MAX_SLIPPAGE:g}%):",
                 reply_markup=back_menu_keyboard(),
             )
             ud["awaiting_input"] = "slippage_custom"
@@ -488,11 +494,18 @@ async def text_input_handler(update: Update, context: ContextTypes.DEFAULT_TYPE)
 
     if awaiting == "slippage_custom":
         try:
-            ud["slippage"] = float(text)
+            slippage = float(text)
         except ValueError:
             await update.message.reply_text("Invalid number. Try again:")
             ud["awaiting_input"] = "slippage_custom"
             return
+        if not 0 <= slippage <= MAX_SLIPPAGE:
+            await update.message.reply_text(
+                f"Slippage must be between 0 and {MAX_SLIPPAGE:g}%. Try again:"
+            )
+            ud["awaiting_input"] = "slippage_custom"
+            return
+        ud["slippage"] = slippage
         await update.message.reply_text(
             "Enter the withdraw address for tokens:",
             reply_markup=back_menu_keyboard(),
@@ -674,6 +687,7 @@ async def _wait_for_funding(
                     tracked_address=ud["tracked_address"],
                     wallet_address=wallet,
                     position_size=ud.get("position_size", 0.01),
+                    slippage=ud.get("slippage", 10.0),
                     bot=bot,
                 )
             )
@@ -792,6 +806,7 @@ async def watch_jsonl_for_tokens(
     tracked_address: str,
     wallet_address: str,
     position_size: float,
+    slippage: float,
     bot,
 ):
     path = os.path.abspath(OUTPUT_JSONL_PATH)
@@ -852,7 +867,11 @@ async def watch_jsonl_for_tokens(
                 # Buy
                 try:
                     result = execute_buy(
-                        wallet_address, pool_address, token, str(position_size)
+                        wallet_address,
+                        pool_address,
+                        token,
+                        str(position_size),
+                        slippage,
                     )
                     buy_tx = result.get("tx_hash", "pending")
                     await bot.send_message(